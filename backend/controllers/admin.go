@@ -0,0 +1,54 @@
+package controllers
+
+import (
+	"net/http"
+	"smart-gallery-backend/database"
+	"smart-gallery-backend/models"
+	"smart-gallery-backend/utils"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetAICacheStats 按提供方、模型和提示词版本汇总 AI 结果缓存
+func GetAICacheStats(c *gin.Context) {
+	var stats []struct {
+		Provider      string `json:"provider"`
+		Model         string `json:"model"`
+		PromptVersion string `json:"prompt_version"`
+		Entries       int64  `json:"entries"`
+		Hits          int64  `json:"hits"`
+	}
+	err := database.DB.Model(&models.AICacheEntry{}).
+		Select("provider, model, prompt_version, COUNT(*) AS entries, SUM(hits) AS hits").
+		Group("provider, model, prompt_version").
+		Order("provider, model, prompt_version").
+		Scan(&stats).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取缓存统计失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"prompt_version": utils.PromptVersion(), "data": stats})
+}
+
+// InvalidateAICache 删除某个提示词版本的缓存，可再按 provider、model 缩小范围
+func InvalidateAICache(c *gin.Context) {
+	version := strings.TrimSpace(c.Query("prompt_version"))
+	if version == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请指定 prompt_version"})
+		return
+	}
+	db := database.DB.Where("prompt_version = ?", version)
+	if provider := strings.TrimSpace(c.Query("provider")); provider != "" {
+		db = db.Where("provider = ?", provider)
+	}
+	if model := strings.TrimSpace(c.Query("model")); model != "" {
+		db = db.Where("model = ?", model)
+	}
+	res := db.Delete(&models.AICacheEntry{})
+	if res.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "清除缓存失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "清除成功", "deleted": res.RowsAffected})
+}
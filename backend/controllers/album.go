@@ -0,0 +1,580 @@
+package controllers
+
+import (
+	"net/http"
+	"smart-gallery-backend/database"
+	"smart-gallery-backend/models"
+	"smart-gallery-backend/utils"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// AlbumInput 创建/修改相册的参数，修改时未提供的字段保持不变
+type AlbumInput struct {
+	Name         *string `json:"name"`
+	Description  *string `json:"description"`
+	CoverImageID *uint   `json:"cover_image_id"`
+	Query        *string `json:"query"` // 非空时创建智能相册
+}
+
+// AlbumImagesInput 批量添加或排序相册图片的参数
+type AlbumImagesInput struct {
+	ImageIDs []uint `json:"image_ids" binding:"required"`
+}
+
+// AlbumOrderInput 相册排序参数
+type AlbumOrderInput struct {
+	AlbumIDs []uint `json:"album_ids" binding:"required"`
+}
+
+// GetAlbums 获取当前用户的相册列表
+func GetAlbums(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	var albums []models.Album
+	if err := database.DB.Where("user_id = ?", userID).Order("position, id").Find(&albums).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取相册失败"})
+		return
+	}
+	if err := fillAlbumSummaries(albums); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取相册失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": albums})
+}
+
+// CreateAlbum 创建相册，新相册排在最后
+func CreateAlbum(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	var input AlbumInput
+	if err := c.ShouldBindJSON(&input); err != nil || input.Name == nil || strings.TrimSpace(*input.Name) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "相册名称不能为空"})
+		return
+	}
+
+	album := models.Album{
+		UserID: userID.(uint),
+		Name:   strings.TrimSpace(*input.Name),
+		Kind:   models.AlbumStatic,
+	}
+	if input.Description != nil {
+		album.Description = *input.Description
+	}
+	if input.Query != nil && strings.TrimSpace(*input.Query) != "" {
+		query := strings.TrimSpace(*input.Query)
+		if _, err := utils.ParseQuery(query); err != nil {
+			writeQueryError(c, err)
+			return
+		}
+		album.Kind = models.AlbumSmart
+		album.Query = query
+	}
+
+	var maxPos int
+	database.DB.Model(&models.Album{}).Where("user_id = ?", userID).Select("COALESCE(MAX(position), -1)").Scan(&maxPos)
+	album.Position = maxPos + 1
+
+	if err := database.DB.Create(&album).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建相册失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "创建成功", "album": album})
+}
+
+// GetAlbum 获取单个相册信息
+func GetAlbum(c *gin.Context) {
+	album, ok := findAlbum(c)
+	if !ok {
+		return
+	}
+	fillAlbumSummary(album)
+	c.JSON(http.StatusOK, gin.H{"album": album})
+}
+
+// UpdateAlbum 重命名相册、修改描述或设置封面
+func UpdateAlbum(c *gin.Context) {
+	album, ok := findAlbum(c)
+	if !ok {
+		return
+	}
+	var input AlbumInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+
+	updates := map[string]interface{}{}
+	if input.Name != nil {
+		name := strings.TrimSpace(*input.Name)
+		if name == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "相册名称不能为空"})
+			return
+		}
+		updates["name"] = name
+	}
+	if input.Description != nil {
+		updates["description"] = *input.Description
+	}
+	if input.Query != nil {
+		if album.Kind != models.AlbumSmart {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "只有智能相册可以设置检索条件"})
+			return
+		}
+		query := strings.TrimSpace(*input.Query)
+		if query == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "检索条件不能为空"})
+			return
+		}
+		if _, err := utils.ParseQuery(query); err != nil {
+			writeQueryError(c, err)
+			return
+		}
+		updates["query"] = query
+		album.Query = query
+	}
+	if input.CoverImageID != nil {
+		// 封面 0 表示恢复默认（第一张图片）
+		if *input.CoverImageID == 0 {
+			updates["cover_image_id"] = nil
+		} else {
+			q, err := albumImagesQuery(album)
+			var count int64
+			if err == nil {
+				q.Where("images.id = ?", *input.CoverImageID).Count(&count)
+			}
+			if count == 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "封面必须是相册中的图片"})
+				return
+			}
+			updates["cover_image_id"] = *input.CoverImageID
+		}
+	}
+
+	if len(updates) > 0 {
+		if err := database.DB.Model(album).Updates(updates).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "更新相册失败"})
+			return
+		}
+	}
+	database.DB.First(album, album.ID)
+	fillAlbumSummary(album)
+	c.JSON(http.StatusOK, gin.H{"message": "更新成功", "album": album})
+}
+
+// DeleteAlbum 删除相册，只删除相册与图片的关联，不删除图片本身
+func DeleteAlbum(c *gin.Context) {
+	album, ok := findAlbum(c)
+	if !ok {
+		return
+	}
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("album_id = ?", album.ID).Delete(&models.AlbumImage{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(album).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除相册失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "删除成功"})
+}
+
+// ReorderAlbums 按给定顺序排列相册，未列出的相册排在后面
+func ReorderAlbums(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	var input AlbumOrderInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var albums []models.Album
+		if err := tx.Where("user_id = ?", userID).Order("position, id").Find(&albums).Error; err != nil {
+			return err
+		}
+		if len(albums) == 0 {
+			return nil
+		}
+		ids := make([]uint, len(albums))
+		for i, a := range albums {
+			ids[i] = a.ID
+		}
+		scope := tx.Model(&models.Album{}).Where("user_id = ?", userID).Session(&gorm.Session{})
+		return updatePositions(scope, "id", reorderIDs(ids, input.AlbumIDs))
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "排序失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "排序成功"})
+}
+
+// GetAlbumImages 分页返回相册图片，支持与图片列表相同的分页和排序参数；
+// 静态相册默认按相册内顺序排列，智能相册默认按上传时间倒序
+func GetAlbumImages(c *gin.Context) {
+	album, ok := findAlbum(c)
+	if !ok {
+		return
+	}
+	sort, desc := "created_at", true
+	if album.Kind != models.AlbumSmart {
+		sort, desc = "position", false
+	}
+	opts, err := parseListOptionsDefault(c, sort, desc)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	q, err := albumImagesQuery(album)
+	if err != nil {
+		writeQueryError(c, err)
+		return
+	}
+	paginate(c, q, opts)
+}
+
+// AddAlbumImages 向相册添加图片，已在相册中的图片会被忽略
+func AddAlbumImages(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	album, ok := findAlbum(c)
+	if !ok {
+		return
+	}
+	if !requireStaticAlbum(c, album) {
+		return
+	}
+	var input AlbumImagesInput
+	if err := c.ShouldBindJSON(&input); err != nil || len(input.ImageIDs) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请选择图片"})
+		return
+	}
+
+	// 只能添加自己的图片
+	var owned []uint
+	database.DB.Model(&models.Image{}).Where("id IN ? AND user_id = ?", input.ImageIDs, userID).Pluck("id", &owned)
+	if len(owned) != len(uniqueIDs(input.ImageIDs)) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "部分图片不存在"})
+		return
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var maxPos int
+		tx.Model(&models.AlbumImage{}).Where("album_id = ?", album.ID).Select("COALESCE(MAX(position), -1)").Scan(&maxPos)
+		rows := make([]models.AlbumImage, 0, len(input.ImageIDs))
+		for _, id := range uniqueIDs(input.ImageIDs) {
+			maxPos++
+			rows = append(rows, models.AlbumImage{AlbumID: album.ID, ImageID: id, Position: maxPos})
+		}
+		return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&rows).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "添加失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "添加成功"})
+}
+
+// RemoveAlbumImage 从相册移除图片，图片本身保留
+func RemoveAlbumImage(c *gin.Context) {
+	album, ok := findAlbum(c)
+	if !ok {
+		return
+	}
+	if !requireStaticAlbum(c, album) {
+		return
+	}
+	imageID, err := strconv.ParseUint(c.Param("imageId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("album_id = ? AND image_id = ?", album.ID, imageID).Delete(&models.AlbumImage{}).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.Album{}).Where("id = ? AND cover_image_id = ?", album.ID, imageID).
+			Update("cover_image_id", nil).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "移除失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "移除成功"})
+}
+
+// ReorderAlbumImages 调整相册内图片顺序，未列出的图片排在后面
+func ReorderAlbumImages(c *gin.Context) {
+	album, ok := findAlbum(c)
+	if !ok {
+		return
+	}
+	if !requireStaticAlbum(c, album) {
+		return
+	}
+	var input AlbumImagesInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var current []uint
+		if err := tx.Model(&models.AlbumImage{}).Where("album_id = ?", album.ID).
+			Order("position, image_id").Pluck("image_id", &current).Error; err != nil {
+			return err
+		}
+		if len(current) == 0 {
+			return nil
+		}
+		scope := tx.Model(&models.AlbumImage{}).Where("album_id = ?", album.ID).Session(&gorm.Session{})
+		return updatePositions(scope, "image_id", reorderIDs(current, input.ImageIDs))
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "排序失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "排序成功"})
+}
+
+// findAlbum 按路径参数 id 查找当前用户的相册，找不到时直接写入 404
+func findAlbum(c *gin.Context) (*models.Album, bool) {
+	userID, _ := c.Get("userID")
+	var album models.Album
+	if err := database.DB.Where("id = ? AND user_id = ?", c.Param("id"), userID).First(&album).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "相册不存在"})
+		return nil, false
+	}
+	return &album, true
+}
+
+// SnapshotAlbum 将智能相册转换为静态相册，固定当前匹配的图片
+func SnapshotAlbum(c *gin.Context) {
+	album, ok := findAlbum(c)
+	if !ok {
+		return
+	}
+	if album.Kind != models.AlbumSmart {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "该相册不是智能相册"})
+		return
+	}
+	q, err := albumImagesQuery(album)
+	if err != nil {
+		writeQueryError(c, err)
+		return
+	}
+
+	var ids []uint
+	if err := q.Order("images.created_at DESC, images.id DESC").Pluck("images.id", &ids).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "转换失败"})
+		return
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		rows := make([]models.AlbumImage, 0, len(ids))
+		for pos, id := range ids {
+			rows = append(rows, models.AlbumImage{AlbumID: album.ID, ImageID: id, Position: pos})
+		}
+		if len(rows) > 0 {
+			if err := tx.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(&rows, 500).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Model(album).Updates(map[string]interface{}{"kind": models.AlbumStatic, "query": ""}).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "转换失败"})
+		return
+	}
+	database.DB.First(album, album.ID)
+	fillAlbumSummary(album)
+	c.JSON(http.StatusOK, gin.H{"message": "已转换为静态相册", "album": album})
+}
+
+// albumImagesQuery 返回相册成员的查询；智能相册按检索语句实时计算
+func albumImagesQuery(album *models.Album) (*gorm.DB, error) {
+	db := database.DB.Model(&models.Image{})
+	if album.Kind != models.AlbumSmart {
+		return db.Joins("JOIN album_images ON album_images.image_id = images.id").
+			Where("album_images.album_id = ?", album.ID), nil
+	}
+	sq, err := utils.ParseQuery(album.Query)
+	if err != nil {
+		return nil, err
+	}
+	return db.Where("images.user_id = ?", album.UserID).Where(sq.SQL, sq.Args...), nil
+}
+
+// requireStaticAlbum 智能相册的成员由检索语句决定，不能手动增删或排序
+func requireStaticAlbum(c *gin.Context, album *models.Album) bool {
+	if album.Kind == models.AlbumSmart {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "智能相册的图片由检索条件决定，请先转换为静态相册"})
+		return false
+	}
+	return true
+}
+
+// fillAlbumSummary 填充单个相册的图片数量和封面地址
+func fillAlbumSummary(album *models.Album) {
+	albums := []models.Album{*album}
+	if err := fillAlbumSummaries(albums); err == nil {
+		album.ImageCount, album.CoverUrl = albums[0].ImageCount, albums[0].CoverUrl
+	}
+}
+
+// albumSummary 相册的图片数量和默认封面
+type albumSummary struct {
+	AlbumID    uint
+	ImageCount int64
+	CoverUrl   string
+}
+
+// fillAlbumSummaries 批量填充相册的图片数量和封面地址，查询次数与相册数量无关：
+// 静态相册按 album_id 分组统计，智能相册的检索条件各不相同，合并为一条 UNION ALL 查询，
+// 指定了封面的相册再一次性查出封面图片
+func fillAlbumSummaries(albums []models.Album) error {
+	if len(albums) == 0 {
+		return nil
+	}
+	var staticIDs, coverIDs []uint
+	var smartParts []string
+	var smartArgs []interface{}
+	for i := range albums {
+		a := &albums[i]
+		if a.CoverImageID != nil {
+			coverIDs = append(coverIDs, *a.CoverImageID)
+		}
+		if a.Kind != models.AlbumSmart {
+			staticIDs = append(staticIDs, a.ID)
+			continue
+		}
+		count, err := albumImagesQuery(a)
+		if err != nil {
+			// 检索语句无效的智能相册没有图片
+			continue
+		}
+		cover, _ := albumImagesQuery(a)
+		cover = cover.Select("images.thumbnail_url").Order("images.created_at DESC, images.id DESC").Limit(1)
+		smartParts = append(smartParts, "(?)")
+		smartArgs = append(smartArgs, count.Select("? AS album_id, COUNT(*) AS image_count, (?) AS cover_url", a.ID, cover))
+	}
+
+	summaries := map[uint]albumSummary{}
+	if len(staticIDs) > 0 {
+		var rows []albumSummary
+		err := database.DB.Raw(`SELECT album_id, COUNT(*) AS image_count,
+			MAX(CASE WHEN rn = 1 THEN thumbnail_url END) AS cover_url
+			FROM (
+				SELECT album_images.album_id, images.thumbnail_url,
+					ROW_NUMBER() OVER (PARTITION BY album_images.album_id ORDER BY album_images.position, images.id) AS rn
+				FROM album_images JOIN images ON images.id = album_images.image_id AND images.deleted_at IS NULL
+				WHERE album_images.album_id IN ?
+			) ranked GROUP BY album_id`, staticIDs).Scan(&rows).Error
+		if err != nil {
+			return err
+		}
+		for _, r := range rows {
+			summaries[r.AlbumID] = r
+		}
+	}
+	if len(smartParts) > 0 {
+		var rows []albumSummary
+		if err := database.DB.Raw(strings.Join(smartParts, " UNION ALL "), smartArgs...).Scan(&rows).Error; err != nil {
+			return err
+		}
+		for _, r := range rows {
+			summaries[r.AlbumID] = r
+		}
+	}
+	covers := map[uint]string{}
+	if len(coverIDs) > 0 {
+		var images []models.Image
+		if err := database.DB.Select("id, thumbnail_url").Where("id IN ?", uniqueIDs(coverIDs)).Find(&images).Error; err != nil {
+			return err
+		}
+		for _, img := range images {
+			covers[img.ID] = img.ThumbnailUrl
+		}
+	}
+
+	for i := range albums {
+		a := &albums[i]
+		sum := summaries[a.ID]
+		a.ImageCount = sum.ImageCount
+		a.CoverUrl = sum.CoverUrl
+		if a.CoverImageID != nil {
+			if url, ok := covers[*a.CoverImageID]; ok {
+				a.CoverUrl = url
+			}
+		}
+	}
+	return nil
+}
+
+// positionChunk 每条 UPDATE 写入的位置数，每个位置占 3 个占位符，远低于 MySQL 单条语句 65535 个的上限
+const positionChunk = 1000
+
+// updatePositions 按 ids 的顺序写入从 0 开始的 position，每 positionChunk 个一条 UPDATE；
+// scope 限定要更新的记录，需可重复使用（Session）
+func updatePositions(scope *gorm.DB, column string, ids []uint) error {
+	for start := 0; start < len(ids); start += positionChunk {
+		chunk := ids[start:min(start+positionChunk, len(ids))]
+		err := scope.Where(column+" IN ?", chunk).Update("position", positionCase(column, chunk, start)).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// positionCase 生成 "CASE column WHEN id THEN 位置 ... END"，位置从 offset 开始
+func positionCase(column string, ids []uint, offset int) clause.Expr {
+	var sql strings.Builder
+	args := make([]interface{}, 0, len(ids)*2)
+	sql.WriteString("CASE " + column)
+	for i, id := range ids {
+		sql.WriteString(" WHEN ? THEN ?")
+		args = append(args, id, offset+i)
+	}
+	sql.WriteString(" END")
+	return gorm.Expr(sql.String(), args...)
+}
+
+// reorderIDs 把 wanted 中属于 current 的 ID 排在前面，其余保持原顺序
+func reorderIDs(current, wanted []uint) []uint {
+	exists := make(map[uint]bool, len(current))
+	for _, id := range current {
+		exists[id] = true
+	}
+	placed := make(map[uint]bool, len(current))
+	out := make([]uint, 0, len(current))
+	for _, id := range wanted {
+		if exists[id] && !placed[id] {
+			out = append(out, id)
+			placed[id] = true
+		}
+	}
+	for _, id := range current {
+		if !placed[id] {
+			out = append(out, id)
+		}
+	}
+	return out
+}
+
+func uniqueIDs(ids []uint) []uint {
+	seen := make(map[uint]bool, len(ids))
+	out := make([]uint, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			out = append(out, id)
+		}
+	}
+	return out
+}
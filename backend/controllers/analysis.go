@@ -0,0 +1,195 @@
+package controllers
+
+import (
+	"net/http"
+	"smart-gallery-backend/database"
+	"smart-gallery-backend/models"
+	"smart-gallery-backend/utils"
+	"smart-gallery-backend/workers"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// maxBatchImages 单个批量重新分析任务最多包含的图片数
+const maxBatchImages = 10000
+
+// CreateBatchInput 批量重新分析：按图片 ID 或检索语句选择图片，二者只能提供一个
+type CreateBatchInput struct {
+	ImageIDs []uint `json:"image_ids"`
+	Query    string `json:"query"`
+}
+
+// batchProgress 批量任务及各状态的任务数；failed 为超过重试次数的任务
+type batchProgress struct {
+	models.AnalysisBatch
+	Pending  int64 `json:"pending"`
+	Running  int64 `json:"running"`
+	Done     int64 `json:"done"`
+	Failed   int64 `json:"failed"`
+	Finished bool  `json:"finished"`
+}
+
+// AnalyzeImage 重新分析单张图片：替换 AI 和 EXIF 标签，保留用户标签
+func AnalyzeImage(c *gin.Context) {
+	if !analysisEnabled(c) {
+		return
+	}
+	image, ok := findImage(c)
+	if !ok {
+		return
+	}
+	var job models.AnalysisJob
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		queued, err := workers.EnqueueReanalysis(tx, []uint{image.ID}, nil)
+		if err != nil || queued == 0 {
+			return err
+		}
+		return tx.Where("image_id = ?", image.ID).Order("id DESC").First(&job).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "加入分析队列失败"})
+		return
+	}
+	if job.ID == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "图片正在分析中"})
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"message": "已加入分析队列", "job": job})
+}
+
+// analysisEnabled 未配置视觉模型时返回 503，重新分析请求不会被处理
+func analysisEnabled(c *gin.Context) bool {
+	if utils.Vision == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "AI 分析未启用"})
+		return false
+	}
+	return true
+}
+
+// CreateAnalysisBatch 批量重新分析当前用户的图片，返回批量任务 ID 供查询进度
+func CreateAnalysisBatch(c *gin.Context) {
+	if !analysisEnabled(c) {
+		return
+	}
+	userID, _ := c.Get("userID")
+	var input CreateBatchInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+	input.Query = strings.TrimSpace(input.Query)
+	if (len(input.ImageIDs) == 0) == (input.Query == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请提供 image_ids 或 query 其中之一"})
+		return
+	}
+
+	var ids []uint
+	db := database.DB.Model(&models.Image{}).Where("images.user_id = ?", userID)
+	if len(input.ImageIDs) > 0 {
+		if len(input.ImageIDs) > maxBatchImages {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "单次最多重新分析 " + strconv.Itoa(maxBatchImages) + " 张图片"})
+			return
+		}
+		db = db.Where("images.id IN ?", uniqueIDs(input.ImageIDs))
+	} else {
+		var ok bool
+		if db, ok = applyQueryString(c, db, input.Query); !ok {
+			return
+		}
+	}
+	if err := db.Order("images.id").Limit(maxBatchImages+1).Pluck("images.id", &ids).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取图片失败"})
+		return
+	}
+	if len(ids) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "没有符合条件的图片"})
+		return
+	}
+	if len(ids) > maxBatchImages {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "单次最多重新分析 " + strconv.Itoa(maxBatchImages) + " 张图片，请缩小范围"})
+		return
+	}
+
+	batch := models.AnalysisBatch{UserID: userID.(uint), Query: input.Query, Total: len(ids)}
+	var queued int
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&batch).Error; err != nil {
+			return err
+		}
+		var err error
+		queued, err = workers.EnqueueReanalysis(tx, ids, &batch.ID)
+		return err
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建批量任务失败"})
+		return
+	}
+	// 已在队列中的图片不重复排队，但计入该批次的进度
+	c.JSON(http.StatusAccepted, gin.H{"message": "已加入分析队列", "batch": batch, "queued": queued})
+}
+
+// GetAnalysisBatches 列出当前用户的批量任务及进度，最新的在前
+func GetAnalysisBatches(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	var batches []models.AnalysisBatch
+	if err := database.DB.Where("user_id = ?", userID).Order("id DESC").Limit(50).Find(&batches).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取批量任务失败"})
+		return
+	}
+	out := make([]batchProgress, 0, len(batches))
+	for _, b := range batches {
+		p, err := loadBatchProgress(b)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "获取批量任务失败"})
+			return
+		}
+		out = append(out, p)
+	}
+	c.JSON(http.StatusOK, gin.H{"data": out})
+}
+
+// GetAnalysisBatch 查询批量任务进度
+func GetAnalysisBatch(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	var batch models.AnalysisBatch
+	if err := database.DB.Where("id = ? AND user_id = ?", c.Param("id"), userID).First(&batch).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "批量任务不存在"})
+		return
+	}
+	p, err := loadBatchProgress(batch)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取批量任务失败"})
+		return
+	}
+	c.JSON(http.StatusOK, p)
+}
+
+// loadBatchProgress 按状态统计批次下的任务数；图片被删除后其任务仍计入统计
+func loadBatchProgress(batch models.AnalysisBatch) (batchProgress, error) {
+	var rows []struct {
+		Status string
+		Count  int64
+	}
+	err := database.DB.Model(&models.AnalysisJob{}).
+		Select("status, COUNT(*) AS count").
+		Where("batch_id = ?", batch.ID).
+		Group("status").Scan(&rows).Error
+	p := batchProgress{AnalysisBatch: batch}
+	for _, r := range rows {
+		switch r.Status {
+		case models.JobPending:
+			p.Pending = r.Count
+		case models.JobRunning:
+			p.Running = r.Count
+		case models.JobDone:
+			p.Done = r.Count
+		case models.JobDead:
+			p.Failed = r.Count
+		}
+	}
+	p.Finished = p.Pending == 0 && p.Running == 0
+	return p, err
+}
@@ -0,0 +1,38 @@
+package controllers
+
+import (
+	"net/http"
+	"smart-gallery-backend/database"
+	"smart-gallery-backend/models"
+	"smart-gallery-backend/utils"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// colorSearch 按颜色检索的匹配条件
+var colorSearch = utils.ColorSearchConfigFromEnv()
+
+// applyColorFilter 解析 color 参数，只保留主色调与之相近的图片，
+// 并通过 color_match.color_distance 提供按色差排序所需的列
+func applyColorFilter(c *gin.Context, db *gorm.DB) (*gorm.DB, bool) {
+	raw := strings.TrimSpace(c.Query("color"))
+	if raw == "" {
+		return db, true
+	}
+	r, g, b, err := utils.ParseColor(raw)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	l, a, bb := utils.RGBToLab(r, g, b)
+
+	// 每张图片取占比足够的主色调中与目标颜色最接近的一种
+	match := database.DB.Model(&models.ImageColor{}).
+		Select("image_id, MIN(SQRT(POW(l - ?, 2) + POW(a - ?, 2) + POW(b - ?, 2))) AS color_distance", l, a, bb).
+		Where("ratio >= ?", colorSearch.MinRatio).
+		Group("image_id").
+		Having("color_distance <= ?", colorSearch.MaxDistance)
+	return db.Joins("JOIN (?) AS color_match ON color_match.image_id = images.id", match), true
+}
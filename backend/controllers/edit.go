@@ -0,0 +1,241 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"image"
+	"log"
+	"net/http"
+	"smart-gallery-backend/database"
+	"smart-gallery-backend/models"
+	"smart-gallery-backend/utils"
+	"smart-gallery-backend/workers"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// editQuality 编辑结果的 JPEG 质量
+const editQuality = 92
+
+// EditInput 保存编辑时提交的完整操作列表，总是作用于原图
+type EditInput struct {
+	Operations json.RawMessage `json:"operations"`
+}
+
+// RevertInput 恢复到指定版本，0 表示原图
+type RevertInput struct {
+	Version *int `json:"version"`
+}
+
+// GetImageEdits 返回图片的当前版本和全部编辑历史
+func GetImageEdits(c *gin.Context) {
+	image, ok := findImage(c)
+	if !ok {
+		return
+	}
+	var edits []models.ImageEdit
+	if err := database.DB.Where("image_id = ?", image.ID).Order("version").Find(&edits).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取编辑历史失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"current_version": image.EditVersion,
+		"operations":      editOpsOrEmpty(image.EditOps),
+		"data":            edits,
+	})
+}
+
+// CreateImageEdit 按操作列表渲染原图并保存为新版本，原图对象保持不变
+func CreateImageEdit(c *gin.Context) {
+	image, ok := findImage(c)
+	if !ok {
+		return
+	}
+	var input EditInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+	ops, err := utils.ParseEditOps(input.Operations)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(ops) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "操作列表为空，恢复原图请使用 revert"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	decoded, err := workers.DecodeOriginal(ctx, image, uploadLimits)
+	if err != nil {
+		log.Printf("图片 %d 解码失败: %v", image.ID, err)
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "无法处理该图片"})
+		return
+	}
+	edited, err := utils.ApplyEdits(decoded, ops, uploadLimits.MaxPixels)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 规范化后再保存，去掉客户端提交的多余字段
+	normalized, _ := json.Marshal(ops)
+	edit, err := reserveEditVersion(image.ID, normalized)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存失败"})
+		return
+	}
+	if err := storeEditVersion(ctx, edit, edited); err != nil {
+		log.Printf("图片 %d 编辑结果上传失败: %v", image.ID, err)
+		database.DB.Delete(edit)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存失败"})
+		return
+	}
+	if err := switchEditVersion(image, edit); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存失败"})
+		return
+	}
+	setSrcset(image)
+	c.JSON(http.StatusOK, gin.H{"message": "保存成功", "image": image, "edit": edit})
+}
+
+// RevertImageEdit 将图片切换回原图或某个历史版本，历史记录保持不变
+func RevertImageEdit(c *gin.Context) {
+	image, ok := findImage(c)
+	if !ok {
+		return
+	}
+	var input RevertInput
+	if err := c.ShouldBindJSON(&input); err != nil || input.Version == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请指定要恢复的版本"})
+		return
+	}
+
+	var edit *models.ImageEdit
+	if *input.Version != 0 {
+		edit = &models.ImageEdit{}
+		err := database.DB.Where("image_id = ? AND version = ?", image.ID, *input.Version).First(edit).Error
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "版本不存在"})
+			return
+		}
+	}
+	if err := switchEditVersion(image, edit); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "恢复失败"})
+		return
+	}
+	setSrcset(image)
+	c.JSON(http.StatusOK, gin.H{"message": "恢复成功", "image": image})
+}
+
+// findImage 读取当前用户的图片，不存在时直接返回 404
+func findImage(c *gin.Context) (*models.Image, bool) {
+	userID, _ := c.Get("userID")
+	var image models.Image
+	if err := database.DB.Where("id = ? AND user_id = ?", c.Param("id"), userID).First(&image).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "图片不存在"})
+		return nil, false
+	}
+	return &image, true
+}
+
+// reserveEditVersion 锁定图片记录分配下一个版本号，避免并发编辑写入同一目录
+func reserveEditVersion(imageID uint, ops json.RawMessage) (*models.ImageEdit, error) {
+	edit := &models.ImageEdit{ImageID: imageID, Operations: ops}
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&models.Image{}, imageID).Error; err != nil {
+			return err
+		}
+		var last int
+		if err := tx.Model(&models.ImageEdit{}).Where("image_id = ?", imageID).
+			Select("COALESCE(MAX(version), 0)").Scan(&last).Error; err != nil {
+			return err
+		}
+		edit.Version = last + 1
+		return tx.Create(edit).Error
+	})
+	return edit, err
+}
+
+// storeEditVersion 上传编辑结果和缩略图，并写回版本记录
+func storeEditVersion(ctx context.Context, edit *models.ImageEdit, edited image.Image) error {
+	prefix := workers.EditKeyPrefix(edit.ImageID, edit.Version)
+	data, err := utils.EncodeJPEG(edited, edited.Bounds().Dx(), editQuality)
+	if err != nil {
+		return err
+	}
+	edit.Key = prefix + "edited.jpg"
+	if edit.Url, err = utils.Store.Put(ctx, edit.Key, bytes.NewReader(data), int64(len(data)), "image/jpeg"); err != nil {
+		return err
+	}
+	thumb, err := utils.EncodeJPEG(edited, 400, 80)
+	if err != nil {
+		return err
+	}
+	if edit.ThumbnailUrl, err = utils.Store.Put(ctx, prefix+"thumb.jpg", bytes.NewReader(thumb), int64(len(thumb)), "image/jpeg"); err != nil {
+		return err
+	}
+	edit.Width, edit.Height = edited.Bounds().Dx(), edited.Bounds().Dy()
+	return database.DB.Save(edit).Error
+}
+
+// switchEditVersion 将图片的当前版本切换为 edit（nil 表示原图）。旧版本的派生图记录立即清除，
+// 恢复原图时复用同内容图片已有的派生图，否则交给后台 worker 生成，生成前客户端使用该版本的缩略图和原图。
+func switchEditVersion(img *models.Image, edit *models.ImageEdit) error {
+	img.EditVersion, img.EditOps, img.EditedUrl, img.EditedThumbnailUrl = 0, nil, "", ""
+	if edit != nil {
+		img.EditVersion, img.EditOps, img.EditedUrl, img.EditedThumbnailUrl = edit.Version, edit.Operations, edit.Url, edit.ThumbnailUrl
+	}
+
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(img).Select("EditVersion", "EditOps", "EditedUrl", "EditedThumbnailUrl").Updates(img).Error
+		if err != nil {
+			return err
+		}
+		var renditions []models.ImageRendition
+		if img.EditVersion == 0 && img.ContentHash != "" {
+			err := tx.Where("image_id = (?)",
+				tx.Model(&models.ImageRendition{}).Select("image_renditions.image_id").
+					Joins("JOIN images ON images.id = image_renditions.image_id AND images.deleted_at IS NULL").
+					Where("images.content_hash = ? AND images.edit_version = 0 AND images.id <> ?", img.ContentHash, img.ID).
+					Limit(1),
+			).Find(&renditions).Error
+			if err != nil {
+				return err
+			}
+		}
+		if err := database.ReplaceImageRenditions(tx, img.ID, renditions); err != nil {
+			return err
+		}
+		if len(renditions) == 0 {
+			if err := workers.EnqueueRenditions(tx, img.ID, img.EditVersion); err != nil {
+				return err
+			}
+		}
+		return tx.Where("image_id = ?", img.ID).Find(&img.Renditions).Error
+	})
+}
+
+// deleteImageEdits 删除图片所有编辑版本的对象
+func deleteImageEdits(ctx context.Context, imageID uint) {
+	prefix := workers.EditsKeyPrefix(imageID)
+	objects, err := utils.Store.List(ctx, prefix)
+	if err != nil {
+		log.Printf("列出对象失败 (%s): %v", prefix, err)
+		return
+	}
+	for _, obj := range objects {
+		utils.Store.Delete(ctx, obj.Key)
+	}
+}
+
+func editOpsOrEmpty(ops json.RawMessage) json.RawMessage {
+	if len(ops) == 0 {
+		return json.RawMessage("[]")
+	}
+	return ops
+}
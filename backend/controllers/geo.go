@@ -0,0 +1,248 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"smart-gallery-backend/database"
+	"smart-gallery-backend/models"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	geoMaxPoints      = 2000 // 最多返回的照片数或聚合点数
+	geoClusterMaxZoom = 17   // 达到该缩放级别后不再聚合，直接返回照片
+	geoCellsPerTile   = 4    // 每个 256px 瓦片横向划分的网格数，约 64px 一格
+)
+
+// geoFeature GeoJSON Feature，几何类型固定为 Point
+type geoFeature struct {
+	Type       string                 `json:"type"`
+	Geometry   geoPoint               `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+type geoPoint struct {
+	Type        string    `json:"type"`
+	Coordinates []float64 `json:"coordinates"` // [经度, 纬度] 或 [经度, 纬度, 海拔]
+}
+
+// geoCluster 同一网格内照片的聚合结果
+type geoCluster struct {
+	Count   int64
+	Lat     float64
+	Lon     float64
+	MinLat  float64
+	MinLon  float64
+	MaxLat  float64
+	MaxLon  float64
+	ImageID uint // 网格内最新上传的照片，用作聚合点的缩略图
+}
+
+// GetImagesGeo 以 GeoJSON FeatureCollection 返回当前用户带定位的照片。
+// bbox=minLon,minLat,maxLon,maxLat 限定范围；提供 zoom 时按网格聚合。
+func GetImagesGeo(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	db := database.DB.Model(&models.Image{}).
+		Where("images.user_id = ? AND images.latitude IS NOT NULL AND images.longitude IS NOT NULL", userID)
+
+	if raw := c.Query("bbox"); raw != "" {
+		var err error
+		if db, err = applyBBox(db, raw); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	db, ok := applySearchQuery(c, db)
+	if !ok {
+		return
+	}
+
+	zoom := geoClusterMaxZoom
+	if raw := c.Query("zoom"); raw != "" {
+		z, err := strconv.Atoi(raw)
+		if err != nil || z < 0 || z > 24 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "zoom 必须是 0-24 的整数"})
+			return
+		}
+		zoom = z
+	}
+
+	if zoom < geoClusterMaxZoom {
+		features, truncated, err := clusterFeatures(db, zoom)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "获取地图数据失败"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"type": "FeatureCollection", "features": features, "truncated": truncated})
+		return
+	}
+
+	var images []models.Image
+	err := db.Select("images.id, images.file_name, images.thumbnail_url, images.shooting_time, images.latitude, images.longitude, images.altitude").
+		Order("images.id DESC").Limit(geoMaxPoints + 1).Find(&images).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取地图数据失败"})
+		return
+	}
+	truncated := len(images) > geoMaxPoints
+	if truncated {
+		images = images[:geoMaxPoints]
+	}
+	features := make([]geoFeature, 0, len(images))
+	for i := range images {
+		features = append(features, imageFeature(&images[i]))
+	}
+	c.JSON(http.StatusOK, gin.H{"type": "FeatureCollection", "features": features, "truncated": truncated})
+}
+
+// clusterFeatures 按缩放级别对应的经纬度网格聚合照片；网格数超过 geoMaxPoints 时
+// 只返回照片最多的网格，truncated 为 true，客户端应缩小范围
+func clusterFeatures(db *gorm.DB, zoom int) ([]geoFeature, bool, error) {
+	cell := 360 / math.Pow(2, float64(zoom)) / geoCellsPerTile
+
+	var clusters []geoCluster
+	err := db.Select(`COUNT(*) AS count, AVG(images.latitude) AS lat, AVG(images.longitude) AS lon,
+		MIN(images.latitude) AS min_lat, MIN(images.longitude) AS min_lon,
+		MAX(images.latitude) AS max_lat, MAX(images.longitude) AS max_lon,
+		MAX(images.id) AS image_id`).
+		Group("FLOOR(images.longitude / " + strconv.FormatFloat(cell, 'g', -1, 64) + ")").
+		Group("FLOOR(images.latitude / " + strconv.FormatFloat(cell, 'g', -1, 64) + ")").
+		Order("count DESC").Limit(geoMaxPoints + 1).
+		Scan(&clusters).Error
+	if err != nil {
+		return nil, false, err
+	}
+	truncated := len(clusters) > geoMaxPoints
+	if truncated {
+		clusters = clusters[:geoMaxPoints]
+	}
+
+	ids := make([]uint, len(clusters))
+	for i, cl := range clusters {
+		ids[i] = cl.ImageID
+	}
+	var images []models.Image
+	if len(ids) > 0 {
+		if err := database.DB.Select("id, file_name, thumbnail_url, shooting_time, latitude, longitude, altitude").
+			Where("id IN ?", ids).Find(&images).Error; err != nil {
+			return nil, false, err
+		}
+	}
+	byID := make(map[uint]*models.Image, len(images))
+	for i := range images {
+		byID[images[i].ID] = &images[i]
+	}
+
+	features := make([]geoFeature, 0, len(clusters))
+	for _, cl := range clusters {
+		img := byID[cl.ImageID]
+		if img == nil {
+			continue
+		}
+		// 只有一张照片的网格直接返回该照片
+		if cl.Count == 1 {
+			features = append(features, imageFeature(img))
+			continue
+		}
+		features = append(features, geoFeature{
+			Type:     "Feature",
+			Geometry: geoPoint{Type: "Point", Coordinates: []float64{cl.Lon, cl.Lat}},
+			Properties: map[string]interface{}{
+				"cluster":       true,
+				"point_count":   cl.Count,
+				"image_id":      img.ID,
+				"thumbnail_url": img.ThumbnailUrl,
+				"bbox":          []float64{cl.MinLon, cl.MinLat, cl.MaxLon, cl.MaxLat},
+			},
+		})
+	}
+	return features, truncated, nil
+}
+
+func imageFeature(img *models.Image) geoFeature {
+	coords := []float64{*img.Longitude, *img.Latitude}
+	if img.Altitude != nil {
+		coords = append(coords, *img.Altitude)
+	}
+	return geoFeature{
+		Type:     "Feature",
+		Geometry: geoPoint{Type: "Point", Coordinates: coords},
+		Properties: map[string]interface{}{
+			"cluster":       false,
+			"image_id":      img.ID,
+			"file_name":     img.FileName,
+			"thumbnail_url": img.ThumbnailUrl,
+			"shooting_time": img.ShootingTime,
+		},
+	}
+}
+
+// applyBBox 解析 minLon,minLat,maxLon,maxLat 并加入过滤条件；minLon > maxLon 表示跨越 180° 经线
+func applyBBox(db *gorm.DB, raw string) (*gorm.DB, error) {
+	parts := strings.Split(raw, ",")
+	if len(parts) != 4 {
+		return nil, errors.New("bbox 格式应为 minLon,minLat,maxLon,maxLat")
+	}
+	var v [4]float64
+	for i, p := range parts {
+		f, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if err != nil {
+			return nil, errors.New("bbox 格式应为 minLon,minLat,maxLon,maxLat")
+		}
+		v[i] = f
+	}
+	minLon, minLat, maxLon, maxLat := v[0], v[1], v[2], v[3]
+	if minLat < -90 || maxLat > 90 || minLat > maxLat || minLon < -180 || maxLon > 180 {
+		return nil, errors.New("bbox 超出经纬度范围")
+	}
+	if minLat == maxLat || minLon == maxLon {
+		return nil, errors.New("bbox 范围为空")
+	}
+
+	// location 列上的空间索引先按范围筛选，经纬度条件再精确过滤：
+	// SRID 4326 下多边形的边是测地线，与等纬线并不重合
+	var ranges [][2]float64
+	if minLon <= maxLon {
+		ranges = lonRanges(minLon, maxLon)
+	} else {
+		ranges = append(lonRanges(minLon, 180), lonRanges(-180, maxLon)...)
+	}
+	if len(ranges) == 0 {
+		return nil, errors.New("bbox 范围为空")
+	}
+	conds := make([]string, len(ranges))
+	args := make([]interface{}, len(ranges))
+	for i, r := range ranges {
+		conds[i] = "MBRContains(ST_GeomFromText(?, 4326, 'axis-order=long-lat'), images.location)"
+		args[i] = fmt.Sprintf("POLYGON((%[1]g %[3]g, %[2]g %[3]g, %[2]g %[4]g, %[1]g %[4]g, %[1]g %[3]g))", r[0], r[1], minLat, maxLat)
+	}
+	db = db.Where("("+strings.Join(conds, " OR ")+")", args...)
+
+	db = db.Where("images.latitude BETWEEN ? AND ?", minLat, maxLat)
+	if minLon <= maxLon {
+		return db.Where("images.longitude BETWEEN ? AND ?", minLon, maxLon), nil
+	}
+	return db.Where("(images.longitude >= ? OR images.longitude <= ?)", minLon, maxLon), nil
+}
+
+// lonRanges 把经度区间切成不超过 90° 的几段，避免测地线多边形在跨度过大时含义不明确
+func lonRanges(minLon, maxLon float64) [][2]float64 {
+	var out [][2]float64
+	if minLon >= maxLon {
+		return nil
+	}
+	for lo := minLon; ; lo += 90 {
+		hi := min(lo+90, maxLon)
+		out = append(out, [2]float64{lo, hi})
+		if hi >= maxLon {
+			return out
+		}
+	}
+}
@@ -2,108 +2,403 @@ package controllers
 
 import (
 	"bytes"
-	"image"
-	"image/jpeg"
-	"io"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"mime/multipart"
 	"net/http"
-	"path"
 	"path/filepath"
 	"smart-gallery-backend/database"
 	"smart-gallery-backend/models"
 	"smart-gallery-backend/utils"
+	"smart-gallery-backend/workers"
+	"strconv"
+	"strings"
+	"unicode/utf8"
 
-	"github.com/disintegration/imaging"
 	"github.com/gin-gonic/gin"
-	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// uploadLimits 上传请求的内存与大小限制
+var uploadLimits = utils.UploadLimitsFromEnv()
+
 // UploadImage 处理图片上传
+// 上传内容以流的方式读取并暂存（小文件在内存，大文件落盘），
+// 原图只向存储写入一次，EXIF、缩略图等都从暂存区读取。
 func UploadImage(c *gin.Context) {
 	userID, _ := c.Get("userID")
 
-	fileHeader, err := c.FormFile("file")
+	// multipart 头部额外预留 1MB
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, uploadLimits.MaxSize+1<<20)
+	part, err := findFilePart(c.Request, "file")
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "请上传文件"})
 		return
 	}
+	fileName := part.FileName()
+	contentType := part.Header.Get("Content-Type")
 
-	src, err := fileHeader.Open()
+	spool, err := utils.SpoolUpload(part, uploadLimits)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "无法读取文件"})
+		var maxErr *http.MaxBytesError
+		if errors.Is(err, utils.ErrUploadTooLarge) || errors.As(err, &maxErr) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "文件过大"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "文件读取失败"})
 		return
 	}
-	defer src.Close()
+	defer spool.Close()
+
+	uid := userID.(uint)
+	hash := spool.SHA256()
+
+	// 同一用户重复上传：直接返回已有记录
+	var existing models.Image
+	if err := database.DB.Where("user_id = ? AND content_hash = ?", uid, hash).First(&existing).Error; err == nil {
+		c.JSON(http.StatusOK, gin.H{
+			"message":   "图片已存在",
+			"image":     existing,
+			"duplicate": true,
+		})
+		return
+	}
+
+	imageModel := models.Image{
+		UserID:      uid,
+		FileName:    fileName,
+		ContentHash: hash,
+		DedupHash:   &hash,
+	}
 
-	// 读取文件内容
-	fileBytes, err := io.ReadAll(src)
+	// 原图上传、解码和缩略图都在事务外完成，写入本次上传独有的对象名；
+	// 之后只在 Blob 行锁内短暂认领或增加引用，与同内容的上传和删除串行执行
+	ctx := c.Request.Context()
+	var siblingID uint
+	var staged *stagedBlob
+	claimed, duplicate := false, false
+	for attempt := 0; ; attempt++ {
+		// 其他用户上传过相同内容时直接共享，不必再上传
+		var shared int64
+		if err = database.DB.Model(&models.Blob{}).Where("hash = ? AND ref_count > 0", hash).Count(&shared).Error; err != nil {
+			break
+		}
+		if shared == 0 && staged == nil {
+			if staged, err = stageNewBlob(ctx, spool, hash, fileName, contentType); err != nil {
+				break
+			}
+		}
+		err = database.DB.Transaction(func(tx *gorm.DB) error {
+			blob, err := lockBlob(tx, hash)
+			if err != nil {
+				return err
+			}
+			// 持锁后再检查一次，同一用户并发上传相同内容时只保留一条记录
+			if err := tx.Where("user_id = ? AND content_hash = ?", uid, hash).Limit(1).Find(&existing).Error; err != nil {
+				return err
+			}
+			if existing.ID != 0 {
+				duplicate = true
+				return nil
+			}
+			if blob.RefCount > 0 {
+				// 共享对象并复用分析结果，本次暂存的对象随后删除
+				siblingID, err = attachSharedBlob(tx, &imageModel)
+				return err
+			}
+			if staged == nil {
+				return errBlobStagingLost
+			}
+			// 删除最后一个引用时会持锁清空内容目录，暂存的对象可能已被一并删除
+			if _, err := utils.Store.Stat(ctx, staged.blob.OriginalKey); err != nil {
+				return errBlobStagingLost
+			}
+			claimed = true
+			return claimNewBlob(tx, blob, staged, &imageModel)
+		})
+		if !errors.Is(err, errBlobStagingLost) || attempt > 0 {
+			break
+		}
+		if staged != nil {
+			staged.remove(ctx)
+			staged = nil
+		}
+	}
+	if staged != nil && (!claimed || err != nil) {
+		staged.remove(ctx)
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "文件读取失败"})
+		log.Printf("图片保存失败 (%s): %v", fileName, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "图片保存失败"})
+		return
+	}
+	if duplicate {
+		c.JSON(http.StatusOK, gin.H{
+			"message":   "图片已存在",
+			"image":     existing,
+			"duplicate": true,
+		})
 		return
 	}
+	// 已分析完成时直接复用同内容图片的向量，否则由分析任务生成
+	if siblingID != 0 && imageModel.AnalysisStatus == models.AnalysisDone {
+		if err := workers.CopyEmbedding(context.Background(), siblingID, imageModel.ID); err != nil {
+			log.Printf("图片 %d 复制向量失败: %v", imageModel.ID, err)
+		}
+	}
 
-	// AI分析图片
-	aiTags := utils.AnalyzeImage(fileBytes)
+	setSrcset(&imageModel)
+	c.JSON(http.StatusOK, gin.H{
+		"message":   "上传成功",
+		"image":     imageModel,
+		"duplicate": false,
+	})
+}
 
-	// 提取EXIF信息
-	exifData := utils.ExtractExif(fileBytes)
+// lockBlob 锁定内容哈希对应的 Blob 行，行不存在时先插入引用计数为 0 的占位行再锁定
+func lockBlob(tx *gorm.DB, hash string) (*models.Blob, error) {
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.Blob{Hash: hash}).Error; err != nil {
+		return nil, err
+	}
+	var blob models.Blob
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&blob, "hash = ?", hash).Error; err != nil {
+		return nil, err
+	}
+	return &blob, nil
+}
 
-	// 基于EXIF生成检索标签
-	exifTags := utils.ExifTagsFromData(exifData)
-	mergedTags := utils.MergeTags(aiTags, exifTags)
+// attachSharedBlob 让新图片引用已存在的 Blob，复制已有图片的分析结果并保存记录，返回被复制的图片 ID；
+// 已有图片尚未分析完成时为新图片单独排队分析。调用方需持有 Blob 行锁且引用计数大于 0。
+func attachSharedBlob(tx *gorm.DB, img *models.Image) (uint, error) {
+	var sibling models.Image
+	if err := tx.Where("content_hash = ?", img.ContentHash).Order("id").First(&sibling).Error; err != nil {
+		return 0, err
+	}
 
-	// 生成文件名
-	ext := filepath.Ext(fileHeader.Filename)
-	uniqueId := uuid.New().String()
-	originalFileName := uniqueId + ext
-	thumbnailFileName := "thumb-" + uniqueId + ".jpg"
+	// 只继承机器生成的标签，不继承其他用户手动添加的标签
+	siblingTags, err := database.ImageTagEntries(tx, sibling.ID)
+	if err != nil {
+		return 0, err
+	}
+	var entries []models.TagEntry
+	for _, e := range siblingTags {
+		if e.Source != models.TagSourceUser {
+			entries = append(entries, e)
+		}
+	}
+	// 待确认的建议同样来自模型，已被其他用户处理过的不继承
+	var suggestions []models.TagSuggestion
+	if err := tx.Where("image_id = ? AND status = ?", sibling.ID, models.SuggestionPending).Find(&suggestions).Error; err != nil {
+		return 0, err
+	}
+	labels := make([]utils.LabelResult, len(suggestions))
+	for i, sg := range suggestions {
+		labels[i] = utils.LabelResult{Label: sg.Name, Confidence: sg.Confidence}
+	}
 
-	// 上传原图
-	originalUrl, err := utils.UploadFile(fileHeader, originalFileName)
+	// 派生图取自未编辑过的同内容图片；尚未生成时由该内容的派生图任务完成后一并写入
+	var renditions []models.ImageRendition
+	err = tx.Where("image_id = (?)",
+		tx.Model(&models.Image{}).Select("id").
+			Where("content_hash = ? AND edit_version = 0", img.ContentHash).Order("id").Limit(1),
+	).Find(&renditions).Error
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "原图上传失败"})
-		return
+		return 0, err
 	}
 
-	// 生成缩略图
-	var thumbnailUrl string
+	img.Url = sibling.Url
+	img.ThumbnailUrl = sibling.ThumbnailUrl
+	img.Renditions = database.CopyRenditions(renditions)
+	img.PHash = sibling.PHash
+	// 描述是机器生成的才继承，其他用户改写过的描述不继承
+	if !sibling.CaptionEdited {
+		img.Description = sibling.Description
+		img.AltText = sibling.AltText
+	}
+
+	var colors []models.ImageColor
+	if err := tx.Where("image_id = ?", sibling.ID).Order("position").Find(&colors).Error; err != nil {
+		return 0, err
+	}
+	for i := range colors {
+		colors[i].ImageID = 0
+	}
+	img.Colors = colors
+	img.Palette = database.PaletteString(colors)
+	database.ApplyExif(img, database.ExifFromImage(&sibling))
+	img.AnalysisStatus = sibling.AnalysisStatus
+	if img.AnalysisStatus != models.AnalysisDone {
+		img.AnalysisStatus = models.AnalysisPending
+	}
 
-	img, _, err := image.Decode(bytes.NewReader(fileBytes))
+	if err := tx.Model(&models.Blob{}).Where("hash = ?", img.ContentHash).
+		Update("ref_count", gorm.Expr("ref_count + 1")).Error; err != nil {
+		return 0, err
+	}
+	if err := tx.Create(img).Error; err != nil {
+		return 0, err
+	}
+	if err := database.ReplaceImageTags(tx, img.ID, entries); err != nil {
+		return 0, err
+	}
+	if err := database.ReplaceTagSuggestions(tx, img.ID, labels); err != nil {
+		return 0, err
+	}
+	if err := tx.First(img, img.ID).Error; err != nil {
+		return 0, err
+	}
+	if img.AnalysisStatus == models.AnalysisPending {
+		if err := workers.EnqueueAnalysis(tx, img.ID); err != nil {
+			return 0, err
+		}
+	}
+	return sibling.ID, nil
+}
+
+// errBlobStagingLost 认领 Blob 时发现暂存的对象已不存在（同内容的最后一个引用刚被删除），需要重新上传
+var errBlobStagingLost = errors.New("暂存的对象已被删除")
+
+// stagedBlob 在事务外上传和处理完成、尚未认领的新内容
+type stagedBlob struct {
+	blob         models.Blob
+	url          string
+	thumbnailUrl string
+	exif         utils.ExifData
+	phash        *uint64
+	colors       []models.ImageColor
+	decoded      bool
+}
+
+// stageNewBlob 上传原图和缩略图并提取 EXIF、感知哈希和主色调，不访问数据库。
+// 对象名带随机后缀，并发上传同一内容时互不覆盖，未被认领的一方删除自己的对象
+func stageNewBlob(ctx context.Context, spool *utils.SpooledFile, hash, fileName, contentType string) (*stagedBlob, error) {
+	var token [8]byte
+	if _, err := rand.Read(token[:]); err != nil {
+		return nil, err
+	}
+	suffix := hex.EncodeToString(token[:])
+	st := &stagedBlob{blob: models.Blob{
+		Hash:         hash,
+		OriginalKey:  utils.BlobKey(hash, "original-"+suffix+strings.ToLower(filepath.Ext(fileName))),
+		ThumbnailKey: utils.BlobKey(hash, "thumb-"+suffix+".jpg"),
+		Size:         spool.Size(),
+		ContentType:  contentType,
+	}}
+
+	// 提取EXIF信息（JPEG 只需要文件头，HEIF/WebP 按容器结构读取）
+	st.exif = utils.ExtractExifFromReader(spool.NewReader(), spool.Size(), spool.Head())
+
+	// 上传原图
+	var err error
+	if st.url, err = utils.Store.Put(ctx, st.blob.OriginalKey, spool.NewReader(), spool.Size(), contentType); err != nil {
+		return nil, err
+	}
+
+	// 生成缩略图
+	decoded, err := utils.DecodeImage(spool.NewReader(), uploadLimits.MaxPixels)
 	if err == nil {
-		thumbImg := imaging.Resize(img, 400, 0, imaging.Lanczos)
-		buf := new(bytes.Buffer)
-		err = jpeg.Encode(buf, thumbImg, &jpeg.Options{Quality: 80})
-		if err == nil {
-			thumbnailUrl, _ = utils.UploadBuffer(buf.Bytes(), thumbnailFileName, "image/jpeg")
+		st.decoded = true
+		decoded = utils.ApplyOrientation(decoded, st.exif.Orientation)
+		phash := utils.DHash(decoded)
+		st.phash = &phash
+		st.colors = database.ImageColorsFromPalette(utils.ExtractPalette(decoded, utils.PaletteSize))
+		// 文件头过大导致 EXIF 嗅探拿不到尺寸时，以解码结果为准
+		if st.exif.Resolution == "未知" {
+			st.exif.Resolution = fmt.Sprintf("%dx%d", decoded.Bounds().Dx(), decoded.Bounds().Dy())
+		}
+		if thumb, err := utils.EncodeJPEG(decoded, 400, 80); err == nil {
+			st.thumbnailUrl, _ = utils.Store.Put(ctx, st.blob.ThumbnailKey, bytes.NewReader(thumb), int64(len(thumb)), "image/jpeg")
 		}
+	} else {
+		log.Printf("缩略图生成失败 (%s): %v", fileName, err)
+	}
+
+	if st.thumbnailUrl == "" {
+		st.thumbnailUrl = st.url
+		st.blob.ThumbnailKey = ""
 	}
+	return st, nil
+}
 
-	if thumbnailUrl == "" {
-		thumbnailUrl = originalUrl
+// remove 删除暂存的对象
+func (st *stagedBlob) remove(ctx context.Context) {
+	utils.Store.Delete(ctx, st.blob.OriginalKey)
+	if st.blob.ThumbnailKey != "" {
+		utils.Store.Delete(ctx, st.blob.ThumbnailKey)
 	}
+}
 
-	// 存入数据库
-	imageModel := models.Image{
-		UserID:       userID.(uint),
-		FileName:     fileHeader.Filename,
-		Url:          originalUrl,
-		ThumbnailUrl: thumbnailUrl,
-		Tags:         mergedTags,
-		CameraModel:  exifData.CameraModel,
-		ShootingTime: exifData.ShootingTime,
-		Resolution:   exifData.Resolution,
-		Aperture:     exifData.Aperture,
-		ISO:          exifData.ISO,
-	}
-
-	if err := database.DB.Create(&imageModel).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "数据库保存失败"})
+// claimNewBlob 用暂存的对象认领 Blob 并保存图片记录；派生图和 AI 分析随后由 worker 异步完成。
+// 调用方需持有 Blob 行锁且引用计数为 0
+func claimNewBlob(tx *gorm.DB, blob *models.Blob, st *stagedBlob, img *models.Image) error {
+	*blob = st.blob
+	blob.RefCount = 1
+
+	// 基于EXIF生成检索标签，AI 标签稍后由 worker 合并
+	exifTags := utils.ExifTagsFromData(st.exif)
+	// 根据 GPS 离线反查地名
+	placeTags := utils.PlaceTagsFromExif(st.exif)
+
+	img.Url = st.url
+	img.ThumbnailUrl = st.thumbnailUrl
+	img.PHash = st.phash
+	img.Colors = st.colors
+	img.Palette = database.PaletteString(st.colors)
+	img.Tags = utils.MergeTags(utils.MergeTags("", exifTags), placeTags)
+	img.AnalysisStatus = models.AnalysisPending
+	database.ApplyExif(img, st.exif)
+
+	if err := tx.Save(blob).Error; err != nil {
+		return err
+	}
+	if err := tx.Create(img).Error; err != nil {
+		return err
+	}
+	if err := database.ReplaceImageTags(tx, img.ID, database.TagEntriesFromString(img.Tags, models.TagSourceExif)); err != nil {
+		return err
+	}
+	// 派生图和 AI 分析都交给后台 worker，上传请求立即返回；派生图生成前客户端使用缩略图和原图
+	if st.decoded {
+		if err := workers.EnqueueRenditions(tx, img.ID, 0); err != nil {
+			return err
+		}
+	}
+	return workers.EnqueueAnalysis(tx, img.ID)
+}
+
+// removeBlobObjects 删除内容目录下的原图及所有派生文件，调用方需持有 Blob 行锁
+func removeBlobObjects(ctx context.Context, hash string) {
+	objects, err := utils.Store.List(ctx, utils.BlobPrefix(hash))
+	if err != nil {
+		log.Printf("列出对象失败 (%s): %v", hash, err)
 		return
 	}
+	for _, obj := range objects {
+		utils.Store.Delete(ctx, obj.Key)
+	}
+}
 
-	c.JSON(http.StatusOK, gin.H{
-		"message": "上传成功",
-		"image":   imageModel,
-	})
+// findFilePart 逐个读取 multipart 分段，返回指定字段的文件分段，不缓冲整个表单
+func findFilePart(r *http.Request, field string) (*multipart.Part, error) {
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		part, err := reader.NextPart()
+		if err != nil {
+			return nil, err
+		}
+		if part.FormName() == field && part.FileName() != "" {
+			return part, nil
+		}
+		part.Close()
+	}
 }
 
 // GetImages 获取用户图片列表
@@ -114,21 +409,21 @@ func GetImages(c *gin.Context) {
 		return
 	}
 
-	searchQuery := c.Query("q")
-	var images []models.Image
-	db := database.DB.Where("user_id = ?", userID)
-	if searchQuery != "" {
-		likeQuery := "%" + searchQuery + "%"
-		db = db.Where("file_name LIKE ? OR tags LIKE ?", likeQuery, likeQuery)
+	opts, err := parseListOptions(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
-	result := db.Order("created_at desc").Find(&images)
 
-	if result.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取列表失败"})
+	db := database.DB.Model(&models.Image{}).Where("images.user_id = ?", userID)
+	db, ok := applySearchQuery(c, db)
+	if !ok {
 		return
 	}
-
-	c.JSON(http.StatusOK, gin.H{"data": images})
+	if db, ok = applyColorFilter(c, db); !ok {
+		return
+	}
+	paginate(c, db, opts)
 }
 
 // UpdateImageTags 更新图片标签
@@ -148,11 +443,132 @@ func UpdateImageTags(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "图片不存在"})
 		return
 	}
-	image.Tags = input.Tags
-	database.DB.Save(&image)
+
+	// 保留已有标签的来源，新出现的标签记为用户添加
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		current, err := database.ImageTagEntries(tx, image.ID)
+		if err != nil {
+			return err
+		}
+		existing := make(map[string]models.TagEntry, len(current))
+		for _, e := range current {
+			existing[e.Name] = e
+		}
+		var entries []models.TagEntry
+		for _, name := range splitTags(input.Tags) {
+			entry, ok := existing[strings.TrimSpace(name)]
+			if !ok {
+				entry = models.TagEntry{Name: name, Source: models.TagSourceUser}
+			}
+			entries = append(entries, entry)
+		}
+		if err := database.ReplaceImageTags(tx, image.ID, entries); err != nil {
+			return err
+		}
+		// 标签变化后由后台任务更新文本向量
+		if err := workers.EnqueueEmbeddingRefresh(tx, image.ID); err != nil {
+			return err
+		}
+		return tx.First(&image, image.ID).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "更新成功", "image": image})
+}
+
+// UpdateImageCaption 修改图片的描述和替代文本，只更新请求中出现的字段；修改后重新分析不再覆盖
+func UpdateImageCaption(c *gin.Context) {
+	var input struct {
+		Description *string `json:"description"`
+		AltText     *string `json:"alt_text"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil || (input.Description == nil && input.AltText == nil) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+	updates := map[string]interface{}{"caption_edited": true}
+	if input.Description != nil {
+		desc := strings.TrimSpace(*input.Description)
+		if utf8.RuneCountInString(desc) > utils.MaxDescriptionLength {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "描述不能超过 " + strconv.Itoa(utils.MaxDescriptionLength) + " 个字符"})
+			return
+		}
+		updates["description"] = desc
+	}
+	if input.AltText != nil {
+		alt := strings.TrimSpace(*input.AltText)
+		if utf8.RuneCountInString(alt) > utils.MaxAltTextLength {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "替代文本不能超过 " + strconv.Itoa(utils.MaxAltTextLength) + " 个字符"})
+			return
+		}
+		updates["alt_text"] = alt
+	}
+
+	image, ok := findImage(c)
+	if !ok {
+		return
+	}
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(image).Updates(updates).Error; err != nil {
+			return err
+		}
+		return workers.EnqueueEmbeddingRefresh(tx, image.ID)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新失败"})
+		return
+	}
 	c.JSON(http.StatusOK, gin.H{"message": "更新成功", "image": image})
 }
 
+// GetImageTags 返回图片的标签及其来源（ai / exif / user）
+func GetImageTags(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	imageID := c.Param("id")
+	var image models.Image
+	if err := database.DB.Where("id = ? AND user_id = ?", imageID, userID).First(&image).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "图片不存在"})
+		return
+	}
+	entries, err := database.ImageTagEntries(database.DB, image.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取标签失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": entries})
+}
+
+// applySearchQuery 解析 q 参数中的检索语句并追加到查询上；语法错误时返回 400 和出错位置
+func applySearchQuery(c *gin.Context, db *gorm.DB) (*gorm.DB, bool) {
+	return applyQueryString(c, db, c.Query("q"))
+}
+
+// applyQueryString 解析检索语句并追加到查询上，语句为空时不做过滤
+func applyQueryString(c *gin.Context, db *gorm.DB, q string) (*gorm.DB, bool) {
+	q = strings.TrimSpace(q)
+	if q == "" {
+		return db, true
+	}
+	sq, err := utils.ParseQuery(q)
+	if err != nil {
+		writeQueryError(c, err)
+		return nil, false
+	}
+	return db.Where(sq.SQL, sq.Args...), true
+}
+
+// writeQueryError 返回检索语句的语法错误及出错位置
+func writeQueryError(c *gin.Context, err error) {
+	var qe *utils.QueryError
+	if errors.As(err, &qe) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "检索语句有误", "detail": qe})
+	} else {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "检索语句有误"})
+	}
+}
+
 // DeleteImage 删除图片
 func DeleteImage(c *gin.Context) {
 	userID, _ := c.Get("userID")
@@ -163,34 +579,120 @@ func DeleteImage(c *gin.Context) {
 		return
 	}
 
-	// 删除MinIO中的文件
-	utils.RemoveFile(path.Base(image.Url))
-	if image.ThumbnailUrl != "" && image.ThumbnailUrl != image.Url {
-		utils.RemoveFile(path.Base(image.ThumbnailUrl))
+	if err := deleteImage(c.Request.Context(), &image); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除失败"})
+		return
 	}
-
-	database.DB.Delete(&image)
 	c.JSON(http.StatusOK, gin.H{"message": "删除成功"})
 }
 
+// deleteImage 删除图片记录；共享的原图只有在最后一个引用消失时才从存储中删除
+func deleteImage(ctx context.Context, image *models.Image) error {
+	// 旧数据没有内容哈希，对象为该记录独占
+	if image.ContentHash == "" {
+		var renditions []models.ImageRendition
+		database.DB.Where("image_id = ?", image.ID).Find(&renditions)
+		err := database.DB.Transaction(func(tx *gorm.DB) error {
+			if err := detachImage(tx, image.ID); err != nil {
+				return err
+			}
+			return tx.Delete(image).Error
+		})
+		if err != nil {
+			return err
+		}
+		utils.Store.Delete(ctx, utils.Store.KeyFromURL(image.Url))
+		if image.ThumbnailUrl != "" && image.ThumbnailUrl != image.Url {
+			utils.Store.Delete(ctx, utils.Store.KeyFromURL(image.ThumbnailUrl))
+		}
+		for _, r := range renditions {
+			utils.Store.Delete(ctx, r.Key)
+		}
+		if cached, err := utils.Store.List(ctx, renderCachePrefix(image)); err == nil {
+			for _, obj := range cached {
+				utils.Store.Delete(ctx, obj.Key)
+			}
+		}
+		deleteImageEdits(ctx, image.ID)
+		return nil
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := detachImage(tx, image.ID); err != nil {
+			return err
+		}
+		if err := tx.Model(image).Update("dedup_hash", nil).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(image).Error; err != nil {
+			return err
+		}
+		var blob models.Blob
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&blob, "hash = ?", image.ContentHash).Error; err != nil {
+			return err
+		}
+		blob.RefCount--
+		if blob.RefCount > 0 {
+			return tx.Model(&blob).Update("ref_count", blob.RefCount).Error
+		}
+		// 最后一个引用：持锁删除该内容目录下的原图及所有派生文件，同内容的上传会等待锁释放后重新写入
+		removeBlobObjects(ctx, image.ContentHash)
+		return tx.Delete(&blob).Error
+	})
+	if err != nil {
+		return err
+	}
+	// 编辑版本为该图片独占，不随 Blob 共享
+	deleteImageEdits(ctx, image.ID)
+	return nil
+}
+
+// detachImage 删除图片的标签、标签建议、相册关联、语义向量及相似图片对，并清除以它为封面的相册设置
+func detachImage(tx *gorm.DB, imageID uint) error {
+	if err := tx.Where("image_id = ?", imageID).Delete(&models.ImageTag{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("image_id = ?", imageID).Delete(&models.TagSuggestion{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("image_id = ?", imageID).Delete(&models.AlbumImage{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("image_id = ?", imageID).Delete(&models.ImageRendition{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("image_id = ?", imageID).Delete(&models.ImageEdit{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("image_id = ?", imageID).Delete(&models.ImageColor{}).Error; err != nil {
+		return err
+	}
+	if err := workers.RemoveEmbedding(tx, imageID); err != nil {
+		return err
+	}
+	if err := workers.RemoveSimilarPairs(tx, imageID); err != nil {
+		return err
+	}
+	return tx.Model(&models.Album{}).Where("cover_image_id = ?", imageID).Update("cover_image_id", nil).Error
+}
+
 // GetAllImagesPublic 获取所有图片（公开接口）
 func GetAllImagesPublic(c *gin.Context) {
-	searchQuery := c.Query("q")
-	var images []models.Image
+	opts, err := parseListOptions(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
 	db := database.DB.Model(&models.Image{})
-	if searchQuery != "" {
-		likeQuery := "%" + searchQuery + "%"
-		db = db.Where("file_name LIKE ? OR tags LIKE ? OR camera_model LIKE ?", likeQuery, likeQuery, likeQuery)
+	db, ok := applySearchQuery(c, db)
+	if !ok {
+		return
 	}
-
-	result := db.Order("created_at desc").Find(&images)
-	if result.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取列表失败"})
+	if db, ok = applyColorFilter(c, db); !ok {
 		return
 	}
-
-	c.JSON(http.StatusOK, gin.H{"data": images})
+	paginate(c, db, opts)
 }
 
 // GetGalleryStats 获取图库统计信息
@@ -198,44 +700,34 @@ func GetGalleryStats(c *gin.Context) {
 	var totalCount int64
 	database.DB.Model(&models.Image{}).Count(&totalCount)
 
-	var images []models.Image
-	database.DB.Find(&images)
-
-	tagCount := make(map[string]int)
-	cameraCount := make(map[string]int)
-
-	for _, img := range images {
-		if img.Tags != "" {
-			tags := splitTags(img.Tags)
-			for _, tag := range tags {
-				if tag != "" {
-					tagCount[tag]++
-				}
-			}
-		}
-		if img.CameraModel != "" {
-			cameraCount[img.CameraModel]++
-		}
-	}
-
-	// 转换为切片并排序
+	// 标签和相机分布直接在数据库中聚合
 	type TagStat struct {
 		Tag   string `json:"tag"`
 		Count int    `json:"count"`
 	}
 	var topTags []TagStat
-	for tag, count := range tagCount {
-		topTags = append(topTags, TagStat{Tag: tag, Count: count})
-	}
-	for i := 0; i < len(topTags); i++ {
-		for j := i + 1; j < len(topTags); j++ {
-			if topTags[j].Count > topTags[i].Count {
-				topTags[i], topTags[j] = topTags[j], topTags[i]
-			}
-		}
+	database.DB.Table("image_tags").
+		Select("tags.name AS tag, COUNT(*) AS count").
+		Joins("JOIN tags ON tags.id = image_tags.tag_id").
+		Joins("JOIN images ON images.id = image_tags.image_id AND images.deleted_at IS NULL").
+		Group("tags.name").
+		Order("count DESC").
+		Limit(10).
+		Scan(&topTags)
+
+	type CameraStat struct {
+		CameraModel string
+		Count       int
 	}
-	if len(topTags) > 10 {
-		topTags = topTags[:10]
+	var cameraStats []CameraStat
+	database.DB.Model(&models.Image{}).
+		Select("camera_model, COUNT(*) AS count").
+		Where("camera_model <> ''").
+		Group("camera_model").
+		Scan(&cameraStats)
+	cameraCount := make(map[string]int, len(cameraStats))
+	for _, cs := range cameraStats {
+		cameraCount[cs.CameraModel] = cs.Count
 	}
 
 	c.JSON(http.StatusOK, gin.H{
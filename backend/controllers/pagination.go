@@ -0,0 +1,368 @@
+package controllers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"smart-gallery-backend/database"
+	"smart-gallery-backend/models"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 200
+)
+
+// sortColumns 列表支持的排序字段
+var sortColumns = map[string]string{
+	"shooting_time": "images.shooting_time",
+	"created_at":    "images.created_at",
+	"file_name":     "images.file_name",
+	"resolution":    "images.pixels",
+	"color":         "color_match.color_distance", // 仅在提供 color 参数时可用
+	"position":      "album_images.position",      // 仅用于静态相册内的图片
+}
+
+// sortAliases 排序字段的别名
+var sortAliases = map[string]string{
+	"taken":    "shooting_time",
+	"uploaded": "created_at",
+	"name":     "file_name",
+	"pixels":   "resolution",
+}
+
+// listCursor 游标内容：上一页最后一条记录的排序值和 ID。对客户端不透明。
+type listCursor struct {
+	Sort  string          `json:"s"`
+	Desc  bool            `json:"d"`
+	Value json.RawMessage `json:"v"`
+	ID    uint            `json:"i"`
+}
+
+// listOptions 由请求参数解析出的分页、排序和字段选择
+type listOptions struct {
+	sort   string
+	desc   bool
+	limit  int
+	cursor *listCursor
+	fields []string // JSON 字段名，为空表示返回全部字段
+}
+
+// parseListOptions 解析 limit、cursor、sort、order、fields 参数，默认按上传时间倒序
+func parseListOptions(c *gin.Context) (*listOptions, error) {
+	return parseListOptionsDefault(c, "created_at", true)
+}
+
+// parseListOptionsDefault 同 parseListOptions，未指定 sort 时按 sort/desc 排序；
+// 只有默认按相册顺序（position）的列表才接受 sort=position
+func parseListOptionsDefault(c *gin.Context, sort string, desc bool) (*listOptions, error) {
+	opts := &listOptions{sort: sort, desc: desc, limit: defaultPageSize}
+
+	if s := strings.ToLower(c.Query("sort")); s != "" {
+		if alias, ok := sortAliases[s]; ok {
+			s = alias
+		}
+		if _, ok := sortColumns[s]; !ok || (s == "position" && sort != "position") {
+			return nil, errors.New("不支持的排序字段: " + s)
+		}
+		opts.sort = s
+	}
+	hasColor := strings.TrimSpace(c.Query("color")) != ""
+	if opts.sort == "color" && !hasColor {
+		return nil, errors.New("按颜色排序需要提供 color 参数")
+	}
+	// 按颜色检索时默认色差从小到大
+	if hasColor && c.Query("sort") == "" {
+		opts.sort, opts.desc = "color", false
+	}
+	switch strings.ToLower(c.Query("order")) {
+	case "":
+	case "desc":
+		opts.desc = true
+	case "asc":
+		opts.desc = false
+	default:
+		return nil, errors.New("order 只能是 asc 或 desc")
+	}
+
+	if l := c.Query("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n <= 0 {
+			return nil, errors.New("limit 必须是正整数")
+		}
+		opts.limit = min(n, maxPageSize)
+	}
+
+	if raw := c.Query("cursor"); raw != "" {
+		data, err := base64.RawURLEncoding.DecodeString(raw)
+		var cur listCursor
+		if err != nil || json.Unmarshal(data, &cur) != nil {
+			return nil, errors.New("无效的游标")
+		}
+		if cur.Sort != opts.sort || cur.Desc != opts.desc {
+			return nil, errors.New("游标与当前排序方式不一致")
+		}
+		opts.cursor = &cur
+	}
+
+	if f := c.Query("fields"); f != "" {
+		for _, name := range strings.Split(f, ",") {
+			name = strings.TrimSpace(name)
+			if name == "" {
+				continue
+			}
+			if _, ok := imageFields()[strings.ToLower(name)]; !ok {
+				return nil, errors.New("未知字段: " + name)
+			}
+			opts.fields = append(opts.fields, name)
+		}
+	}
+	return opts, nil
+}
+
+// paginate 执行分页查询并返回列表响应；db 应已包含过滤条件
+func paginate(c *gin.Context, db *gorm.DB, opts *listOptions) {
+	var total int64
+	if err := db.Session(&gorm.Session{}).Model(&models.Image{}).Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取列表失败"})
+		return
+	}
+
+	column := sortColumns[opts.sort]
+	cmp, dir := ">", "ASC"
+	if opts.desc {
+		cmp, dir = "<", "DESC"
+	}
+
+	q := db.Session(&gorm.Session{})
+	if opts.cursor != nil {
+		value, err := cursorValue(opts.sort, opts.cursor.Value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的游标"})
+			return
+		}
+		q = q.Where("("+column+" "+cmp+" ? OR ("+column+" = ? AND images.id "+cmp+" ?))", value, value, opts.cursor.ID)
+	}
+	if cols := selectColumns(opts); cols != nil {
+		q = q.Select(cols)
+	}
+
+	var images []models.Image
+	if err := q.Order(column + " " + dir).Order("images.id " + dir).Limit(opts.limit + 1).Find(&images).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取列表失败"})
+		return
+	}
+
+	nextCursor := ""
+	if len(images) > opts.limit {
+		images = images[:opts.limit]
+		nextCursor = encodeCursor(opts, images[len(images)-1])
+	}
+	if wantsRenditions(opts) {
+		if err := attachRenditions(images); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "获取列表失败"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":        projectImages(images, opts.fields),
+		"total":       total,
+		"next_cursor": nextCursor,
+		"has_more":    nextCursor != "",
+	})
+}
+
+func encodeCursor(opts *listOptions, last models.Image) string {
+	var v interface{}
+	switch opts.sort {
+	case "shooting_time":
+		v = last.ShootingTime
+	case "created_at":
+		v = last.CreatedAt.Format(time.RFC3339Nano)
+	case "file_name":
+		v = last.FileName
+	case "resolution":
+		v = last.Pixels
+	case "color":
+		if last.ColorDistance != nil {
+			v = *last.ColorDistance
+		}
+	case "position":
+		if last.AlbumPosition != nil {
+			v = *last.AlbumPosition
+		}
+	}
+	value, _ := json.Marshal(v)
+	data, _ := json.Marshal(listCursor{Sort: opts.sort, Desc: opts.desc, Value: value, ID: last.ID})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func cursorValue(sort string, raw json.RawMessage) (interface{}, error) {
+	switch sort {
+	case "resolution", "position":
+		var n int64
+		err := json.Unmarshal(raw, &n)
+		return n, err
+	case "color":
+		var f float64
+		err := json.Unmarshal(raw, &f)
+		return f, err
+	case "created_at":
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return nil, err
+		}
+		return time.Parse(time.RFC3339Nano, s)
+	default:
+		var s string
+		err := json.Unmarshal(raw, &s)
+		return s, err
+	}
+}
+
+// imageField 可选择的 JSON 字段及其对应的数据库列
+type imageField struct {
+	jsonName string
+	column   string
+}
+
+var (
+	imageFieldsOnce sync.Once
+	imageFieldMap   map[string]imageField
+)
+
+// imageFields 返回 models.Image 的 JSON 字段（小写）到数据库列的映射；
+// renditions、srcset 等非数据库字段的 column 为空
+func imageFields() map[string]imageField {
+	imageFieldsOnce.Do(func() {
+		imageFieldMap = map[string]imageField{}
+		s, err := schema.Parse(&models.Image{}, &sync.Map{}, schema.NamingStrategy{})
+		if err != nil {
+			return
+		}
+		for _, f := range s.Fields {
+			tag := strings.Split(f.Tag.Get("json"), ",")[0]
+			if tag == "-" || (f.DBName == "" && tag == "") || f.IgnoreMigration {
+				continue
+			}
+			name := f.Name
+			if tag != "" {
+				name = tag
+			}
+			imageFieldMap[strings.ToLower(name)] = imageField{jsonName: name, column: f.DBName}
+		}
+	})
+	return imageFieldMap
+}
+
+// wantsRenditions 未指定 fields，或 fields 中包含 renditions / srcset 时才加载派生图
+func wantsRenditions(opts *listOptions) bool {
+	if len(opts.fields) == 0 {
+		return true
+	}
+	for _, f := range opts.fields {
+		if col := imageFields()[strings.ToLower(f)].column; col == "" {
+			return true
+		}
+	}
+	return false
+}
+
+// attachRenditions 一次查询加载整页图片的派生图并生成 srcset
+func attachRenditions(images []models.Image) error {
+	if len(images) == 0 {
+		return nil
+	}
+	ids := make([]uint, len(images))
+	for i, img := range images {
+		ids[i] = img.ID
+	}
+	var rows []models.ImageRendition
+	if err := database.DB.Where("image_id IN ?", ids).Order("width, id").Find(&rows).Error; err != nil {
+		return err
+	}
+	byImage := make(map[uint][]models.ImageRendition, len(images))
+	for _, r := range rows {
+		byImage[r.ImageID] = append(byImage[r.ImageID], r)
+	}
+	for i := range images {
+		images[i].Renditions = byImage[images[i].ID]
+		setSrcset(&images[i])
+	}
+	return nil
+}
+
+// setSrcset 按格式拼接 srcset，例如 {"webp": "a.webp 200w, b.webp 1200w"}
+func setSrcset(img *models.Image) {
+	if len(img.Renditions) == 0 {
+		return
+	}
+	parts := map[string][]string{}
+	for _, r := range img.Renditions {
+		parts[r.Format] = append(parts[r.Format], r.Url+" "+strconv.Itoa(r.Width)+"w")
+	}
+	img.Srcset = make(map[string]string, len(parts))
+	for format, list := range parts {
+		img.Srcset[format] = strings.Join(list, ", ")
+	}
+}
+
+// selectColumns 根据 fields 生成 SELECT 列，始终包含 ID 和排序列以便生成游标；
+// 按相册顺序排序时相册内位置以 album_position 返回
+func selectColumns(opts *listOptions) []string {
+	sortCol := sortColumns[opts.sort]
+	if opts.sort == "position" {
+		sortCol += " AS album_position"
+	}
+	if len(opts.fields) == 0 {
+		if opts.sort == "position" {
+			return []string{"images.*", sortCol}
+		}
+		return nil
+	}
+	fields := imageFields()
+	cols := []string{"images.id", sortCol}
+	for _, f := range opts.fields {
+		if col := fields[strings.ToLower(f)].column; col != "" {
+			cols = append(cols, "images."+col)
+		}
+	}
+	return cols
+}
+
+// projectImages 只保留请求的字段；未指定 fields 时原样返回
+func projectImages(images []models.Image, fields []string) interface{} {
+	if len(fields) == 0 {
+		return images
+	}
+	lookup := imageFields()
+	out := make([]map[string]interface{}, 0, len(images))
+	for _, img := range images {
+		data, _ := json.Marshal(img)
+		var full map[string]interface{}
+		json.Unmarshal(data, &full)
+
+		row := map[string]interface{}{"ID": full["ID"]}
+		for _, extra := range []string{"color_distance", "album_position"} {
+			if d, ok := full[extra]; ok {
+				row[extra] = d
+			}
+		}
+		for _, f := range fields {
+			name := lookup[strings.ToLower(f)].jsonName
+			row[name] = full[name]
+		}
+		out = append(out, row)
+	}
+	return out
+}
@@ -0,0 +1,114 @@
+package controllers
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/http"
+	"smart-gallery-backend/models"
+	"smart-gallery-backend/utils"
+	"smart-gallery-backend/workers"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// renderCacheKey 渲染结果的缓存位置：与原图同一内容目录，旧数据按图片 ID 存放，
+// 编辑过的图片按编辑版本存放
+func renderCacheKey(img *models.Image, p utils.RenderParams) string {
+	return renderCachePrefix(img) + p.CacheName()
+}
+
+func renderCachePrefix(img *models.Image) string {
+	if img.EditVersion > 0 {
+		return workers.EditKeyPrefix(img.ID, img.EditVersion) + "cache/"
+	}
+	if img.ContentHash != "" {
+		return utils.BlobPrefix(img.ContentHash) + "cache/"
+	}
+	return fmt.Sprintf("cache/%d/", img.ID)
+}
+
+// SignImageRender 为当前用户的图片签发按需缩放地址
+func SignImageRender(c *gin.Context) {
+	image, ok := findImage(c)
+	if !ok {
+		return
+	}
+	p, err := utils.ParseRenderParams(c.Request.URL.Query())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	query, err := utils.SignRender(image.ID, p, time.Now())
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+	exp, _ := strconv.ParseInt(query.Get("exp"), 10, 64)
+	c.JSON(http.StatusOK, gin.H{
+		"url":        "/api/images/" + strconv.FormatUint(uint64(image.ID), 10) + "/render?" + query.Encode(),
+		"expires_at": time.Unix(exp, 0),
+	})
+}
+
+// RenderImage 按签名参数返回缩放、裁切并转码后的图片，结果缓存在对象存储中。
+// 只能访问自己的图片，签名防止请求任意尺寸消耗服务器资源
+func RenderImage(c *gin.Context) {
+	image, ok := findImage(c)
+	if !ok {
+		return
+	}
+	p, err := utils.ParseRenderParams(c.Request.URL.Query())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	exp, ok := utils.VerifyRender(image.ID, p, c.Request.URL.Query(), time.Now())
+	if !ok {
+		c.JSON(http.StatusForbidden, gin.H{"error": "签名无效或已过期"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	key := renderCacheKey(image, p)
+	// 浏览器缓存不超过地址的有效期
+	c.Header("Cache-Control", "private, max-age="+strconv.Itoa(int(time.Until(exp).Seconds())))
+
+	// 命中缓存时直接转发对象内容
+	if info, err := utils.Store.Stat(ctx, key); err == nil {
+		if rc, err := utils.Store.Get(ctx, key); err == nil {
+			defer rc.Close()
+			c.Header("X-Render-Cache", "hit")
+			c.DataFromReader(http.StatusOK, info.Size, info.ContentType, rc, nil)
+			return
+		}
+	}
+
+	enc, err := utils.NewImageEncoder(p.Format)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "不支持输出该格式"})
+		return
+	}
+	decoded, err := workers.DecodeCurrent(ctx, image, uploadLimits)
+	if err != nil {
+		log.Printf("图片 %d 解码失败: %v", image.ID, err)
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "无法处理该图片"})
+		return
+	}
+	data, err := enc.Encode(utils.RenderImage(decoded, p), p.Quality)
+	if err != nil {
+		log.Printf("图片 %d 编码失败: %v", image.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "图片处理失败"})
+		return
+	}
+
+	// 缓存写入失败不影响本次响应
+	if _, err := utils.Store.Put(ctx, key, bytes.NewReader(data), int64(len(data)), enc.ContentType()); err != nil {
+		log.Printf("渲染缓存写入失败 (%s): %v", key, err)
+	}
+	c.Header("X-Render-Cache", "miss")
+	c.Data(http.StatusOK, enc.ContentType(), data)
+}
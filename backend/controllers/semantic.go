@@ -0,0 +1,108 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"smart-gallery-backend/database"
+	"smart-gallery-backend/models"
+	"smart-gallery-backend/workers"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SearchImagesSemantic 按语义检索当前用户的图片，结果按与 q 的余弦相似度从高到低排列。
+// 可用 filter 传入检索语句、color 传入颜色进一步过滤，min_score 指定最低相似度。
+func SearchImagesSemantic(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	text := strings.TrimSpace(c.Query("q"))
+	if text == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请输入检索内容"})
+		return
+	}
+	limit := defaultPageSize
+	if l := c.Query("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit 必须是正整数"})
+			return
+		}
+		limit = min(n, maxPageSize)
+	}
+	var minScore float64
+	if raw := c.Query("min_score"); raw != "" {
+		v, err := strconv.ParseFloat(raw, 32)
+		if err != nil || v < -1 || v > 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "min_score 必须是 -1 到 1 之间的数"})
+			return
+		}
+		minScore = v
+	}
+
+	// 先按用户和过滤条件选出可检索的图片，再只在这些图片中按相似度取前 limit 张
+	db := database.DB.Model(&models.Image{}).Where("images.user_id = ?", userID)
+	db, ok := applyQueryString(c, db, c.Query("filter"))
+	if !ok {
+		return
+	}
+	if db, ok = applyColorFilter(c, db); !ok {
+		return
+	}
+	var allowed []uint
+	if err := db.Pluck("images.id", &allowed).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取列表失败"})
+		return
+	}
+
+	results, err := workers.SearchEmbeddings(c.Request.Context(), text, allowed, limit)
+	if errors.Is(err, workers.ErrSemanticUnavailable) {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "语义检索不可用"})
+		return
+	}
+	if err != nil {
+		log.Println("语义检索失败:", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "语义检索失败"})
+		return
+	}
+	scores := make(map[uint]float32, len(results))
+	ids := make([]uint, 0, len(results))
+	for _, r := range results {
+		if float64(r.Score) >= minScore {
+			scores[r.ID] = r.Score
+			ids = append(ids, r.ID)
+		}
+	}
+	if len(ids) == 0 {
+		c.JSON(http.StatusOK, gin.H{"data": []models.Image{}})
+		return
+	}
+
+	var found []models.Image
+	if err := database.DB.Where("user_id = ? AND id IN ?", userID, ids).Find(&found).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取列表失败"})
+		return
+	}
+
+	// 按索引返回的相似度顺序排列
+	byID := make(map[uint]*models.Image, len(found))
+	for i := range found {
+		byID[found[i].ID] = &found[i]
+	}
+	images := make([]models.Image, 0, len(found))
+	for _, id := range ids {
+		img, ok := byID[id]
+		if !ok {
+			continue
+		}
+		score := scores[id]
+		img.Score = &score
+		images = append(images, *img)
+	}
+	if err := attachRenditions(images); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取列表失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": images})
+}
@@ -0,0 +1,182 @@
+package controllers
+
+import (
+	"net/http"
+	"smart-gallery-backend/database"
+	"smart-gallery-backend/models"
+	"smart-gallery-backend/utils"
+	"smart-gallery-backend/workers"
+	"sort"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+const defaultSimilarDistance = 10 // 64 位 dHash 中不同位数不超过该值视为相似
+
+// similarGroup 一组相似图片，Keep 为建议保留的图片，组内每张图片与它的距离都不超过阈值
+type similarGroup struct {
+	Keep   uint           `json:"keep"`
+	Images []models.Image `json:"images"`
+}
+
+// ResolveSimilarInput 处理一组相似图片：保留 KeepID，删除 TrashIDs；
+// 被删除的图片与保留的图片的距离不能超过 Distance（默认 10）
+type ResolveSimilarInput struct {
+	KeepID   uint   `json:"keep_id" binding:"required"`
+	TrashIDs []uint `json:"trash_ids" binding:"required"`
+	Distance *int   `json:"distance"`
+}
+
+// GetSimilarImages 按后台预先计算的相似图片对将当前用户的图片分组，只返回包含多张图片的组。
+// distance 指定最大距离，默认 10；新上传的图片在 worker 处理后才会出现。
+func GetSimilarImages(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	distance := defaultSimilarDistance
+	if raw := c.Query("distance"); raw != "" {
+		d, err := strconv.Atoi(raw)
+		if err != nil || !validSimilarDistance(d) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "distance 必须是 0-" + strconv.Itoa(workers.SimilarMaxDistance) + " 的整数"})
+			return
+		}
+		distance = d
+	}
+
+	var pairs []models.SimilarPair
+	if err := database.DB.Where("user_id = ? AND distance <= ?", userID, distance).Find(&pairs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取图片失败"})
+		return
+	}
+	ids := make([]uint, 0, len(pairs)*2)
+	for _, p := range pairs {
+		ids = append(ids, p.ImageID, p.OtherID)
+	}
+	var images []models.Image
+	if len(ids) > 0 {
+		err := database.DB.Select("id, file_name, url, thumbnail_url, shooting_time, resolution, width, height, pixels, phash, edited_thumbnail_url, created_at").
+			Where("id IN ? AND user_id = ?", uniqueIDs(ids), userID).
+			Order("id").Find(&images).Error
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "获取图片失败"})
+			return
+		}
+	}
+
+	groups := groupSimilar(images, pairs)
+	c.JSON(http.StatusOK, gin.H{"distance": distance, "data": groups})
+}
+
+func validSimilarDistance(d int) bool {
+	return d >= 0 && d <= workers.SimilarMaxDistance
+}
+
+// groupSimilar 按建议保留的顺序（分辨率高、上传早的在前）依次选出代表图片，
+// 与代表的距离在阈值内、且尚未归组的图片归入该组；距离不传递，组内每张图片都与代表相似
+func groupSimilar(images []models.Image, pairs []models.SimilarPair) []similarGroup {
+	byID := make(map[uint]*models.Image, len(images))
+	for i := range images {
+		byID[images[i].ID] = &images[i]
+	}
+	neighbors := map[uint][]uint{}
+	for _, p := range pairs {
+		// 已删除的图片不会出现在 images 中
+		if byID[p.ImageID] == nil || byID[p.OtherID] == nil {
+			continue
+		}
+		neighbors[p.ImageID] = append(neighbors[p.ImageID], p.OtherID)
+		neighbors[p.OtherID] = append(neighbors[p.OtherID], p.ImageID)
+	}
+
+	order := make([]*models.Image, 0, len(images))
+	for i := range images {
+		order = append(order, &images[i])
+	}
+	sort.SliceStable(order, func(i, j int) bool { return order[i].Pixels > order[j].Pixels })
+
+	assigned := map[uint]bool{}
+	groups := []similarGroup{}
+	for _, rep := range order {
+		if assigned[rep.ID] {
+			continue
+		}
+		members := []models.Image{*rep}
+		for _, id := range neighbors[rep.ID] {
+			if !assigned[id] {
+				assigned[id] = true
+				members = append(members, *byID[id])
+			}
+		}
+		if len(members) < 2 {
+			continue
+		}
+		assigned[rep.ID] = true
+		sort.Slice(members, func(i, j int) bool { return members[i].ID < members[j].ID })
+		groups = append(groups, similarGroup{Keep: rep.ID, Images: members})
+	}
+	// 图片多的组排在前面，数量相同时按最早的图片排序
+	sort.Slice(groups, func(i, j int) bool {
+		if len(groups[i].Images) != len(groups[j].Images) {
+			return len(groups[i].Images) > len(groups[j].Images)
+		}
+		return groups[i].Images[0].ID < groups[j].Images[0].ID
+	})
+	return groups
+}
+
+// ResolveSimilarImages 保留一张图片并删除与它相似的其他图片
+func ResolveSimilarImages(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	var input ResolveSimilarInput
+	if err := c.ShouldBindJSON(&input); err != nil || len(input.TrashIDs) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+	distance := defaultSimilarDistance
+	if input.Distance != nil {
+		if !validSimilarDistance(*input.Distance) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "distance 必须是 0-" + strconv.Itoa(workers.SimilarMaxDistance) + " 的整数"})
+			return
+		}
+		distance = *input.Distance
+	}
+	trashIDs := uniqueIDs(input.TrashIDs)
+	for _, id := range trashIDs {
+		if id == input.KeepID {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "保留的图片不能同时被删除"})
+			return
+		}
+	}
+
+	var keep models.Image
+	if err := database.DB.Where("id = ? AND user_id = ?", input.KeepID, userID).First(&keep).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "图片不存在"})
+		return
+	}
+	var trash []models.Image
+	if err := database.DB.Where("id IN ? AND user_id = ?", trashIDs, userID).Find(&trash).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除失败"})
+		return
+	}
+	if len(trash) != len(trashIDs) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "部分图片不存在"})
+		return
+	}
+	// 只允许删除与保留图片本身相似的图片，防止误删只是间接相似的图片
+	for _, img := range trash {
+		if keep.PHash == nil || img.PHash == nil || utils.HammingDistance(*keep.PHash, *img.PHash) > distance {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "图片 " + strconv.FormatUint(uint64(img.ID), 10) + " 与保留的图片不相似"})
+			return
+		}
+	}
+
+	deleted := make([]uint, 0, len(trash))
+	for i := range trash {
+		if err := deleteImage(c.Request.Context(), &trash[i]); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "删除失败", "deleted": deleted})
+			return
+		}
+		deleted = append(deleted, trash[i].ID)
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "处理成功", "keep": keep.ID, "deleted": deleted})
+}
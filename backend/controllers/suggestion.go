@@ -0,0 +1,98 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"smart-gallery-backend/database"
+	"smart-gallery-backend/models"
+	"smart-gallery-backend/workers"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// errSuggestionDecided 建议已被接受或拒绝
+var errSuggestionDecided = errors.New("suggestion already decided")
+
+// GetTagSuggestions 返回图片的标签建议，默认只返回待确认的；status=all 返回全部
+func GetTagSuggestions(c *gin.Context) {
+	image, ok := findImage(c)
+	if !ok {
+		return
+	}
+	db := database.DB.Where("image_id = ?", image.ID)
+	switch status := c.DefaultQuery("status", models.SuggestionPending); status {
+	case "all":
+	case models.SuggestionPending, models.SuggestionAccepted, models.SuggestionRejected:
+		db = db.Where("status = ?", status)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "status 只能是 pending、accepted、rejected 或 all"})
+		return
+	}
+	var suggestions []models.TagSuggestion
+	if err := db.Order("confidence DESC").Order("id").Find(&suggestions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取标签建议失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": suggestions})
+}
+
+// AcceptTagSuggestion 接受建议，将其作为用户确认的标签追加到图片上
+func AcceptTagSuggestion(c *gin.Context) {
+	decideTagSuggestion(c, models.SuggestionAccepted)
+}
+
+// RejectTagSuggestion 拒绝建议，之后重新分析也不会再次建议该标签
+func RejectTagSuggestion(c *gin.Context) {
+	decideTagSuggestion(c, models.SuggestionRejected)
+}
+
+func decideTagSuggestion(c *gin.Context, status string) {
+	image, ok := findImage(c)
+	if !ok {
+		return
+	}
+	var suggestion models.TagSuggestion
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND image_id = ?", c.Param("suggestionId"), image.ID).
+			First(&suggestion).Error; err != nil {
+			return err
+		}
+		if suggestion.Status != models.SuggestionPending {
+			return errSuggestionDecided
+		}
+		if status == models.SuggestionAccepted {
+			current, err := database.ImageTagEntries(tx, image.ID)
+			if err != nil {
+				return err
+			}
+			entry := models.TagEntry{Name: suggestion.Name, Source: models.TagSourceUser}
+			if err := database.ReplaceImageTags(tx, image.ID, append(current, entry)); err != nil {
+				return err
+			}
+			if err := workers.EnqueueEmbeddingRefresh(tx, image.ID); err != nil {
+				return err
+			}
+		}
+		suggestion.Status = status
+		if err := tx.Save(&suggestion).Error; err != nil {
+			return err
+		}
+		return tx.First(image, image.ID).Error
+	})
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "标签建议不存在"})
+		return
+	case errors.Is(err, errSuggestionDecided):
+		c.JSON(http.StatusConflict, gin.H{"error": "该建议已处理", "suggestion": suggestion})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "处理标签建议失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "处理成功", "suggestion": suggestion, "image": image})
+}
@@ -0,0 +1,43 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"smart-gallery-backend/models"
+	"smart-gallery-backend/utils"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// AnalysisCache 基于 ai_cache_entries 表的视觉模型结果缓存
+type AnalysisCache struct{}
+
+func (AnalysisCache) Get(ctx context.Context, key utils.AnalysisCacheKey) (string, bool, error) {
+	var entry models.AICacheEntry
+	err := DB.WithContext(ctx).
+		Where("content_hash = ? AND provider = ? AND model = ? AND prompt_version = ?",
+			key.ContentHash, key.Provider, key.Model, key.PromptVersion).
+		First(&entry).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	DB.Model(&entry).UpdateColumn("hits", gorm.Expr("hits + 1"))
+	return entry.Response, true, nil
+}
+
+func (AnalysisCache) Put(ctx context.Context, key utils.AnalysisCacheKey, raw string) error {
+	entry := models.AICacheEntry{
+		ContentHash:   key.ContentHash,
+		Provider:      key.Provider,
+		Model:         key.Model,
+		PromptVersion: key.PromptVersion,
+		Response:      raw,
+	}
+	return DB.WithContext(ctx).Clauses(clause.OnConflict{
+		DoUpdates: clause.AssignmentColumns([]string{"response", "updated_at"}),
+	}).Create(&entry).Error
+}
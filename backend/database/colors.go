@@ -0,0 +1,47 @@
+package database
+
+import (
+	"smart-gallery-backend/models"
+	"smart-gallery-backend/utils"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// ImageColorsFromPalette 将提取到的主色调转换为 image_colors 记录（未设置 ImageID）
+func ImageColorsFromPalette(palette []utils.PaletteColor) []models.ImageColor {
+	rows := make([]models.ImageColor, len(palette))
+	for i, c := range palette {
+		rows[i] = models.ImageColor{Position: i, Hex: c.Hex, Ratio: c.Ratio, L: c.L, A: c.A, B: c.B}
+	}
+	return rows
+}
+
+// PaletteString 按顺序拼接主色调的十六进制值，写入 images.palette
+func PaletteString(rows []models.ImageColor) string {
+	hexes := make([]string, len(rows))
+	for i, c := range rows {
+		hexes[i] = c.Hex
+	}
+	return strings.Join(hexes, ",")
+}
+
+// ReplaceImageColors 用 rows 覆盖图片的主色调，同时更新 images.palette 冗余字段
+func ReplaceImageColors(tx *gorm.DB, imageID uint, rows []models.ImageColor) error {
+	return tx.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("image_id = ?", imageID).Delete(&models.ImageColor{}).Error; err != nil {
+			return err
+		}
+		if len(rows) > 0 {
+			copies := make([]models.ImageColor, len(rows))
+			for i, r := range rows {
+				r.ImageID = imageID
+				copies[i] = r
+			}
+			if err := tx.Create(&copies).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Model(&models.Image{}).Where("id = ?", imageID).Update("palette", PaletteString(rows)).Error
+	})
+}
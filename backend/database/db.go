@@ -5,6 +5,7 @@ import (
 	"log"
 	"os"
 	"smart-gallery-backend/models" // 引用下面的 models 包
+	"strings"
 
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
@@ -39,10 +40,98 @@ func Connect() {
 
 	// 自动迁移模式：自动创建或更新数据库表结构
 	// 这里注册所有的 Model
-	err = connection.AutoMigrate(&models.User{}, &models.Image{})
+	err = connection.AutoMigrate(
+		&models.User{},
+		&models.Image{},
+		&models.Blob{},
+		&models.AnalysisJob{},
+		&models.AnalysisBatch{},
+		&models.RenditionJob{},
+		&models.EmbeddingJob{},
+		&models.Tag{},
+		&models.ImageTag{},
+		&models.Album{},
+		&models.AlbumImage{},
+		&models.ImageRendition{},
+		&models.ImageEdit{},
+		&models.ImageColor{},
+		&models.SimilarPair{},
+		&models.ImageEmbedding{},
+		&models.TagSuggestion{},
+		&models.AICacheEntry{},
+	)
 	if err != nil {
 		log.Fatal("数据库迁移失败:", err)
 	}
 
+	if err := migrateLegacyTags(connection); err != nil {
+		log.Fatal("标签迁移失败:", err)
+	}
+
+	// 为已有图片补全去重列；同一用户已存在的重复内容只保留最早的一张参与唯一索引
+	err = connection.Exec(`UPDATE images JOIN (
+		SELECT MIN(id) AS id FROM images
+		WHERE deleted_at IS NULL AND content_hash <> '' GROUP BY user_id, content_hash
+	) earliest ON earliest.id = images.id
+	SET images.dedup_hash = images.content_hash
+	WHERE images.dedup_hash IS NULL`).Error
+	if err != nil {
+		log.Fatal("去重列迁移失败:", err)
+	}
+
+	if err := migrateLocation(connection); err != nil {
+		log.Fatal("空间索引迁移失败:", err)
+	}
+
+	if err := promoteAdmins(connection); err != nil {
+		log.Fatal("设置管理员失败:", err)
+	}
+
+	// 旧数据只有 "宽x高" 字符串，补全像素尺寸以支持按分辨率排序
+	err = connection.Exec(`UPDATE images SET
+		width = CAST(SUBSTRING_INDEX(resolution, 'x', 1) AS UNSIGNED),
+		height = CAST(SUBSTRING_INDEX(resolution, 'x', -1) AS UNSIGNED),
+		pixels = CAST(SUBSTRING_INDEX(resolution, 'x', 1) AS UNSIGNED) * CAST(SUBSTRING_INDEX(resolution, 'x', -1) AS UNSIGNED)
+		WHERE pixels = 0 AND resolution REGEXP '^[0-9]+x[0-9]+$'`).Error
+	if err != nil {
+		log.Fatal("分辨率迁移失败:", err)
+	}
+
 	DB = connection
 }
+
+// promoteAdmins 将 ADMIN_USERS（逗号分隔的用户名）中的用户设为管理员
+func promoteAdmins(db *gorm.DB) error {
+	var names []string
+	for _, name := range strings.Split(getEnv("ADMIN_USERS", ""), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	return db.Model(&models.User{}).Where("username IN ?", names).Update("is_admin", true).Error
+}
+
+// migrateLocation 为 images 添加由经纬度生成的 location 列（POINT SRID 4326）和空间索引，供地图按范围检索。
+// 空间索引要求列非空，没有定位或坐标越界的图片记为 POINT(0 0)，查询时另以 latitude IS NOT NULL 排除；
+// SRID 4326 的坐标顺序为（纬度, 经度）。
+func migrateLocation(db *gorm.DB) error {
+	m := db.Migrator()
+	if m.HasIndex(&models.Image{}, "idx_image_geo") {
+		if err := m.DropIndex(&models.Image{}, "idx_image_geo"); err != nil {
+			return err
+		}
+	}
+	if m.HasColumn(&models.Image{}, "location") {
+		return nil
+	}
+	return db.Exec(`ALTER TABLE images
+		ADD COLUMN location POINT SRID 4326 GENERATED ALWAYS AS (
+			IF(latitude BETWEEN -90 AND 90 AND longitude BETWEEN -180 AND 180,
+				ST_SRID(POINT(latitude, longitude), 4326),
+				ST_SRID(POINT(0, 0), 4326))
+		) STORED NOT NULL,
+		ADD SPATIAL INDEX idx_image_location (location)`).Error
+}
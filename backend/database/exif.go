@@ -0,0 +1,53 @@
+package database
+
+import (
+	"smart-gallery-backend/models"
+	"smart-gallery-backend/utils"
+)
+
+// ApplyExif 将提取到的 EXIF 信息写入图片记录的对应字段（不保存）
+func ApplyExif(img *models.Image, d utils.ExifData) {
+	img.CameraModel = d.CameraModel
+	img.ShootingTime = d.ShootingTime
+	img.Resolution = d.Resolution
+	img.Aperture = d.Aperture
+	img.ISO = d.ISO
+	img.Width, img.Height = d.Dimensions()
+	img.Pixels = int64(img.Width) * int64(img.Height)
+
+	img.Make = d.Make
+	img.LensModel = d.LensModel
+	img.Software = d.Software
+	img.FocalLength = d.FocalLength
+	img.FocalLength35mm = d.FocalLength35mm
+	img.ExposureTime = d.ExposureTime
+	img.ExposureBias = d.ExposureBias
+	img.Flash = d.Flash
+	img.WhiteBalance = d.WhiteBalance
+	img.Orientation = d.Orientation
+	img.Latitude, img.Longitude, img.Altitude = d.Latitude, d.Longitude, d.Altitude
+}
+
+// ExifFromImage 由已保存的字段还原 EXIF 信息，用于复用同一内容的分析结果
+func ExifFromImage(img *models.Image) utils.ExifData {
+	return utils.ExifData{
+		CameraModel:     img.CameraModel,
+		ShootingTime:    img.ShootingTime,
+		Resolution:      img.Resolution,
+		Aperture:        img.Aperture,
+		ISO:             img.ISO,
+		Make:            img.Make,
+		LensModel:       img.LensModel,
+		Software:        img.Software,
+		FocalLength:     img.FocalLength,
+		FocalLength35mm: img.FocalLength35mm,
+		ExposureTime:    img.ExposureTime,
+		ExposureBias:    img.ExposureBias,
+		Flash:           img.Flash,
+		WhiteBalance:    img.WhiteBalance,
+		Orientation:     img.Orientation,
+		Latitude:        img.Latitude,
+		Longitude:       img.Longitude,
+		Altitude:        img.Altitude,
+	}
+}
@@ -0,0 +1,34 @@
+package database
+
+import (
+	"smart-gallery-backend/models"
+
+	"gorm.io/gorm"
+)
+
+// ReplaceImageRenditions 用 rows 覆盖图片的派生图记录，rows 可以来自同一内容的其他图片
+func ReplaceImageRenditions(tx *gorm.DB, imageID uint, rows []models.ImageRendition) error {
+	return tx.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("image_id = ?", imageID).Delete(&models.ImageRendition{}).Error; err != nil {
+			return err
+		}
+		if len(rows) == 0 {
+			return nil
+		}
+		copies := CopyRenditions(rows)
+		for i := range copies {
+			copies[i].ImageID = imageID
+		}
+		return tx.Create(&copies).Error
+	})
+}
+
+// CopyRenditions 复制派生图记录（清空 ID 和 ImageID），用于关联到另一张图片
+func CopyRenditions(rows []models.ImageRendition) []models.ImageRendition {
+	out := make([]models.ImageRendition, len(rows))
+	for i, r := range rows {
+		r.ID, r.ImageID = 0, 0
+		out[i] = r
+	}
+	return out
+}
@@ -0,0 +1,58 @@
+package database
+
+import (
+	"smart-gallery-backend/models"
+	"smart-gallery-backend/utils"
+
+	"gorm.io/gorm"
+)
+
+// TagEntriesFromLabels 将模型给出的标签转换为带置信度的 AI 标签
+func TagEntriesFromLabels(labels []utils.LabelResult) []models.TagEntry {
+	entries := make([]models.TagEntry, len(labels))
+	for i, l := range labels {
+		conf := l.Confidence
+		entries[i] = models.TagEntry{Name: l.Label, Source: models.TagSourceAI, Confidence: &conf}
+	}
+	return entries
+}
+
+// ReplaceTagSuggestions 用新的分析结果替换图片待确认的标签建议。
+// 已接受或拒绝过的标签不再重复建议，已是图片标签的也会跳过。
+func ReplaceTagSuggestions(tx *gorm.DB, imageID uint, labels []utils.LabelResult) error {
+	if err := tx.Where("image_id = ? AND status = ?", imageID, models.SuggestionPending).Delete(&models.TagSuggestion{}).Error; err != nil {
+		return err
+	}
+	if len(labels) == 0 {
+		return nil
+	}
+
+	var decided []string
+	if err := tx.Model(&models.TagSuggestion{}).Where("image_id = ?", imageID).Pluck("name", &decided).Error; err != nil {
+		return err
+	}
+	current, err := ImageTagEntries(tx, imageID)
+	if err != nil {
+		return err
+	}
+	skip := make(map[string]bool, len(decided)+len(current))
+	for _, name := range decided {
+		skip[name] = true
+	}
+	for _, e := range current {
+		skip[e.Name] = true
+	}
+
+	var rows []models.TagSuggestion
+	for _, l := range labels {
+		if skip[l.Label] {
+			continue
+		}
+		skip[l.Label] = true
+		rows = append(rows, models.TagSuggestion{ImageID: imageID, Name: l.Label, Confidence: l.Confidence, Status: models.SuggestionPending})
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+	return tx.Create(&rows).Error
+}
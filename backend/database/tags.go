@@ -0,0 +1,141 @@
+package database
+
+import (
+	"log"
+	"smart-gallery-backend/models"
+	"smart-gallery-backend/utils"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ImageTagEntries 按顺序返回图片的标签及来源
+func ImageTagEntries(tx *gorm.DB, imageID uint) ([]models.TagEntry, error) {
+	var entries []models.TagEntry
+	err := tx.Table("image_tags").
+		Select("tags.name AS name, image_tags.source AS source, image_tags.confidence AS confidence").
+		Joins("JOIN tags ON tags.id = image_tags.tag_id").
+		Where("image_tags.image_id = ?", imageID).
+		Order("image_tags.position").
+		Scan(&entries).Error
+	return entries, err
+}
+
+// ReplaceImageTags 用 entries 覆盖图片的全部标签，同时更新 images.tags 冗余字段以兼容旧接口。
+// 同名标签只保留第一次出现时的来源。
+func ReplaceImageTags(tx *gorm.DB, imageID uint, entries []models.TagEntry) error {
+	entries = normalizeEntries(entries)
+
+	if err := tx.Where("image_id = ?", imageID).Delete(&models.ImageTag{}).Error; err != nil {
+		return err
+	}
+
+	names := make([]string, len(entries))
+	for i, e := range entries {
+		names[i] = e.Name
+	}
+
+	if len(entries) > 0 {
+		ids, err := ensureTags(tx, names)
+		if err != nil {
+			return err
+		}
+		rows := make([]models.ImageTag, len(entries))
+		for i, e := range entries {
+			rows[i] = models.ImageTag{ImageID: imageID, TagID: ids[e.Name], Source: e.Source, Position: i, Confidence: e.Confidence}
+		}
+		if err := tx.Create(&rows).Error; err != nil {
+			return err
+		}
+	}
+
+	return tx.Model(&models.Image{}).Where("id = ?", imageID).Update("tags", strings.Join(names, ",")).Error
+}
+
+// TagEntriesFromString 将逗号分隔的标签字符串转换为同一来源的标签列表
+func TagEntriesFromString(tags string, source string) []models.TagEntry {
+	var entries []models.TagEntry
+	for _, name := range strings.Split(tags, ",") {
+		entries = append(entries, models.TagEntry{Name: name, Source: source})
+	}
+	return normalizeEntries(entries)
+}
+
+// TagValue 返回 "分类:值" 形式标签的值部分
+func TagValue(name string) string {
+	if i := strings.Index(name, ":"); i >= 0 && i < len(name)-1 {
+		return name[i+1:]
+	}
+	return name
+}
+
+// ensureTags 确保标签存在并返回名称到 ID 的映射
+func ensureTags(tx *gorm.DB, names []string) (map[string]uint, error) {
+	tags := make([]models.Tag, len(names))
+	for i, n := range names {
+		tags[i] = models.Tag{Name: n, Value: TagValue(n)}
+	}
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&tags).Error; err != nil {
+		return nil, err
+	}
+
+	var existing []models.Tag
+	if err := tx.Where("name IN ?", names).Find(&existing).Error; err != nil {
+		return nil, err
+	}
+	ids := make(map[string]uint, len(existing))
+	for _, t := range existing {
+		ids[t.Name] = t.ID
+	}
+	return ids, nil
+}
+
+func normalizeEntries(entries []models.TagEntry) []models.TagEntry {
+	seen := map[string]struct{}{}
+	out := make([]models.TagEntry, 0, len(entries))
+	for _, e := range entries {
+		e.Name = strings.TrimSpace(e.Name)
+		if e.Name == "" {
+			continue
+		}
+		if _, ok := seen[e.Name]; ok {
+			continue
+		}
+		seen[e.Name] = struct{}{}
+		out = append(out, e)
+	}
+	return out
+}
+
+// migrateLegacyTags 将旧版逗号拼接的 tags 字段拆分写入 image_tags，可重复执行。
+// EXIF 推导的 "分类:值" 标签记为 exif，其余记为 ai。
+func migrateLegacyTags(db *gorm.DB) error {
+	var images []models.Image
+	migrated := 0
+	err := db.Where("tags <> ''").
+		Where("NOT EXISTS (SELECT 1 FROM image_tags WHERE image_tags.image_id = images.id)").
+		FindInBatches(&images, 200, func(tx *gorm.DB, batch int) error {
+			for _, img := range images {
+				var entries []models.TagEntry
+				for _, name := range strings.FieldsFunc(img.Tags, func(r rune) bool { return r == ',' || r == '，' }) {
+					source := models.TagSourceAI
+					if utils.IsExifTag(name) {
+						source = models.TagSourceExif
+					}
+					entries = append(entries, models.TagEntry{Name: name, Source: source})
+				}
+				if err := db.Transaction(func(tx *gorm.DB) error {
+					return ReplaceImageTags(tx, img.ID, entries)
+				}); err != nil {
+					return err
+				}
+				migrated++
+			}
+			return nil
+		}).Error
+	if migrated > 0 {
+		log.Printf("已迁移 %d 张图片的旧版标签", migrated)
+	}
+	return err
+}
@@ -1,17 +1,36 @@
 package main
 
 import (
+	"context"
+	"log"
+	"os"
 	"smart-gallery-backend/controllers"
 	"smart-gallery-backend/database"
 	"smart-gallery-backend/middlewares"
 	"smart-gallery-backend/utils"
+	"smart-gallery-backend/workers"
 
 	"github.com/gin-gonic/gin"
 )
 
 func main() {
 	database.Connect()
-	utils.InitMinio()
+	utils.InitStorage()
+
+	// 维护命令：go run . <命令>
+	if len(os.Args) > 1 {
+		runCommand(os.Args[1])
+		return
+	}
+
+	utils.InitVision()
+	utils.AICache = database.AnalysisCache{}
+	utils.InitEmbedding()
+	workers.InitVectorIndex(context.Background())
+	workers.StartAnalysisWorkers()
+	workers.StartRenditionWorkers()
+	workers.StartEmbeddingWorkers()
+	workers.StartSimilarityWorker()
 
 	r := gin.Default()
 
@@ -28,6 +47,11 @@ func main() {
 		c.Next()
 	})
 
+	// 本地存储模式下由后端直接提供对象访问
+	if local, ok := utils.Store.(*utils.LocalStorage); ok {
+		r.Static(local.URLPrefix, local.Root)
+	}
+
 	// 公开路由
 	auth := r.Group("/api/auth")
 	{
@@ -42,15 +66,78 @@ func main() {
 		mcp.GET("/stats", controllers.GetGalleryStats)
 	}
 
+	// 管理员路由
+	admin := r.Group("/api/admin")
+	admin.Use(middlewares.AuthMiddleware(), middlewares.AdminMiddleware())
+	{
+		admin.GET("/ai-cache", controllers.GetAICacheStats)
+		admin.DELETE("/ai-cache", controllers.InvalidateAICache)
+	}
+
 	// 受保护路由
 	protected := r.Group("/api")
 	protected.Use(middlewares.AuthMiddleware())
 	{
 		protected.POST("/images/upload", controllers.UploadImage)
 		protected.GET("/images", controllers.GetImages)
+		protected.GET("/images/geo", controllers.GetImagesGeo)
+		protected.GET("/images/search/semantic", controllers.SearchImagesSemantic)
+		protected.GET("/images/similar", controllers.GetSimilarImages)
+		protected.POST("/images/similar/resolve", controllers.ResolveSimilarImages)
 		protected.DELETE("/images/:id", controllers.DeleteImage)
 		protected.PUT("/images/:id/tags", controllers.UpdateImageTags)
+		protected.GET("/images/:id/tags", controllers.GetImageTags)
+		protected.PUT("/images/:id/caption", controllers.UpdateImageCaption)
+		protected.POST("/images/:id/analyze", controllers.AnalyzeImage)
+		protected.GET("/images/:id/suggestions", controllers.GetTagSuggestions)
+		protected.POST("/images/:id/suggestions/:suggestionId/accept", controllers.AcceptTagSuggestion)
+		protected.POST("/images/:id/suggestions/:suggestionId/reject", controllers.RejectTagSuggestion)
+		protected.GET("/images/:id/render", controllers.RenderImage)
+		protected.GET("/images/:id/render/sign", controllers.SignImageRender)
+		protected.GET("/images/:id/edits", controllers.GetImageEdits)
+		protected.POST("/images/:id/edits", controllers.CreateImageEdit)
+		protected.POST("/images/:id/edits/revert", controllers.RevertImageEdit)
+
+		protected.GET("/analysis/batches", controllers.GetAnalysisBatches)
+		protected.POST("/analysis/batches", controllers.CreateAnalysisBatch)
+		protected.GET("/analysis/batches/:id", controllers.GetAnalysisBatch)
+
+		protected.GET("/albums", controllers.GetAlbums)
+		protected.POST("/albums", controllers.CreateAlbum)
+		protected.PUT("/albums/order", controllers.ReorderAlbums)
+		protected.GET("/albums/:id", controllers.GetAlbum)
+		protected.PUT("/albums/:id", controllers.UpdateAlbum)
+		protected.DELETE("/albums/:id", controllers.DeleteAlbum)
+		protected.POST("/albums/:id/snapshot", controllers.SnapshotAlbum)
+		protected.GET("/albums/:id/images", controllers.GetAlbumImages)
+		protected.POST("/albums/:id/images", controllers.AddAlbumImages)
+		protected.PUT("/albums/:id/images/order", controllers.ReorderAlbumImages)
+		protected.DELETE("/albums/:id/images/:imageId", controllers.RemoveAlbumImage)
 	}
 
 	r.Run(":8080")
 }
+
+// runCommand 执行一次性维护命令后退出
+func runCommand(name string) {
+	ctx := context.Background()
+	var err error
+	switch name {
+	case "backfill-exif":
+		err = workers.BackfillExif(ctx)
+	case "regen-renditions":
+		err = workers.RegenerateRenditions(ctx)
+	case "backfill-phash":
+		err = workers.BackfillPHash(ctx)
+	case "backfill-palette":
+		err = workers.BackfillPalette(ctx)
+	case "reindex-embeddings":
+		utils.InitEmbedding()
+		err = workers.ReindexEmbeddings(ctx)
+	default:
+		log.Fatalf("未知命令: %s（可用命令: backfill-exif, regen-renditions, backfill-phash, backfill-palette, reindex-embeddings）", name)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// AICacheEntry 视觉模型对某一图片内容的原始输出，按 (内容哈希, 提供方, 模型, 提示词版本) 唯一
+type AICacheEntry struct {
+	ID            uint      `gorm:"primarykey" json:"id"`
+	ContentHash   string    `gorm:"size:64;not null;uniqueIndex:idx_ai_cache,priority:1" json:"content_hash"`
+	Provider      string    `gorm:"size:32;not null;uniqueIndex:idx_ai_cache,priority:2" json:"provider"`
+	Model         string    `gorm:"size:128;not null;uniqueIndex:idx_ai_cache,priority:3" json:"model"`
+	PromptVersion string    `gorm:"size:64;not null;uniqueIndex:idx_ai_cache,priority:4;index" json:"prompt_version"`
+	Response      string    `gorm:"type:text" json:"response"`
+	Hits          int       `gorm:"not null;default:0" json:"hits"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
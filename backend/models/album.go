@@ -0,0 +1,37 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 相册类型
+const (
+	AlbumStatic = "static" // 手动维护图片
+	AlbumSmart  = "smart"  // 按保存的检索语句实时计算成员
+)
+
+// Album 相册：图片的有序分组，一张图片可以属于多个相册
+type Album struct {
+	gorm.Model
+	UserID       uint   `gorm:"index" json:"user_id"`
+	Name         string `gorm:"size:191;not null" json:"name"`
+	Description  string `json:"description"`
+	CoverImageID *uint  `json:"cover_image_id"` // 为空时使用相册中的第一张图片
+	Position     int    `json:"position"`       // 相册在列表中的顺序
+	// 智能相册的检索语句，语法同 GET /api/images 的 q 参数
+	Kind  string `gorm:"size:16;not null;default:static" json:"kind"`
+	Query string `gorm:"type:text" json:"query"`
+	// 以下字段仅用于接口返回
+	ImageCount int64  `gorm:"-" json:"image_count"`
+	CoverUrl   string `gorm:"-" json:"cover_url"`
+}
+
+// AlbumImage 相册与图片的关联，删除相册只删除关联，不删除图片
+type AlbumImage struct {
+	AlbumID   uint      `gorm:"primaryKey;autoIncrement:false" json:"album_id"`
+	ImageID   uint      `gorm:"primaryKey;autoIncrement:false;index" json:"image_id"`
+	Position  int       `json:"position"` // 图片在相册中的顺序
+	CreatedAt time.Time `json:"created_at"`
+}
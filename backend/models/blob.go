@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// Blob 按 SHA-256 去重后的原图对象，多个 Image 记录可以共享同一个 Blob
+type Blob struct {
+	Hash         string `gorm:"primaryKey;size:64" json:"hash"`
+	OriginalKey  string `json:"original_key"`
+	ThumbnailKey string `json:"thumbnail_key"`
+	Size         int64  `json:"size"`
+	ContentType  string `json:"content_type"`
+	RefCount     int    `gorm:"not null;default:0" json:"ref_count"` // 引用该对象的图片数量
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
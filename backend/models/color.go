@@ -0,0 +1,12 @@
+package models
+
+// ImageColor 图片主色调中的一种颜色，L/A/B 为 CIELAB 坐标，用于按色差检索
+type ImageColor struct {
+	ImageID  uint    `gorm:"primaryKey;autoIncrement:false" json:"-"`
+	Position int     `gorm:"primaryKey;autoIncrement:false" json:"-"`
+	Hex      string  `gorm:"size:7" json:"hex"`
+	Ratio    float64 `json:"ratio"` // 所占比例 0~1
+	L        float64 `json:"-"`
+	A        float64 `json:"-"`
+	B        float64 `json:"-"`
+}
@@ -0,0 +1,21 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// ImageEdit 图片的一个编辑版本。每次保存编辑都会新增版本，
+// 渲染结果写入独立的对象，原图对象从不改动。
+type ImageEdit struct {
+	ID           uint            `gorm:"primarykey" json:"-"`
+	ImageID      uint            `gorm:"uniqueIndex:idx_image_edit" json:"-"`
+	Version      int             `gorm:"uniqueIndex:idx_image_edit" json:"version"`
+	Operations   json.RawMessage `gorm:"type:text" json:"operations"` // 作用于原图的完整操作列表
+	Width        int             `json:"width"`
+	Height       int             `json:"height"`
+	Key          string          `gorm:"size:512" json:"-"` // 渲染结果在对象存储中的 key
+	Url          string          `json:"url"`
+	ThumbnailUrl string          `json:"thumbnail_url"`
+	CreatedAt    time.Time       `json:"created_at"`
+}
@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// ImageEmbedding 图片的语义向量（小端 float32 序列）。TextVector 由标签等文本生成，
+// ImageVector 由图片内容生成，提供方不支持图片时为空；检索使用两者之和归一化后的向量。
+type ImageEmbedding struct {
+	ImageID     uint      `gorm:"primaryKey;autoIncrement:false" json:"image_id"`
+	Model       string    `gorm:"size:128;index" json:"model"` // 提供方/模型，模型变化后需要重建
+	TextVector  []byte    `json:"-"`
+	ImageVector []byte    `json:"-"`
+	UpdatedAt   time.Time `gorm:"index" json:"updated_at"`
+}
@@ -1,18 +1,80 @@
 package models
 
-import "gorm.io/gorm"
+import (
+	"encoding/json"
+
+	"gorm.io/gorm"
+)
+
+// 图片的 AI 分析状态
+const (
+	AnalysisPending    = "pending"
+	AnalysisProcessing = "processing"
+	AnalysisDone       = "done"
+	AnalysisFailed     = "failed"
+	AnalysisSkipped    = "skipped" // 未配置 AI 提供方，没有排队分析
+)
 
 type Image struct {
 	gorm.Model
-	UserID       uint   `json:"user_id"`
+	UserID       uint   `gorm:"uniqueIndex:idx_image_user_hash,priority:1" json:"user_id"`
 	FileName     string `json:"file_name"`
 	Url          string `json:"url"`
-	Tags         string `json:"tags"` // AI 标签
+	Tags         string `json:"tags"` // 逗号拼接的标签，由 image_tags 同步生成
 	ThumbnailUrl string `json:"thumbnail_url"`
+	ContentHash  string `gorm:"size:64;index" json:"content_hash"` // 原图 SHA-256，旧数据为空
+	// 未删除图片的内容哈希，删除时置空；与 UserID 组成唯一索引，保证同一用户不会重复保存相同内容
+	DedupHash *string `gorm:"size:64;uniqueIndex:idx_image_user_hash,priority:2" json:"-"`
 	// EXIF信息字段
 	CameraModel  string `json:"camera_model"`
 	ShootingTime string `json:"shooting_time"`
 	Resolution   string `json:"resolution"`
 	Aperture     string `json:"aperture"`
 	ISO          string `json:"iso"`
+	// 像素尺寸，用于按分辨率排序
+	Width  int   `json:"width"`
+	Height int   `json:"height"`
+	Pixels int64 `gorm:"index" json:"pixels"`
+	// 感知哈希（dHash），用于查找相似图片；尚未计算时为空
+	PHash *uint64 `gorm:"column:phash;index" json:"phash,string,omitempty"`
+	// 是否已由后台 worker 计算过相似图片对
+	SimilarIndexed bool `gorm:"not null;default:false;index" json:"-"`
+	// 主色调，逗号拼接的十六进制颜色（按占比从高到低），由 image_colors 同步生成
+	Palette string       `gorm:"size:64" json:"palette"`
+	Colors  []ImageColor `gorm:"foreignKey:ImageID" json:"-"`
+	// 按颜色检索时的色差，仅在检索结果中出现
+	ColorDistance *float64 `gorm:"->;-:migration" json:"color_distance,omitempty"`
+	// 静态相册内的位置，仅在相册图片列表中出现
+	AlbumPosition *int `gorm:"->;-:migration" json:"album_position,omitempty"`
+	// 语义检索时与检索文本的余弦相似度，仅在检索结果中出现
+	Score *float32 `gorm:"-" json:"score,omitempty"`
+	// 扩展 EXIF 信息：焦距单位毫米，曝光时间单位秒，曝光补偿单位 EV，海拔单位米
+	Make            string   `gorm:"size:64" json:"make"`
+	LensModel       string   `gorm:"size:128" json:"lens_model"`
+	Software        string   `gorm:"size:128" json:"software"`
+	FocalLength     float64  `json:"focal_length"`
+	FocalLength35mm int      `gorm:"column:focal_length_35mm" json:"focal_length_35mm"`
+	ExposureTime    float64  `json:"exposure_time"`
+	ExposureBias    float64  `json:"exposure_bias"`
+	Flash           *bool    `json:"flash"`
+	WhiteBalance    string   `gorm:"size:16" json:"white_balance"`
+	Orientation     int      `json:"orientation"`
+	Latitude        *float64 `json:"latitude"`
+	Longitude       *float64 `json:"longitude"`
+	Altitude        *float64 `json:"altitude"`
+	// 经纬度另有由数据库生成的 location 列（POINT SRID 4326）及空间索引，见 database.migrateLocation
+	// AI 生成的中文一句话描述和英文替代文本；用户修改过后 CaptionEdited 为 true，重新分析不再覆盖
+	Description   string `gorm:"type:text" json:"description"`
+	AltText       string `gorm:"size:512" json:"alt_text"`
+	CaptionEdited bool   `gorm:"not null;default:false" json:"caption_edited"`
+	// AI 分析状态: pending / processing / done / failed
+	AnalysisStatus string `gorm:"size:16;not null;default:done" json:"analysis_status"`
+	// 派生图，列表接口按需加载；Srcset 为 格式 -> "url 200w, url 1200w"
+	Renditions []ImageRendition  `gorm:"foreignKey:ImageID" json:"renditions,omitempty"`
+	Srcset     map[string]string `gorm:"-" json:"srcset,omitempty"`
+	// 当前编辑版本，0 表示原图；编辑后的图片和缩略图另存，Url / ThumbnailUrl 始终指向原图
+	EditVersion        int             `gorm:"not null;default:0" json:"edit_version"`
+	EditOps            json.RawMessage `gorm:"type:text" json:"edit_ops,omitempty"`
+	EditedUrl          string          `json:"edited_url,omitempty"`
+	EditedThumbnailUrl string          `json:"edited_thumbnail_url,omitempty"`
 }
@@ -0,0 +1,64 @@
+package models
+
+import "time"
+
+// 分析任务状态
+const (
+	JobPending = "pending" // 等待执行（包括等待重试）
+	JobRunning = "running" // 已被某个 worker 领取
+	JobDone    = "done"    // 执行成功
+	JobDead    = "dead"    // 超过最大重试次数，进入死信状态
+)
+
+// AnalysisJob 持久化的 AI 分析任务，由后台 worker 池领取执行
+type AnalysisJob struct {
+	ID        uint       `gorm:"primarykey" json:"id"`
+	ImageID   uint       `gorm:"index" json:"image_id"`
+	Status    string     `gorm:"size:16;index:idx_job_poll,priority:1" json:"status"`
+	NextRunAt time.Time  `gorm:"index:idx_job_poll,priority:2" json:"next_run_at"`
+	Attempts  int        `json:"attempts"`
+	LastError string     `gorm:"type:text" json:"last_error"`
+	LockedAt  *time.Time `json:"locked_at"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	// 所属的批量重新分析任务，上传时创建的任务为空
+	BatchID *uint `gorm:"index" json:"batch_id,omitempty"`
+}
+
+// AnalysisBatch 批量重新分析任务，进度由其下各分析任务的状态汇总得到
+type AnalysisBatch struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	UserID    uint      `gorm:"index" json:"user_id"`
+	Query     string    `gorm:"type:text" json:"query,omitempty"` // 按检索语句选择图片时的语句
+	Total     int       `json:"total"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// RenditionJob 派生图生成任务：上传或切换编辑版本后由后台 worker 为图片当前版本生成各尺寸派生图，
+// 完成前列表接口不返回 srcset，客户端使用原图或缩略图
+type RenditionJob struct {
+	ID          uint       `gorm:"primarykey" json:"id"`
+	ImageID     uint       `gorm:"index" json:"image_id"`
+	EditVersion int        `json:"edit_version"` // 入队时图片的编辑版本，执行时版本已变化则跳过
+	Status      string     `gorm:"size:16;index:idx_rendition_job_poll,priority:1" json:"status"`
+	NextRunAt   time.Time  `gorm:"index:idx_rendition_job_poll,priority:2" json:"next_run_at"`
+	Attempts    int        `json:"attempts"`
+	LastError   string     `gorm:"type:text" json:"last_error"`
+	LockedAt    *time.Time `json:"locked_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// EmbeddingJob 文本向量刷新任务：标签或描述修改后由后台 worker 重新生成文本向量，
+// 向量服务不可用时按 NextRunAt 重试，修改不会丢失
+type EmbeddingJob struct {
+	ID        uint       `gorm:"primarykey" json:"id"`
+	ImageID   uint       `gorm:"index" json:"image_id"`
+	Status    string     `gorm:"size:16;index:idx_embedding_job_poll,priority:1" json:"status"`
+	NextRunAt time.Time  `gorm:"index:idx_embedding_job_poll,priority:2" json:"next_run_at"`
+	Attempts  int        `json:"attempts"`
+	LastError string     `gorm:"type:text" json:"last_error"`
+	LockedAt  *time.Time `json:"locked_at"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
@@ -0,0 +1,15 @@
+package models
+
+// ImageRendition 图片的派生图：某个尺寸、某种格式的一份编码结果。
+// 共享同一 Blob 的图片各自保存一份记录，但指向相同的对象。
+type ImageRendition struct {
+	ID      uint   `gorm:"primaryKey" json:"-"`
+	ImageID uint   `gorm:"uniqueIndex:idx_rendition" json:"-"`
+	Name    string `gorm:"size:32;uniqueIndex:idx_rendition" json:"name"`   // grid / preview / full 等
+	Format  string `gorm:"size:16;uniqueIndex:idx_rendition" json:"format"` // jpeg / webp / avif
+	Width   int    `json:"width"`
+	Height  int    `json:"height"`
+	Size    int64  `json:"size"`
+	Key     string `gorm:"size:512" json:"-"` // 对象存储中的 key
+	Url     string `json:"url"`
+}
@@ -0,0 +1,9 @@
+package models
+
+// SimilarPair 同一用户的两张感知哈希相近的图片，由后台 worker 预先计算；ImageID 总是小于 OtherID
+type SimilarPair struct {
+	ImageID  uint `gorm:"primaryKey;autoIncrement:false" json:"image_id"`
+	OtherID  uint `gorm:"primaryKey;autoIncrement:false;index" json:"other_id"`
+	UserID   uint `gorm:"index:idx_similar_user,priority:1" json:"-"`
+	Distance int  `gorm:"index:idx_similar_user,priority:2" json:"distance"` // 汉明距离
+}
@@ -0,0 +1,55 @@
+package models
+
+import "time"
+
+// 标签来源
+const (
+	TagSourceAI   = "ai"   // 视觉模型识别
+	TagSourceExif = "exif" // 由 EXIF 信息推导
+	TagSourceUser = "user" // 用户手动添加
+)
+
+// Tag 标签实体，名称全局唯一
+type Tag struct {
+	ID   uint   `gorm:"primarykey" json:"id"`
+	Name string `gorm:"size:191;not null;uniqueIndex" json:"name"`
+	// Value 为 "分类:值" 形式标签中冒号后的部分（普通标签与 Name 相同），用于按值精确检索
+	Value string `gorm:"size:191;not null;index" json:"value"`
+}
+
+// ImageTag 图片与标签的多对多关联
+type ImageTag struct {
+	ImageID   uint      `gorm:"primaryKey;autoIncrement:false" json:"image_id"`
+	TagID     uint      `gorm:"primaryKey;autoIncrement:false;index" json:"tag_id"`
+	Source    string    `gorm:"size:16;not null" json:"source"`
+	Position  int       `json:"position"` // 标签在图片上的顺序
+	CreatedAt time.Time `json:"created_at"`
+	// AI 标签的置信度（0-1），其他来源为空
+	Confidence *float64 `json:"confidence,omitempty"`
+}
+
+// TagEntry 图片上的一个标签及其来源
+type TagEntry struct {
+	Name       string   `json:"name"`
+	Source     string   `json:"source"`
+	Confidence *float64 `json:"confidence,omitempty"`
+}
+
+// 标签建议状态
+const (
+	SuggestionPending  = "pending"
+	SuggestionAccepted = "accepted"
+	SuggestionRejected = "rejected"
+)
+
+// TagSuggestion 置信度低于阈值的 AI 标签，由用户接受后才成为图片标签；
+// 被拒绝的建议会保留下来，重新分析时不再提出
+type TagSuggestion struct {
+	ID         uint      `gorm:"primarykey" json:"id"`
+	ImageID    uint      `gorm:"not null;uniqueIndex:idx_image_suggestion" json:"image_id"`
+	Name       string    `gorm:"size:191;not null;uniqueIndex:idx_image_suggestion" json:"name"`
+	Confidence float64   `json:"confidence"`
+	Status     string    `gorm:"size:16;not null;default:pending;index" json:"status"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
@@ -9,5 +9,6 @@ type User struct {
 	gorm.Model        // 包含 ID, CreatedAt, UpdatedAt, DeletedAt
 	Username   string `gorm:"unique;not null" json:"username"`
 	Email      string `gorm:"unique;not null" json:"email"`
-	Password   string `json:"password"` // 存储哈希后的密码
-}
\ No newline at end of file
+	Password   string `json:"password"`                               // 存储哈希后的密码
+	IsAdmin    bool   `gorm:"not null;default:false" json:"is_admin"` // 管理员，可由 ADMIN_USERS 指定
+}
@@ -1,163 +1,270 @@
 package utils
 
 import (
-	"bufio"
-	"bytes"
-	"encoding/base64"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"log"
-	"net/http"
 	"strings"
 	"time"
 )
 
-const (
-	// 智谱 AI 配置
-	ZhipuAPIKey = "7f373589ee5340ea873da5a358d71fb7.TCLlpo4Q1c9xoH4t"
-	ZhipuAPIURL = "https://open.bigmodel.cn/api/paas/v4/chat/completions"
-)
-
-// Request 结构体 (流式请求)
-type ZhipuRequest struct {
-	Model    string    `json:"model"`
-	Messages []Message `json:"messages"`
-	Stream   bool      `json:"stream"` // 启用流式传输
+// VisionProvider 视觉模型提供方：根据图片和提示词返回模型输出的原始文本
+type VisionProvider interface {
+	Name() string
+	Model() string
+	Analyze(ctx context.Context, image []byte, prompt string) (string, error)
 }
 
-type Message struct {
-	Role    string        `json:"role"`
-	Content []ContentPart `json:"content"`
+// AIConfig 视觉模型配置，全部来自环境变量
+type AIConfig struct {
+	Provider string        // zhipu / openai / stub
+	Model    string        // 模型名称，留空使用各提供方默认值
+	APIKey   string        // 访问密钥
+	BaseURL  string        // 接口地址，留空使用各提供方默认值
+	Prompt   string        // 提示词，留空时根据词表生成
+	Timeout  time.Duration // 单次请求超时
+	// 受控标签词表文件，留空使用内置词表；置信度达到 Threshold 的标签直接应用，其余作为建议
+	TaxonomyFile string
+	Threshold    float64
+	// 提示词版本，作为结果缓存键的一部分；留空时取提示词的哈希
+	PromptVersion string
 }
 
-type ContentPart struct {
-	Type     string    `json:"type"`
-	Text     string    `json:"text,omitempty"`
-	ImageURL *ImageURL `json:"image_url,omitempty"`
-}
+// AIConfigFromEnv 读取 AI_* 环境变量；未设置 AI_PROVIDER 时有密钥则使用 zhipu，
+// 否则 Provider 为空，表示不启用分析。离线 stub 只能通过 AI_PROVIDER=stub 显式启用。
+func AIConfigFromEnv() AIConfig {
+	cfg := AIConfig{
+		Provider: strings.ToLower(GetEnv("AI_PROVIDER", "")),
+		Model:    GetEnv("AI_MODEL", ""),
+		APIKey:   GetEnv("AI_API_KEY", ""),
+		BaseURL:  GetEnv("AI_BASE_URL", ""),
+		Prompt:   GetEnv("AI_PROMPT", ""),
+		Timeout:  GetEnvDuration("AI_TIMEOUT", 60*time.Second),
 
-type ImageURL struct {
-	URL string `json:"url"`
+		TaxonomyFile:  GetEnv("AI_TAXONOMY_FILE", ""),
+		Threshold:     float64(GetEnvInt("AI_TAG_THRESHOLD", 60)) / 100,
+		PromptVersion: GetEnv("AI_PROMPT_VERSION", ""),
+	}
+	if cfg.Provider == "" && cfg.APIKey != "" {
+		cfg.Provider = "zhipu"
+	}
+	return cfg
 }
 
-// StreamResponse 结构体 (解析流式响应块)
-type ZhipuStreamResponse struct {
-	Choices []struct {
-		Delta struct {
-			Content string `json:"content"`
-		} `json:"delta"`
-		FinishReason string `json:"finish_reason"`
-	} `json:"choices"`
+// NewVisionProvider 根据配置创建视觉模型提供方
+func NewVisionProvider(cfg AIConfig) (VisionProvider, error) {
+	switch cfg.Provider {
+	case "zhipu":
+		if cfg.APIKey == "" {
+			return nil, fmt.Errorf("zhipu 提供方需要配置 AI_API_KEY")
+		}
+		return NewZhipuProvider(cfg), nil
+	case "openai":
+		if cfg.BaseURL == "" {
+			return nil, fmt.Errorf("openai 兼容提供方需要配置 AI_BASE_URL")
+		}
+		// 各兼容服务的模型名称不同，没有通用的默认值，未配置时请求会被服务端拒绝
+		if cfg.Model == "" {
+			return nil, fmt.Errorf("openai 兼容提供方需要配置 AI_MODEL")
+		}
+		return NewOpenAIProvider(cfg), nil
+	case "stub":
+		return NewStubProvider(), nil
+	default:
+		return nil, fmt.Errorf("未知的 AI 提供方: %s", cfg.Provider)
+	}
 }
 
-// AnalyzeImage 调用智谱GLM-4V分析图片内容
-func AnalyzeImage(fileData []byte) string {
-	log.Println("正在调用智谱GLM-4V分析图片...")
-
-	// 将图片转换为Base64
-	base64Str := base64.StdEncoding.EncodeToString(fileData)
-	imgDataURL := fmt.Sprintf("data:image/jpeg;base64,%s", base64Str)
-
-	// 构造请求
-	requestBody := ZhipuRequest{
-		Model:  "glm-4v-flash",
-		Stream: true,
-		Messages: []Message{
-			{
-				Role: "user",
-				Content: []ContentPart{
-					{
-						Type: "image_url",
-						ImageURL: &ImageURL{
-							URL: imgDataURL,
-						},
-					},
-					{
-						Type: "text",
-						Text: "请分析这张图片，提取唯一一个最描述画面内容的关键标签（例如：风景）。请直接返回标签，不要包含任何其他解释性文字。",
-					},
-				},
-			},
-		},
-	}
-
-	jsonData, _ := json.Marshal(requestBody)
-
-	// 发送HTTP请求
-	req, err := http.NewRequest("POST", ZhipuAPIURL, bytes.NewBuffer(jsonData))
-	if err != nil {
-		log.Println("创建请求失败:", err)
-		return "AI请求失败"
-	}
+// ErrVisionDisabled 未配置视觉模型提供方
+var ErrVisionDisabled = errors.New("AI 分析未启用")
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+ZhipuAPIKey)
+var (
+	// Vision 当前使用的视觉模型提供方，由 InitVision 初始化；未配置提供方时为 nil，不进行分析
+	Vision VisionProvider
+	// visionPrompt 当前使用的提示词
+	visionPrompt string
+	// taxonomy 当前使用的受控标签词表
+	taxonomy *Taxonomy
+	// TagThreshold 标签直接应用所需的最低置信度，低于该值的标签作为建议
+	TagThreshold = 0.6
+)
 
-	client := &http.Client{Timeout: 60 * time.Second}
-	resp, err := client.Do(req)
+// InitVision 根据环境变量初始化视觉模型提供方。未配置提供方时不启用分析，
+// 而不是悄悄改用 stub：stub 的固定结果会被当作真实标签和描述保存并写入缓存。
+func InitVision() {
+	cfg := AIConfigFromEnv()
+	if cfg.Provider == "" {
+		log.Println("警告: 未配置 AI_PROVIDER 或 AI_API_KEY，AI 分析已停用，上传的图片不排队分析（analysis_status 为 skipped）；开发和测试环境可设置 AI_PROVIDER=stub")
+		return
+	}
+	p, err := NewVisionProvider(cfg)
+	if err != nil {
+		log.Fatalln("AI 提供方初始化失败:", err)
+	}
+	t, err := LoadTaxonomy(cfg.TaxonomyFile)
 	if err != nil {
-		log.Println("API连接失败:", err)
-		return "网络错误"
+		log.Fatalln("标签词表加载失败:", err)
+	}
+	Vision = p
+	taxonomy = t
+	visionPrompt = cfg.Prompt
+	if visionPrompt == "" {
+		visionPrompt = AnalysisPrompt(t)
+	}
+	TagThreshold = cfg.Threshold
+	promptVersion = cfg.PromptVersion
+	if promptVersion == "" {
+		promptVersion = promptHash(visionPrompt)
 	}
-	defer resp.Body.Close()
+	log.Printf("AI 提供方: %s (%s)，词表 %d 个标签，提示词版本 %s", p.Name(), p.Model(), len(t.Labels), promptVersion)
+}
 
-	if resp.StatusCode != 200 {
-		body, _ := io.ReadAll(resp.Body)
-		log.Printf("智谱API错误 (%d): %s", resp.StatusCode, string(body))
-		return "AI服务异常"
+// 描述与替代文本的最大长度（字符数）
+const (
+	MaxDescriptionLength = 500
+	MaxAltTextLength     = 250
+)
+
+// TruncateRunes 按字符截断字符串
+func TruncateRunes(s string, n int) string {
+	if r := []rune(s); len(r) > n {
+		return string(r[:n])
 	}
+	return s
+}
 
-	// 处理流式响应
-	reader := bufio.NewReader(resp.Body)
-	var fullContent strings.Builder
+// AnalysisResult 一次视觉分析的结果
+type AnalysisResult struct {
+	Labels      []LabelResult // 映射到词表后按置信度排序的标签
+	Description string        // 中文一句话描述
+	AltText     string        // 英文替代文本
+}
 
-	for {
-		line, err := reader.ReadBytes('\n')
+// AnalyzeImage 分析图片内容，返回标签和描述。contentHash 为原图内容哈希，非空时先查结果缓存，
+// 未命中再调用当前视觉模型并写入缓存。
+// 调用失败时返回错误，由调用方决定是否重试；模型没有给出可识别的内容时各字段为空。
+func AnalyzeImage(ctx context.Context, contentHash string, fileData []byte) (*AnalysisResult, error) {
+	if Vision == nil {
+		return nil, ErrVisionDisabled
+	}
+	key := AnalysisCacheKey{ContentHash: contentHash, Provider: Vision.Name(), Model: Vision.Model(), PromptVersion: promptVersion}
+	useCache := AICache != nil && contentHash != ""
+	if useCache {
+		raw, ok, err := AICache.Get(ctx, key)
 		if err != nil {
-			if err == io.EOF {
-				break
-			}
-			log.Println("读取流出错:", err)
-			break
+			log.Printf("读取 AI 结果缓存失败: %v", err)
+		} else if ok {
+			log.Printf("AI 结果缓存命中: %s", contentHash)
+			return ParseAnalysis(raw, taxonomy), nil
 		}
+	}
 
-		lineStr := strings.TrimSpace(string(line))
+	log.Printf("正在调用 %s 分析图片...", Vision.Name())
+	raw, err := Vision.Analyze(ctx, fileData, visionPrompt)
+	if err != nil {
+		return nil, err
+	}
 
-		if lineStr == "" || strings.HasPrefix(lineStr, ":") {
-			continue
+	result := ParseAnalysis(raw, taxonomy)
+	// 没有可用内容的输出不缓存，下次重新请求
+	if useCache && (len(result.Labels) > 0 || result.Description != "") {
+		if err := AICache.Put(ctx, key, raw); err != nil {
+			log.Printf("写入 AI 结果缓存失败: %v", err)
 		}
+	}
+	if len(result.Labels) > 0 {
+		log.Printf("AI识别成功: %v", result.Labels)
+	} else {
+		log.Printf("AI 输出中没有词表内的标签: %q", raw)
+	}
+	return result, nil
+}
 
-		if strings.HasPrefix(lineStr, "data: ") {
-			dataContent := strings.TrimPrefix(lineStr, "data: ")
-
-			if dataContent == "[DONE]" {
-				break
-			}
-
-			var streamResp ZhipuStreamResponse
-			if err := json.Unmarshal([]byte(dataContent), &streamResp); err != nil {
-				continue
-			}
+// AnalysisPrompt 生成要求模型从词表中多选标签、给出置信度并撰写中英文描述的提示词
+func AnalysisPrompt(t *Taxonomy) string {
+	return "请分析这张图片，从以下标签中选出所有符合画面内容的标签，并为每个标签给出 0 到 1 之间的置信度：" +
+		strings.Join(t.Labels, "、") +
+		"。再用一句中文描述画面内容，并写一句简洁的英文替代文本（alt text），供读屏软件使用。" +
+		"只返回 JSON，例如 {\"labels\":[{\"label\":\"风景\",\"confidence\":0.92}]," +
+		"\"description\":\"夕阳下的海滩上有几艘渔船\",\"alt_text\":\"Fishing boats on a beach at sunset\"}，不要包含任何其他文字。"
+}
 
-			if len(streamResp.Choices) > 0 {
-				content := streamResp.Choices[0].Delta.Content
-				fullContent.WriteString(content)
-			}
+// ParseAnalysis 解析模型输出。支持完整的 JSON 对象、只有标签的 JSON 数组
+// [{"label": "风景", "confidence": 0.9}]，以及逗号分隔的纯文本标签（置信度视为 1，兼容自定义提示词）。
+func ParseAnalysis(raw string, t *Taxonomy) *AnalysisResult {
+	var out struct {
+		Labels      []modelLabel `json:"labels"`
+		Description string       `json:"description"`
+		AltText     string       `json:"alt_text"`
+	}
+	s := stripModelMarkers(raw)
+	start := strings.IndexAny(s, "[{")
+	parsed := false
+	if start >= 0 && s[start] == '{' {
+		if end := strings.LastIndex(s, "}"); end > start {
+			parsed = json.Unmarshal([]byte(s[start:end+1]), &out) == nil
+		}
+	} else if start >= 0 {
+		if end := strings.LastIndex(s, "]"); end > start {
+			parsed = json.Unmarshal([]byte(s[start:end+1]), &out.Labels) == nil
 		}
 	}
 
-	resultTags := strings.TrimSpace(fullContent.String())
+	var labels []LabelResult
+	if parsed {
+		for _, l := range out.Labels {
+			labels = append(labels, l.result())
+		}
+	} else {
+		for _, label := range strings.Split(cleanModelOutput(raw), ",") {
+			labels = append(labels, LabelResult{Label: label, Confidence: 1})
+		}
+	}
+	return &AnalysisResult{
+		Labels:      t.MapLabels(labels),
+		Description: strings.TrimSpace(out.Description),
+		AltText:     strings.TrimSpace(out.AltText),
+	}
+}
 
-	if resultTags != "" {
-		resultTags = strings.ReplaceAll(resultTags, "。", "")
-		resultTags = strings.ReplaceAll(resultTags, "，", ",")
-		resultTags = strings.ReplaceAll(resultTags, "<|begin_of_box|>", "")
-		resultTags = strings.ReplaceAll(resultTags, "<|end_of_box|>", "")
+// modelLabel 模型输出的标签，兼容 name / score 的写法
+type modelLabel struct {
+	Label      string   `json:"label"`
+	Name       string   `json:"name"`
+	Confidence *float64 `json:"confidence"`
+	Score      *float64 `json:"score"`
+}
 
-		log.Printf("AI识别成功: %s", resultTags)
-		return resultTags
+func (l modelLabel) result() LabelResult {
+	r := LabelResult{Label: l.Label, Confidence: 1}
+	if r.Label == "" {
+		r.Label = l.Name
+	}
+	if l.Confidence != nil {
+		r.Confidence = *l.Confidence
+	} else if l.Score != nil {
+		r.Confidence = *l.Score
 	}
+	return r
+}
+
+// stripModelMarkers 去掉模型输出中的特殊标记和 Markdown 代码块标记，保留正文标点
+func stripModelMarkers(s string) string {
+	s = strings.ReplaceAll(s, "<|begin_of_box|>", "")
+	s = strings.ReplaceAll(s, "<|end_of_box|>", "")
+	s = strings.ReplaceAll(s, "```json", "")
+	s = strings.ReplaceAll(s, "```", "")
+	return strings.TrimSpace(s)
+}
 
-	return "未识别"
+// cleanModelOutput 去掉模型输出中的标点和特殊标记
+func cleanModelOutput(s string) string {
+	s = strings.TrimSpace(s)
+	s = strings.ReplaceAll(s, "。", "")
+	s = strings.ReplaceAll(s, "，", ",")
+	s = strings.ReplaceAll(s, "<|begin_of_box|>", "")
+	s = strings.ReplaceAll(s, "<|end_of_box|>", "")
+	return strings.TrimSpace(s)
 }
@@ -0,0 +1,38 @@
+package utils
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// AnalysisCacheKey 缓存键：同一内容在同一模型和提示词下的输出视为相同
+type AnalysisCacheKey struct {
+	ContentHash   string
+	Provider      string
+	Model         string
+	PromptVersion string
+}
+
+// AnalysisCache 视觉模型原始输出的持久化缓存
+type AnalysisCache interface {
+	// Get 返回缓存的输出，未命中时 ok 为 false
+	Get(ctx context.Context, key AnalysisCacheKey) (raw string, ok bool, err error)
+	Put(ctx context.Context, key AnalysisCacheKey, raw string) error
+}
+
+// AICache 当前使用的缓存，为空时不缓存；由 main 在数据库连接后设置
+var AICache AnalysisCache
+
+// PromptVersion 当前提示词版本；未配置 AI_PROMPT_VERSION 时取提示词的哈希，修改提示词即自动失效
+func PromptVersion() string {
+	return promptVersion
+}
+
+var promptVersion string
+
+// promptHash 提示词的短哈希
+func promptHash(prompt string) string {
+	sum := sha256.Sum256([]byte(prompt))
+	return hex.EncodeToString(sum[:6])
+}
@@ -0,0 +1,88 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// OpenAIProvider 通用的 OpenAI 兼容 chat/completions 客户端（vLLM、Ollama、各类网关等）
+type OpenAIProvider struct {
+	url    string
+	model  string
+	apiKey string
+	client *http.Client
+}
+
+type openAIChatRequest struct {
+	Model    string    `json:"model"`
+	Messages []Message `json:"messages"`
+}
+
+type openAIChatResponse struct {
+	Choices []struct {
+		Message struct {
+			Content string `json:"content"`
+		} `json:"message"`
+	} `json:"choices"`
+}
+
+// NewOpenAIProvider 创建 OpenAI 兼容客户端，BaseURL 形如 http://host:8000/v1
+func NewOpenAIProvider(cfg AIConfig) *OpenAIProvider {
+	url := strings.TrimRight(cfg.BaseURL, "/")
+	if !strings.HasSuffix(url, "/chat/completions") {
+		url += "/chat/completions"
+	}
+	return &OpenAIProvider{
+		url:    url,
+		model:  cfg.Model,
+		apiKey: cfg.APIKey,
+		client: &http.Client{Timeout: cfg.Timeout},
+	}
+}
+
+func (p *OpenAIProvider) Name() string  { return "openai" }
+func (p *OpenAIProvider) Model() string { return p.model }
+
+func (p *OpenAIProvider) Analyze(ctx context.Context, image []byte, prompt string) (string, error) {
+	jsonData, _ := json.Marshal(openAIChatRequest{
+		Model:    p.model,
+		Messages: visionMessages(image, prompt),
+	})
+
+	req, err := http.NewRequestWithContext(ctx, "POST", p.url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return "", fmt.Errorf("创建请求失败: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if p.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+p.apiKey)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("API连接失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("读取响应失败: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("模型接口错误 (%d): %s", resp.StatusCode, string(body))
+	}
+
+	var out openAIChatResponse
+	if err := json.Unmarshal(body, &out); err != nil {
+		return "", fmt.Errorf("解析响应失败: %w", err)
+	}
+	if len(out.Choices) == 0 {
+		return "", nil
+	}
+	return out.Choices[0].Message.Content, nil
+}
@@ -0,0 +1,49 @@
+package utils
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+)
+
+// stubLabels stub 提供方可能返回的标签
+var stubLabels = []string{"风景", "人像", "美食", "建筑", "动物", "植物", "夜景", "街拍"}
+
+// stubLabelsEn stub 标签对应的英文，用于生成替代文本
+var stubLabelsEn = map[string]string{
+	"风景": "landscape", "人像": "portrait", "美食": "food", "建筑": "architecture",
+	"动物": "animal", "植物": "plant", "夜景": "night", "街拍": "street",
+}
+
+// StubProvider 离线的确定性实现：同样的图片内容总是得到同样的标签，
+// 用于测试和无法访问外网的部署
+type StubProvider struct{}
+
+// NewStubProvider 创建 stub 提供方
+func NewStubProvider() *StubProvider { return &StubProvider{} }
+
+func (p *StubProvider) Name() string  { return "stub" }
+func (p *StubProvider) Model() string { return "stub-v1" }
+
+// Analyze 按多标签格式返回一个高置信度的主标签、一个低置信度的次要标签和模板化的描述
+func (p *StubProvider) Analyze(ctx context.Context, image []byte, prompt string) (string, error) {
+	sum := sha256.Sum256(image)
+	label := stubLabel(image)
+	second := stubLabels[binary.BigEndian.Uint32(sum[4:8])%uint32(len(stubLabels))]
+	out, err := json.Marshal(map[string]interface{}{
+		"labels": []LabelResult{
+			{Label: label, Confidence: 0.9},
+			{Label: second, Confidence: 0.4},
+		},
+		"description": "一张" + label + "照片",
+		"alt_text":    "A " + stubLabelsEn[label] + " photo",
+	})
+	return string(out), err
+}
+
+// stubLabel stub 视觉模型为图片给出的主标签
+func stubLabel(image []byte) string {
+	sum := sha256.Sum256(image)
+	return stubLabels[binary.BigEndian.Uint32(sum[:4])%uint32(len(stubLabels))]
+}
@@ -0,0 +1,130 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestStubProvider_Deterministic(t *testing.T) {
+	p := NewStubProvider()
+	a, err := p.Analyze(context.Background(), []byte("same bytes"), "prompt")
+	if err != nil {
+		t.Fatalf("stub 不应返回错误: %v", err)
+	}
+	b, _ := p.Analyze(context.Background(), []byte("same bytes"), "other prompt")
+	if a != b || a == "" {
+		t.Errorf("相同内容应得到相同标签: %q vs %q", a, b)
+	}
+}
+
+func TestNewVisionProvider(t *testing.T) {
+	if _, err := NewVisionProvider(AIConfig{Provider: "openai"}); err == nil {
+		t.Errorf("openai 提供方缺少 BaseURL 时应报错")
+	}
+	if _, err := NewVisionProvider(AIConfig{Provider: "openai", BaseURL: "http://localhost:8000/v1"}); err == nil {
+		t.Errorf("openai 提供方缺少 Model 时应报错")
+	}
+	if _, err := NewVisionProvider(AIConfig{Provider: "unknown"}); err == nil {
+		t.Errorf("未知提供方应报错")
+	}
+
+	if _, err := NewVisionProvider(AIConfig{Provider: "zhipu"}); err == nil {
+		t.Errorf("zhipu 提供方缺少密钥时应报错")
+	}
+
+	p, err := NewVisionProvider(AIConfig{Provider: "zhipu", APIKey: "test-key"})
+	if err != nil {
+		t.Fatalf("创建智谱提供方失败: %v", err)
+	}
+	if p.Model() != zhipuDefaultModel {
+		t.Errorf("未配置模型时应使用默认模型，实际: %s", p.Model())
+	}
+}
+
+func TestAIConfigFromEnv_NoImplicitStub(t *testing.T) {
+	t.Setenv("AI_PROVIDER", "")
+	t.Setenv("AI_API_KEY", "")
+	if cfg := AIConfigFromEnv(); cfg.Provider != "" {
+		t.Errorf("未配置提供方和密钥时不应启用分析，实际: %q", cfg.Provider)
+	}
+	t.Setenv("AI_API_KEY", "test-key")
+	if cfg := AIConfigFromEnv(); cfg.Provider != "zhipu" {
+		t.Errorf("只配置密钥时应使用 zhipu，实际: %q", cfg.Provider)
+	}
+	t.Setenv("AI_PROVIDER", "STUB")
+	if cfg := AIConfigFromEnv(); cfg.Provider != "stub" {
+		t.Errorf("显式设置 stub 时应使用 stub，实际: %q", cfg.Provider)
+	}
+}
+
+func TestAnalyzeImage_Disabled(t *testing.T) {
+	prev := Vision
+	Vision = nil
+	defer func() { Vision = prev }()
+	if _, err := AnalyzeImage(context.Background(), "hash", []byte("x")); !errors.Is(err, ErrVisionDisabled) {
+		t.Errorf("未启用分析时应返回 ErrVisionDisabled，实际: %v", err)
+	}
+}
+
+func TestCleanModelOutput(t *testing.T) {
+	got := cleanModelOutput(" <|begin_of_box|>风景，日落。<|end_of_box|>\n")
+	if got != "风景,日落" {
+		t.Errorf("清理结果不符: %q", got)
+	}
+}
+
+// countingProvider 记录调用次数的视觉模型
+type countingProvider struct {
+	StubProvider
+	calls int
+}
+
+func (p *countingProvider) Analyze(ctx context.Context, image []byte, prompt string) (string, error) {
+	p.calls++
+	return p.StubProvider.Analyze(ctx, image, prompt)
+}
+
+// memoryCache 内存中的结果缓存
+type memoryCache map[AnalysisCacheKey]string
+
+func (m memoryCache) Get(ctx context.Context, key AnalysisCacheKey) (string, bool, error) {
+	raw, ok := m[key]
+	return raw, ok, nil
+}
+
+func (m memoryCache) Put(ctx context.Context, key AnalysisCacheKey, raw string) error {
+	m[key] = raw
+	return nil
+}
+
+func TestAnalyzeImage_Cache(t *testing.T) {
+	oldVision, oldTaxonomy, oldCache, oldVersion := Vision, taxonomy, AICache, promptVersion
+	defer func() { Vision, taxonomy, AICache, promptVersion = oldVision, oldTaxonomy, oldCache, oldVersion }()
+
+	p := &countingProvider{}
+	cache := memoryCache{}
+	Vision, AICache, promptVersion = p, cache, "v1"
+	taxonomy, _ = LoadTaxonomy("")
+	ctx := context.Background()
+
+	first, err := AnalyzeImage(ctx, "hash-a", []byte("image a"))
+	if err != nil {
+		t.Fatalf("分析失败: %v", err)
+	}
+	second, _ := AnalyzeImage(ctx, "hash-a", []byte("image a"))
+	if p.calls != 1 || len(cache) != 1 {
+		t.Errorf("相同内容第二次应命中缓存，调用 %d 次，缓存 %d 条", p.calls, len(cache))
+	}
+	if second.Description != first.Description || len(second.Labels) != len(first.Labels) {
+		t.Errorf("缓存结果与首次结果不一致: %+v vs %+v", second, first)
+	}
+
+	// 提示词版本变化后重新请求；没有内容哈希时不使用缓存
+	promptVersion = "v2"
+	AnalyzeImage(ctx, "hash-a", []byte("image a"))
+	AnalyzeImage(ctx, "", []byte("image a"))
+	if p.calls != 3 || len(cache) != 2 {
+		t.Errorf("调用 %d 次，缓存 %d 条，期望 3 次、2 条", p.calls, len(cache))
+	}
+}
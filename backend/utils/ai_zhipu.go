@@ -0,0 +1,176 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+const (
+	// 智谱 AI 默认配置，密钥通过 AI_API_KEY 提供
+	zhipuDefaultURL   = "https://open.bigmodel.cn/api/paas/v4/chat/completions"
+	zhipuDefaultModel = "glm-4v-flash"
+)
+
+// Request 结构体 (流式请求)
+type ZhipuRequest struct {
+	Model    string    `json:"model"`
+	Messages []Message `json:"messages"`
+	Stream   bool      `json:"stream"` // 启用流式传输
+}
+
+type Message struct {
+	Role    string        `json:"role"`
+	Content []ContentPart `json:"content"`
+}
+
+type ContentPart struct {
+	Type     string    `json:"type"`
+	Text     string    `json:"text,omitempty"`
+	ImageURL *ImageURL `json:"image_url,omitempty"`
+}
+
+type ImageURL struct {
+	URL string `json:"url"`
+}
+
+// StreamResponse 结构体 (解析流式响应块)
+type ZhipuStreamResponse struct {
+	Choices []struct {
+		Delta struct {
+			Content string `json:"content"`
+		} `json:"delta"`
+		FinishReason string `json:"finish_reason"`
+	} `json:"choices"`
+}
+
+// ZhipuProvider 智谱 GLM-4V，使用流式接口
+type ZhipuProvider struct {
+	url    string
+	model  string
+	apiKey string
+	client *http.Client
+}
+
+// NewZhipuProvider 创建智谱客户端
+func NewZhipuProvider(cfg AIConfig) *ZhipuProvider {
+	p := &ZhipuProvider{
+		url:    cfg.BaseURL,
+		model:  cfg.Model,
+		apiKey: cfg.APIKey,
+		client: &http.Client{Timeout: cfg.Timeout},
+	}
+	if p.url == "" {
+		p.url = zhipuDefaultURL
+	}
+	if p.model == "" {
+		p.model = zhipuDefaultModel
+	}
+	return p
+}
+
+func (p *ZhipuProvider) Name() string  { return "zhipu" }
+func (p *ZhipuProvider) Model() string { return p.model }
+
+// Analyze 调用智谱GLM-4V分析图片内容
+func (p *ZhipuProvider) Analyze(ctx context.Context, image []byte, prompt string) (string, error) {
+	// 构造请求
+	requestBody := ZhipuRequest{
+		Model:    p.model,
+		Stream:   true,
+		Messages: visionMessages(image, prompt),
+	}
+
+	jsonData, _ := json.Marshal(requestBody)
+
+	// 发送HTTP请求
+	req, err := http.NewRequestWithContext(ctx, "POST", p.url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return "", fmt.Errorf("创建请求失败: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+p.apiKey)
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("API连接失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		body, _ := io.ReadAll(resp.Body)
+		return "", fmt.Errorf("智谱API错误 (%d): %s", resp.StatusCode, string(body))
+	}
+
+	// 处理流式响应
+	reader := bufio.NewReader(resp.Body)
+	var fullContent strings.Builder
+
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return "", fmt.Errorf("读取流出错: %w", err)
+		}
+
+		lineStr := strings.TrimSpace(string(line))
+
+		if lineStr == "" || strings.HasPrefix(lineStr, ":") {
+			continue
+		}
+
+		if strings.HasPrefix(lineStr, "data: ") {
+			dataContent := strings.TrimPrefix(lineStr, "data: ")
+
+			if dataContent == "[DONE]" {
+				break
+			}
+
+			var streamResp ZhipuStreamResponse
+			if err := json.Unmarshal([]byte(dataContent), &streamResp); err != nil {
+				continue
+			}
+
+			if len(streamResp.Choices) > 0 {
+				content := streamResp.Choices[0].Delta.Content
+				fullContent.WriteString(content)
+			}
+		}
+	}
+
+	return fullContent.String(), nil
+}
+
+// visionMessages 构造包含图片和提示词的用户消息
+func visionMessages(image []byte, prompt string) []Message {
+	// 将图片转换为Base64
+	base64Str := base64.StdEncoding.EncodeToString(image)
+	imgDataURL := fmt.Sprintf("data:image/jpeg;base64,%s", base64Str)
+
+	return []Message{
+		{
+			Role: "user",
+			Content: []ContentPart{
+				{
+					Type: "image_url",
+					ImageURL: &ImageURL{
+						URL: imgDataURL,
+					},
+				},
+				{
+					Type: "text",
+					Text: prompt,
+				},
+			},
+		},
+	}
+}
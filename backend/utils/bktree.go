@@ -0,0 +1,91 @@
+package utils
+
+// BKTree 按汉明距离组织的 BK 树，用于查找与感知哈希距离不超过阈值的图片，
+// 查询只访问满足三角不等式的子树，不必与每张图片逐一比较
+type BKTree struct {
+	root   *bkNode
+	hashes map[uint]uint64 // 图片 ID -> 哈希，删除时据此找到节点
+}
+
+type bkNode struct {
+	hash     uint64
+	ids      []uint // 哈希完全相同的图片
+	children map[int]*bkNode
+}
+
+// Add 加入一张图片的哈希
+func (t *BKTree) Add(id uint, hash uint64) {
+	if t.hashes == nil {
+		t.hashes = map[uint]uint64{}
+	}
+	t.hashes[id] = hash
+	if t.root == nil {
+		t.root = &bkNode{hash: hash, ids: []uint{id}}
+		return
+	}
+	node := t.root
+	for {
+		d := HammingDistance(node.hash, hash)
+		if d == 0 {
+			node.ids = append(node.ids, id)
+			return
+		}
+		child, ok := node.children[d]
+		if !ok {
+			if node.children == nil {
+				node.children = map[int]*bkNode{}
+			}
+			node.children[d] = &bkNode{hash: hash, ids: []uint{id}}
+			return
+		}
+		node = child
+	}
+}
+
+// Remove 移除一张图片，节点保留用于路由
+func (t *BKTree) Remove(id uint) {
+	hash, ok := t.hashes[id]
+	if !ok {
+		return
+	}
+	delete(t.hashes, id)
+	for node := t.root; node != nil; node = node.children[HammingDistance(node.hash, hash)] {
+		if node.hash == hash {
+			for i, x := range node.ids {
+				if x == id {
+					node.ids = append(node.ids[:i], node.ids[i+1:]...)
+					return
+				}
+			}
+			return
+		}
+	}
+}
+
+// Len 树中的图片数
+func (t *BKTree) Len() int {
+	return len(t.hashes)
+}
+
+// Search 对距离 hash 不超过 maxDist 的每张图片调用 fn
+func (t *BKTree) Search(hash uint64, maxDist int, fn func(id uint, dist int)) {
+	if t.root == nil {
+		return
+	}
+	stack := []*bkNode{t.root}
+	for len(stack) > 0 {
+		node := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		d := HammingDistance(node.hash, hash)
+		if d <= maxDist {
+			for _, id := range node.ids {
+				fn(id, d)
+			}
+		}
+		for cd, child := range node.children {
+			if cd >= d-maxDist && cd <= d+maxDist {
+				stack = append(stack, child)
+			}
+		}
+	}
+}
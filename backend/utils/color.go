@@ -0,0 +1,219 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/disintegration/imaging"
+)
+
+// PaletteColor 主色调中的一种颜色：sRGB 十六进制值、所占比例及其 CIELAB 坐标
+type PaletteColor struct {
+	Hex   string
+	Ratio float64
+	L     float64
+	A     float64
+	B     float64
+}
+
+const (
+	PaletteSize       = 5  // 每张图片保存的主色调数量
+	paletteSampleSize = 64 // 提取主色调前将图片缩小到的最大边长
+)
+
+// ExtractPalette 在 CIELAB 空间对缩小后的图片做 k-means 聚类，返回按占比从高到低排列的至多 k 种颜色。
+// 初始中心按最远点选取，结果是确定的。
+func ExtractPalette(img image.Image, k int) []PaletteColor {
+	small := imaging.Fit(img, paletteSampleSize, paletteSampleSize, imaging.Box)
+	var rgbs, labs [][3]float64
+	for i := 0; i+3 < len(small.Pix); i += 4 {
+		if small.Pix[i+3] < 128 {
+			continue // 忽略透明像素
+		}
+		r, g, b := small.Pix[i], small.Pix[i+1], small.Pix[i+2]
+		l, a, bb := RGBToLab(r, g, b)
+		rgbs = append(rgbs, [3]float64{float64(r), float64(g), float64(b)})
+		labs = append(labs, [3]float64{l, a, bb})
+	}
+	if len(labs) == 0 || k <= 0 {
+		return nil
+	}
+
+	// 初始中心：离平均色最近的像素，之后每次选离已有中心最远的像素
+	var mean [3]float64
+	for _, p := range labs {
+		for d := 0; d < 3; d++ {
+			mean[d] += p[d] / float64(len(labs))
+		}
+	}
+	centers := [][3]float64{labs[nearestCenter(mean, labs)]}
+	minDist := make([]float64, len(labs))
+	for i := range minDist {
+		minDist[i] = math.Inf(1)
+	}
+	for len(centers) < k {
+		far, farDist := -1, 0.0
+		for i, p := range labs {
+			minDist[i] = math.Min(minDist[i], labDistSq(p, centers[len(centers)-1]))
+			if minDist[i] > farDist {
+				far, farDist = i, minDist[i]
+			}
+		}
+		// 剩余像素都与已有中心相同，颜色种类不足 k 种
+		if far < 0 {
+			break
+		}
+		centers = append(centers, labs[far])
+	}
+
+	assign := make([]int, len(labs))
+	for iter := 0; iter < 20; iter++ {
+		changed := iter == 0
+		for i, p := range labs {
+			if c := nearestCenter(p, centers); c != assign[i] {
+				assign[i], changed = c, true
+			}
+		}
+		if !changed {
+			break
+		}
+		sums := make([][3]float64, len(centers))
+		counts := make([]int, len(centers))
+		for i, p := range labs {
+			for d := 0; d < 3; d++ {
+				sums[assign[i]][d] += p[d]
+			}
+			counts[assign[i]]++
+		}
+		for c := range centers {
+			if counts[c] > 0 {
+				for d := 0; d < 3; d++ {
+					centers[c][d] = sums[c][d] / float64(counts[c])
+				}
+			}
+		}
+	}
+
+	// 每个簇的显示颜色取成员的平均 sRGB
+	rgbSums := make([][3]float64, len(centers))
+	counts := make([]int, len(centers))
+	for i, p := range rgbs {
+		for d := 0; d < 3; d++ {
+			rgbSums[assign[i]][d] += p[d]
+		}
+		counts[assign[i]]++
+	}
+	var palette []PaletteColor
+	for c, n := range counts {
+		if n == 0 {
+			continue
+		}
+		r := uint8(math.Round(rgbSums[c][0] / float64(n)))
+		g := uint8(math.Round(rgbSums[c][1] / float64(n)))
+		b := uint8(math.Round(rgbSums[c][2] / float64(n)))
+		l, a, bb := RGBToLab(r, g, b)
+		palette = append(palette, PaletteColor{
+			Hex:   fmt.Sprintf("#%02x%02x%02x", r, g, b),
+			Ratio: math.Round(float64(n)/float64(len(labs))*1000) / 1000,
+			L:     l,
+			A:     a,
+			B:     bb,
+		})
+	}
+	sort.SliceStable(palette, func(i, j int) bool { return palette[i].Ratio > palette[j].Ratio })
+	return palette
+}
+
+func nearestCenter(p [3]float64, centers [][3]float64) int {
+	best, bestDist := 0, math.Inf(1)
+	for i, c := range centers {
+		if d := labDistSq(p, c); d < bestDist {
+			best, bestDist = i, d
+		}
+	}
+	return best
+}
+
+func labDistSq(a, b [3]float64) float64 {
+	dl, da, db := a[0]-b[0], a[1]-b[1], a[2]-b[2]
+	return dl*dl + da*da + db*db
+}
+
+// RGBToLab 将 sRGB 颜色转换为 CIELAB（D65 白点）
+func RGBToLab(r, g, b uint8) (l, a, bb float64) {
+	linear := func(c uint8) float64 {
+		v := float64(c) / 255
+		if v <= 0.04045 {
+			return v / 12.92
+		}
+		return math.Pow((v+0.055)/1.055, 2.4)
+	}
+	lr, lg, lb := linear(r), linear(g), linear(b)
+	x := (0.4124*lr + 0.3576*lg + 0.1805*lb) / 0.95047
+	y := 0.2126*lr + 0.7152*lg + 0.0722*lb
+	z := (0.0193*lr + 0.1192*lg + 0.9505*lb) / 1.08883
+
+	f := func(t float64) float64 {
+		if t > 216.0/24389 {
+			return math.Cbrt(t)
+		}
+		return (24389.0/27*t + 16) / 116
+	}
+	fx, fy, fz := f(x), f(y), f(z)
+	return 116*fy - 16, 500 * (fx - fy), 200 * (fy - fz)
+}
+
+// colorNames 可用于检索的颜色名称
+var colorNames = map[string]string{
+	"红": "#e53935", "red": "#e53935",
+	"橙": "#fb8c00", "orange": "#fb8c00",
+	"黄": "#fdd835", "yellow": "#fdd835",
+	"绿": "#43a047", "green": "#43a047",
+	"青": "#00acc1", "cyan": "#00acc1",
+	"蓝": "#1e88e5", "blue": "#1e88e5",
+	"紫": "#8e24aa", "purple": "#8e24aa",
+	"粉": "#f48fb1", "pink": "#f48fb1",
+	"棕": "#795548", "brown": "#795548",
+	"黑": "#111111", "black": "#111111",
+	"白": "#f5f5f5", "white": "#f5f5f5",
+	"灰": "#9e9e9e", "gray": "#9e9e9e", "grey": "#9e9e9e",
+}
+
+// ParseColor 解析 #rrggbb、rrggbb、#rgb 或颜色名称（红、蓝、blue 等，可带“色”字）
+func ParseColor(input string) (r, g, b uint8, err error) {
+	s := strings.ToLower(strings.TrimSpace(input))
+	if hex, ok := colorNames[strings.TrimSuffix(s, "色")]; ok {
+		s = hex
+	}
+	s = strings.TrimPrefix(s, "#")
+	if len(s) == 3 {
+		s = string([]byte{s[0], s[0], s[1], s[1], s[2], s[2]})
+	}
+	if len(s) != 6 {
+		return 0, 0, 0, errors.New("无法识别的颜色: " + input)
+	}
+	v, err := strconv.ParseUint(s, 16, 32)
+	if err != nil {
+		return 0, 0, 0, errors.New("无法识别的颜色: " + input)
+	}
+	return uint8(v >> 16), uint8(v >> 8), uint8(v), nil
+}
+
+// ColorSearchConfig 按颜色检索的匹配条件
+type ColorSearchConfig struct {
+	MaxDistance float64 // 主色调与目标颜色的最大 CIE76 色差
+	MinRatio    float64 // 参与匹配的主色调最少占比
+}
+
+// ColorSearchConfigFromEnv 读取 COLOR_MAX_DISTANCE（默认 30）和 COLOR_MIN_RATIO（百分比，默认 5）
+func ColorSearchConfigFromEnv() ColorSearchConfig {
+	return ColorSearchConfig{
+		MaxDistance: float64(GetEnvInt("COLOR_MAX_DISTANCE", 30)),
+		MinRatio:    float64(GetEnvInt("COLOR_MIN_RATIO", 5)) / 100,
+	}
+}
@@ -0,0 +1,51 @@
+package utils
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+func TestExtractPalette(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 100, 100))
+	for y := 0; y < 100; y++ {
+		for x := 0; x < 100; x++ {
+			c := color.NRGBA{R: 30, G: 90, B: 200, A: 255} // 蓝色占 70%
+			if x >= 70 {
+				c = color.NRGBA{R: 220, G: 40, B: 40, A: 255}
+			}
+			img.Set(x, y, c)
+		}
+	}
+	palette := ExtractPalette(img, PaletteSize)
+	if len(palette) != 2 {
+		t.Fatalf("应提取到 2 种颜色，实际 %d 种: %+v", len(palette), palette)
+	}
+	if palette[0].Hex != "#1e5ac8" || palette[1].Hex != "#dc2828" {
+		t.Errorf("颜色错误: %+v", palette)
+	}
+	if math.Abs(palette[0].Ratio-0.7) > 0.02 {
+		t.Errorf("占比错误: %v", palette[0].Ratio)
+	}
+}
+
+func TestParseColor(t *testing.T) {
+	cases := map[string][3]uint8{
+		"#ff8000": {255, 128, 0},
+		"ff8000":  {255, 128, 0},
+		"#f80":    {255, 136, 0},
+		"蓝":       {0x1e, 0x88, 0xe5},
+		"红色":      {0xe5, 0x39, 0x35},
+		"Blue":    {0x1e, 0x88, 0xe5},
+	}
+	for in, want := range cases {
+		r, g, b, err := ParseColor(in)
+		if err != nil || [3]uint8{r, g, b} != want {
+			t.Errorf("%s: 期望 %v，实际 %v %v", in, want, [3]uint8{r, g, b}, err)
+		}
+	}
+	if _, _, _, err := ParseColor("彩虹"); err == nil {
+		t.Error("未知颜色应当报错")
+	}
+}
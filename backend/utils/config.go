@@ -0,0 +1,48 @@
+package utils
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// GetEnv 返回环境变量或默认值
+func GetEnv(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+// GetEnvInt 读取整数型环境变量，解析失败时返回默认值
+func GetEnvInt(key string, def int) int {
+	if v, err := strconv.Atoi(strings.TrimSpace(os.Getenv(key))); err == nil {
+		return v
+	}
+	return def
+}
+
+// GetEnvInt64 读取 int64 型环境变量（常用于字节数）
+func GetEnvInt64(key string, def int64) int64 {
+	if v, err := strconv.ParseInt(strings.TrimSpace(os.Getenv(key)), 10, 64); err == nil {
+		return v
+	}
+	return def
+}
+
+// GetEnvBool 读取布尔型环境变量
+func GetEnvBool(key string, def bool) bool {
+	if v, err := strconv.ParseBool(strings.TrimSpace(os.Getenv(key))); err == nil {
+		return v
+	}
+	return def
+}
+
+// GetEnvDuration 读取时长型环境变量，例如 "30s"、"5m"
+func GetEnvDuration(key string, def time.Duration) time.Duration {
+	if v, err := time.ParseDuration(strings.TrimSpace(os.Getenv(key))); err == nil {
+		return v
+	}
+	return def
+}
@@ -0,0 +1,218 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+
+	"github.com/disintegration/imaging"
+)
+
+// maxEditOps 单个版本允许的最多操作数；maxFreeRotations 非直角旋转的最多次数，
+// 每次任意角度旋转都会放大画布并整图重采样
+const (
+	maxEditOps       = 50
+	maxFreeRotations = 2
+)
+
+// EditOp 一个编辑操作。坐标和尺寸以摆正方向后的原图像素为准，
+// 亮度、对比度取值 -100~100，饱和度 -100~500。
+type EditOp struct {
+	Op        string  `json:"op"` // crop / rotate / flip / brightness / contrast / saturation / filter
+	X         int     `json:"x,omitempty"`
+	Y         int     `json:"y,omitempty"`
+	Width     int     `json:"width,omitempty"`
+	Height    int     `json:"height,omitempty"`
+	Angle     float64 `json:"angle,omitempty"`     // rotate：逆时针角度
+	Direction string  `json:"direction,omitempty"` // flip：horizontal / vertical
+	Value     float64 `json:"value,omitempty"`
+	Filter    string  `json:"filter,omitempty"` // filter：grayscale / sepia / invert / blur / sharpen
+}
+
+// ParseEditOps 解析并校验操作列表
+func ParseEditOps(raw []byte) ([]EditOp, error) {
+	var ops []EditOp
+	if len(raw) > 0 {
+		if err := json.Unmarshal(raw, &ops); err != nil {
+			return nil, errors.New("操作列表格式错误")
+		}
+	}
+	if len(ops) > maxEditOps {
+		return nil, fmt.Errorf("操作不能超过 %d 个", maxEditOps)
+	}
+	freeRotations := 0
+	for i, op := range ops {
+		if err := op.validate(); err != nil {
+			return nil, fmt.Errorf("第 %d 个操作: %w", i+1, err)
+		}
+		if op.Op == "rotate" && !rightAngle(op.Angle) {
+			if freeRotations++; freeRotations > maxFreeRotations {
+				return nil, fmt.Errorf("非直角旋转不能超过 %d 次", maxFreeRotations)
+			}
+		}
+	}
+	return ops, nil
+}
+
+func (op EditOp) validate() error {
+	switch op.Op {
+	case "crop":
+		if op.X < 0 || op.Y < 0 || op.Width <= 0 || op.Height <= 0 {
+			return errors.New("裁剪区域无效")
+		}
+	case "rotate":
+		if math.IsNaN(op.Angle) || math.IsInf(op.Angle, 0) {
+			return errors.New("旋转角度无效")
+		}
+	case "flip":
+		if op.Direction != "horizontal" && op.Direction != "vertical" {
+			return errors.New("direction 只能是 horizontal 或 vertical")
+		}
+	case "brightness", "contrast":
+		if op.Value < -100 || op.Value > 100 {
+			return errors.New("取值范围为 -100~100")
+		}
+	case "saturation":
+		if op.Value < -100 || op.Value > 500 {
+			return errors.New("取值范围为 -100~500")
+		}
+	case "filter":
+		switch op.Filter {
+		case "grayscale", "sepia", "invert":
+		case "blur", "sharpen":
+			if op.Value < 0 || op.Value > 20 {
+				return errors.New("滤镜强度范围为 0~20")
+			}
+		default:
+			return fmt.Errorf("不支持的滤镜: %s", op.Filter)
+		}
+	default:
+		return fmt.Errorf("不支持的操作: %s", op.Op)
+	}
+	return nil
+}
+
+// ApplyEdits 依次执行操作，返回新图片，不修改输入。与解码共用并发槽位；
+// maxPixels 大于 0 时，任意一步的结果超过该像素数即中止（旋转在分配画布前按预计尺寸检查）
+func ApplyEdits(img image.Image, ops []EditOp, maxPixels int64) (image.Image, error) {
+	decodeSlots <- struct{}{}
+	defer func() { <-decodeSlots }()
+
+	tooLarge := func(i, w, h int) error {
+		if maxPixels > 0 && int64(w)*int64(h) > maxPixels {
+			return fmt.Errorf("第 %d 个操作: 结果尺寸 %dx%d 超过像素上限", i+1, w, h)
+		}
+		return nil
+	}
+	for i, op := range ops {
+		if op.Op == "rotate" {
+			w, h := rotatedSize(img.Bounds().Dx(), img.Bounds().Dy(), op.Angle)
+			if err := tooLarge(i, w, h); err != nil {
+				return nil, err
+			}
+		}
+		switch op.Op {
+		case "crop":
+			rect := image.Rect(op.X, op.Y, op.X+op.Width, op.Y+op.Height).Intersect(image.Rect(0, 0, img.Bounds().Dx(), img.Bounds().Dy()))
+			if rect.Empty() {
+				return nil, fmt.Errorf("第 %d 个操作: 裁剪区域超出图片范围", i+1)
+			}
+			img = imaging.Crop(img, rect)
+		case "rotate":
+			img = rotate(img, op.Angle)
+		case "flip":
+			if op.Direction == "horizontal" {
+				img = imaging.FlipH(img)
+			} else {
+				img = imaging.FlipV(img)
+			}
+		case "brightness":
+			img = imaging.AdjustBrightness(img, op.Value)
+		case "contrast":
+			img = imaging.AdjustContrast(img, op.Value)
+		case "saturation":
+			img = imaging.AdjustSaturation(img, op.Value)
+		case "filter":
+			img = applyFilter(img, op)
+		}
+		if err := tooLarge(i, img.Bounds().Dx(), img.Bounds().Dy()); err != nil {
+			return nil, err
+		}
+	}
+	return img, nil
+}
+
+// rightAngle 角度是否为 90° 的整数倍，这类旋转无损且不改变像素数
+func rightAngle(angle float64) bool {
+	return math.Mod(angle, 90) == 0
+}
+
+// rotatedSize 旋转 angle 度后容纳整张图片所需的画布尺寸
+func rotatedSize(w, h int, angle float64) (int, int) {
+	if rightAngle(angle) {
+		if math.Mod(angle, 180) == 0 {
+			return w, h
+		}
+		return h, w
+	}
+	sin, cos := math.Sincos(angle * math.Pi / 180)
+	sin, cos = math.Abs(sin), math.Abs(cos)
+	fw, fh := float64(w), float64(h)
+	return int(math.Ceil(fw*cos + fh*sin)), int(math.Ceil(fw*sin + fh*cos))
+}
+
+// rotate 直角旋转无损处理，其他角度空白处填充白色
+func rotate(img image.Image, angle float64) image.Image {
+	a := math.Mod(angle, 360)
+	if a < 0 {
+		a += 360
+	}
+	switch a {
+	case 0:
+		return img
+	case 90:
+		return imaging.Rotate90(img)
+	case 180:
+		return imaging.Rotate180(img)
+	case 270:
+		return imaging.Rotate270(img)
+	}
+	return imaging.Rotate(img, a, color.White)
+}
+
+func applyFilter(img image.Image, op EditOp) image.Image {
+	switch op.Filter {
+	case "grayscale":
+		return imaging.Grayscale(img)
+	case "invert":
+		return imaging.Invert(img)
+	case "blur":
+		return imaging.Blur(img, defaultStrength(op.Value, 2))
+	case "sharpen":
+		return imaging.Sharpen(img, defaultStrength(op.Value, 1))
+	}
+	// sepia：标准的棕褐色变换矩阵
+	return imaging.AdjustFunc(img, func(c color.NRGBA) color.NRGBA {
+		r, g, b := float64(c.R), float64(c.G), float64(c.B)
+		return color.NRGBA{
+			R: clampByte(0.393*r + 0.769*g + 0.189*b),
+			G: clampByte(0.349*r + 0.686*g + 0.168*b),
+			B: clampByte(0.272*r + 0.534*g + 0.131*b),
+			A: c.A,
+		}
+	})
+}
+
+func defaultStrength(v, def float64) float64 {
+	if v == 0 {
+		return def
+	}
+	return v
+}
+
+func clampByte(v float64) uint8 {
+	return uint8(math.Min(255, math.Max(0, v+0.5)))
+}
@@ -0,0 +1,67 @@
+package utils
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestParseEditOps(t *testing.T) {
+	ops, err := ParseEditOps([]byte(`[{"op":"crop","x":10,"y":10,"width":100,"height":50},{"op":"rotate","angle":90},{"op":"filter","filter":"sepia"}]`))
+	if err != nil || len(ops) != 3 {
+		t.Fatalf("解析失败: %v %+v", err, ops)
+	}
+	for _, raw := range []string{
+		`{"op":"crop"}`,
+		`[{"op":"resize"}]`,
+		`[{"op":"crop","x":0,"y":0,"width":0,"height":10}]`,
+		`[{"op":"flip","direction":"diagonal"}]`,
+		`[{"op":"brightness","value":150}]`,
+		`[{"op":"filter","filter":"vintage"}]`,
+		`[{"op":"rotate","angle":1},{"op":"rotate","angle":2},{"op":"rotate","angle":3}]`,
+	} {
+		if _, err := ParseEditOps([]byte(raw)); err == nil {
+			t.Errorf("%s 应当被拒绝", raw)
+		}
+	}
+}
+
+func TestApplyEdits(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(0, 0, 400, 300))
+	src.Set(0, 0, color.NRGBA{R: 255, A: 255})
+
+	out, err := ApplyEdits(src, []EditOp{
+		{Op: "crop", X: 0, Y: 0, Width: 200, Height: 100},
+		{Op: "rotate", Angle: -90},
+		{Op: "flip", Direction: "horizontal"},
+		{Op: "brightness", Value: 10},
+	}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := out.Bounds(); b.Dx() != 100 || b.Dy() != 200 {
+		t.Fatalf("期望 100x200，实际 %dx%d", b.Dx(), b.Dy())
+	}
+	// 左上角的红点经顺时针旋转和水平翻转后仍在左上角
+	if r, _, _, _ := out.At(0, 0).RGBA(); r>>8 < 250 {
+		t.Errorf("像素位置错误: %v", out.At(0, 0))
+	}
+	if src.Bounds().Dx() != 400 {
+		t.Error("不应修改原图")
+	}
+
+	if _, err := ApplyEdits(src, []EditOp{{Op: "crop", X: 500, Y: 500, Width: 10, Height: 10}}, 0); err == nil {
+		t.Error("超出范围的裁剪应当报错")
+	}
+
+	// 直角旋转不改变像素数；45° 旋转后画布约为 495x495，超过上限时在分配前拒绝
+	if _, err := ApplyEdits(src, []EditOp{{Op: "rotate", Angle: 90}}, 400*300); err != nil {
+		t.Errorf("直角旋转不应超限: %v", err)
+	}
+	if _, err := ApplyEdits(src, []EditOp{{Op: "rotate", Angle: 45}}, 400*300); err == nil {
+		t.Error("旋转后超过像素上限应当报错")
+	}
+	if w, h := rotatedSize(400, 300, 45); w != 495 || h != 495 {
+		t.Errorf("旋转后尺寸计算错误: %dx%d", w, h)
+	}
+}
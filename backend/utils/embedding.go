@@ -0,0 +1,124 @@
+package utils
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"time"
+)
+
+// ErrImageEmbeddingUnsupported 提供方只能处理文本时由 EmbedImage 返回
+var ErrImageEmbeddingUnsupported = errors.New("该提供方不支持图片向量")
+
+// EmbeddingProvider 向量模型提供方：把文本和图片映射到同一个向量空间
+type EmbeddingProvider interface {
+	Name() string
+	Model() string
+	EmbedText(ctx context.Context, text string) ([]float32, error)
+	EmbedImage(ctx context.Context, image []byte) ([]float32, error)
+}
+
+// EmbeddingConfig 向量模型配置，全部来自环境变量
+type EmbeddingConfig struct {
+	Provider   string // openai / stub
+	Model      string
+	APIKey     string
+	BaseURL    string
+	Dim        int  // stub 的向量维度
+	ImageInput bool // openai 兼容接口是否接受图片输入（CLIP 类多模态模型）
+	Timeout    time.Duration
+}
+
+// EmbeddingConfigFromEnv 读取 EMBEDDING_* 环境变量，未配置时使用离线 stub
+func EmbeddingConfigFromEnv() EmbeddingConfig {
+	return EmbeddingConfig{
+		Provider:   strings.ToLower(GetEnv("EMBEDDING_PROVIDER", "stub")),
+		Model:      GetEnv("EMBEDDING_MODEL", ""),
+		APIKey:     GetEnv("EMBEDDING_API_KEY", GetEnv("AI_API_KEY", "")),
+		BaseURL:    GetEnv("EMBEDDING_BASE_URL", ""),
+		Dim:        GetEnvInt("EMBEDDING_DIM", 256),
+		ImageInput: GetEnvBool("EMBEDDING_IMAGE_INPUT", false),
+		Timeout:    GetEnvDuration("EMBEDDING_TIMEOUT", 30*time.Second),
+	}
+}
+
+// NewEmbeddingProvider 根据配置创建向量模型提供方
+func NewEmbeddingProvider(cfg EmbeddingConfig) (EmbeddingProvider, error) {
+	switch cfg.Provider {
+	case "openai":
+		if cfg.BaseURL == "" || cfg.Model == "" {
+			return nil, fmt.Errorf("openai 兼容向量接口需要配置 EMBEDDING_BASE_URL 和 EMBEDDING_MODEL")
+		}
+		return NewOpenAIEmbedder(cfg), nil
+	case "stub":
+		return NewStubEmbedder(cfg.Dim), nil
+	default:
+		return nil, fmt.Errorf("未知的向量模型提供方: %s", cfg.Provider)
+	}
+}
+
+// Embedder 当前使用的向量模型提供方，由 InitEmbedding 初始化
+var Embedder EmbeddingProvider
+
+// InitEmbedding 根据环境变量初始化向量模型提供方
+func InitEmbedding() {
+	p, err := NewEmbeddingProvider(EmbeddingConfigFromEnv())
+	if err != nil {
+		log.Fatalln("向量模型初始化失败:", err)
+	}
+	Embedder = p
+	log.Printf("向量模型: %s (%s)", p.Name(), p.Model())
+}
+
+// EmbeddingModelID 标识向量所属的模型，模型变化后旧向量不再可比
+func EmbeddingModelID(p EmbeddingProvider) string {
+	return p.Name() + "/" + p.Model()
+}
+
+// Normalize 将向量缩放为单位长度，之后余弦相似度即为点积
+func Normalize(v []float32) []float32 {
+	var sum float64
+	for _, x := range v {
+		sum += float64(x) * float64(x)
+	}
+	if sum == 0 {
+		return v
+	}
+	norm := float32(1 / math.Sqrt(sum))
+	out := make([]float32, len(v))
+	for i, x := range v {
+		out[i] = x * norm
+	}
+	return out
+}
+
+// Dot 两个等长向量的点积
+func Dot(a, b []float32) float32 {
+	var s float32
+	for i := range a {
+		s += a[i] * b[i]
+	}
+	return s
+}
+
+// EncodeVector 以小端 float32 序列化向量，用于存入数据库
+func EncodeVector(v []float32) []byte {
+	buf := make([]byte, 4*len(v))
+	for i, x := range v {
+		binary.LittleEndian.PutUint32(buf[4*i:], math.Float32bits(x))
+	}
+	return buf
+}
+
+// DecodeVector 反序列化 EncodeVector 的结果
+func DecodeVector(b []byte) []float32 {
+	v := make([]float32, len(b)/4)
+	for i := range v {
+		v[i] = math.Float32frombits(binary.LittleEndian.Uint32(b[4*i:]))
+	}
+	return v
+}
@@ -0,0 +1,93 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// OpenAIEmbedder OpenAI 兼容的 /embeddings 客户端。
+// 开启 EMBEDDING_IMAGE_INPUT 时以 {"image": "data:..."} 形式提交图片，适用于 CLIP 类多模态向量服务。
+type OpenAIEmbedder struct {
+	url        string
+	model      string
+	apiKey     string
+	imageInput bool
+	client     *http.Client
+}
+
+type openAIEmbeddingResponse struct {
+	Data []struct {
+		Embedding []float32 `json:"embedding"`
+	} `json:"data"`
+}
+
+// NewOpenAIEmbedder 创建 OpenAI 兼容向量客户端，BaseURL 形如 http://host:8000/v1
+func NewOpenAIEmbedder(cfg EmbeddingConfig) *OpenAIEmbedder {
+	url := strings.TrimRight(cfg.BaseURL, "/")
+	if !strings.HasSuffix(url, "/embeddings") {
+		url += "/embeddings"
+	}
+	return &OpenAIEmbedder{
+		url:        url,
+		model:      cfg.Model,
+		apiKey:     cfg.APIKey,
+		imageInput: cfg.ImageInput,
+		client:     &http.Client{Timeout: cfg.Timeout},
+	}
+}
+
+func (e *OpenAIEmbedder) Name() string  { return "openai" }
+func (e *OpenAIEmbedder) Model() string { return e.model }
+
+func (e *OpenAIEmbedder) EmbedText(ctx context.Context, text string) ([]float32, error) {
+	return e.embed(ctx, []string{text})
+}
+
+func (e *OpenAIEmbedder) EmbedImage(ctx context.Context, image []byte) ([]float32, error) {
+	if !e.imageInput {
+		return nil, ErrImageEmbeddingUnsupported
+	}
+	dataURL := "data:image/jpeg;base64," + base64.StdEncoding.EncodeToString(image)
+	return e.embed(ctx, []map[string]string{{"image": dataURL}})
+}
+
+func (e *OpenAIEmbedder) embed(ctx context.Context, input interface{}) ([]float32, error) {
+	jsonData, _ := json.Marshal(map[string]interface{}{"model": e.model, "input": input})
+	req, err := http.NewRequestWithContext(ctx, "POST", e.url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("创建请求失败: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if e.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+e.apiKey)
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("API连接失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("读取响应失败: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("向量接口错误 (%d): %s", resp.StatusCode, string(body))
+	}
+
+	var out openAIEmbeddingResponse
+	if err := json.Unmarshal(body, &out); err != nil {
+		return nil, fmt.Errorf("解析响应失败: %w", err)
+	}
+	if len(out.Data) == 0 || len(out.Data[0].Embedding) == 0 {
+		return nil, fmt.Errorf("向量接口未返回结果")
+	}
+	return Normalize(out.Data[0].Embedding), nil
+}
@@ -0,0 +1,79 @@
+package utils
+
+import (
+	"context"
+	"hash/fnv"
+	"strings"
+	"unicode"
+)
+
+// stubConcepts stub 向量模型认识的少量概念及其关键词，与 stub 视觉模型的标签一致，
+// 使离线环境下“海边日落”也能检索到标为“风景”的图片
+var stubConcepts = map[string][]string{
+	"风景": {"风景", "景色", "海", "沙滩", "日落", "日出", "夕阳", "山", "湖", "森林", "天空", "云", "自然", "草原", "瀑布", "scenery", "landscape", "sunset", "beach", "sea", "mountain"},
+	"人像": {"人像", "肖像", "自拍", "合影", "朋友", "孩子", "人物", "portrait", "people", "selfie"},
+	"美食": {"美食", "食物", "菜", "餐", "蛋糕", "咖啡", "火锅", "甜点", "food", "dish", "cake"},
+	"建筑": {"建筑", "城市", "楼", "街道", "桥", "寺", "塔", "building", "architecture", "city"},
+	"动物": {"动物", "猫", "狗", "鸟", "鱼", "宠物", "animal", "cat", "dog", "bird", "pet"},
+	"植物": {"植物", "花", "树", "叶", "草", "plant", "flower", "tree"},
+	"夜景": {"夜景", "夜", "灯", "星空", "烟花", "night", "stars", "fireworks"},
+	"街拍": {"街拍", "街头", "行人", "street"},
+}
+
+// StubEmbedder 离线的确定性向量模型：对字符 n-gram 和内置概念做特征哈希。
+// 图片向量取 stub 视觉模型为该图片给出的标签的文本向量，两者保持一致。
+type StubEmbedder struct {
+	dim int
+}
+
+// NewStubEmbedder 创建指定维度的 stub 向量模型
+func NewStubEmbedder(dim int) *StubEmbedder {
+	if dim <= 0 {
+		dim = 256
+	}
+	return &StubEmbedder{dim: dim}
+}
+
+func (e *StubEmbedder) Name() string  { return "stub" }
+func (e *StubEmbedder) Model() string { return "stub-hash-v1" }
+
+func (e *StubEmbedder) EmbedText(ctx context.Context, text string) ([]float32, error) {
+	v := make([]float32, e.dim)
+	text = strings.ToLower(text)
+	for concept, words := range stubConcepts {
+		for _, w := range words {
+			if strings.Contains(text, w) {
+				e.add(v, "concept:"+concept, 3)
+				break
+			}
+		}
+	}
+	// 按非字母数字字符切分，每段取单字和相邻两字
+	for _, seg := range strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	}) {
+		runes := []rune(seg)
+		for i := range runes {
+			e.add(v, string(runes[i]), 1)
+			if i+1 < len(runes) {
+				e.add(v, string(runes[i:i+2]), 1)
+			}
+		}
+	}
+	return Normalize(v), nil
+}
+
+func (e *StubEmbedder) EmbedImage(ctx context.Context, image []byte) ([]float32, error) {
+	return e.EmbedText(ctx, stubLabel(image))
+}
+
+// add 将特征哈希到某一维，符号由哈希的另一位决定以减少碰撞带来的偏差
+func (e *StubEmbedder) add(v []float32, feature string, weight float32) {
+	h := fnv.New64a()
+	h.Write([]byte(feature))
+	sum := h.Sum64()
+	if sum>>63 == 1 {
+		weight = -weight
+	}
+	v[sum%uint64(e.dim)] += weight
+}
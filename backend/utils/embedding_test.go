@@ -0,0 +1,136 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestStubEmbedder(t *testing.T) {
+	e := NewStubEmbedder(256)
+	ctx := context.Background()
+	query, _ := e.EmbedText(ctx, "海边日落")
+	scenery, _ := e.EmbedText(ctx, "风景")
+	food, _ := e.EmbedText(ctx, "美食")
+	if Dot(query, scenery) <= Dot(query, food) {
+		t.Errorf("“海边日落”应更接近“风景”: %v <= %v", Dot(query, scenery), Dot(query, food))
+	}
+	again, _ := e.EmbedText(ctx, "海边日落")
+	if Dot(query, again) < 0.9999 {
+		t.Error("同一文本的向量应当相同")
+	}
+	v := DecodeVector(EncodeVector(query))
+	if len(v) != 256 || v[0] != query[0] {
+		t.Error("向量序列化结果不一致")
+	}
+}
+
+func randomUnit(rng *rand.Rand, dim int) []float32 {
+	v := make([]float32, dim)
+	for i := range v {
+		v[i] = float32(rng.NormFloat64())
+	}
+	return Normalize(v)
+}
+
+func TestHNSW(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	const dim, n = 32, 1000
+	idx := NewHNSW("test", dim, 8, 64)
+	vecs := make([][]float32, n)
+	for i := range vecs {
+		vecs[i] = randomUnit(rng, dim)
+		if err := idx.Add(uint(i+1), vecs[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 以库中向量自身为查询，第一条结果应当就是它
+	hits := 0
+	for i := 0; i < 100; i++ {
+		if res := idx.Search(vecs[i], 1, 50); len(res) == 1 && res[0].ID == uint(i+1) {
+			hits++
+		}
+	}
+	if hits < 98 {
+		t.Errorf("召回率过低: %d/100", hits)
+	}
+
+	idx.Remove(1)
+	if res := idx.Search(vecs[0], 5, 50); len(res) == 0 || res[0].ID == 1 {
+		t.Error("已删除的向量不应出现在结果中")
+	}
+
+	// 只允许 1% 的向量（模拟某个用户的图片）：过滤检索只返回允许的向量，精确计算结果与逐一比较一致
+	var own []uint
+	for id := uint(7); id <= n; id += 100 {
+		own = append(own, id)
+	}
+	allow := func(id uint) bool { return id%100 == 7 }
+	query := randomUnit(rng, dim)
+	filtered := idx.SearchFiltered(query, 5, 50, allow)
+	for _, r := range filtered {
+		if !allow(r.ID) {
+			t.Errorf("过滤检索返回了不允许的向量 %d", r.ID)
+		}
+	}
+	exact := idx.ScoreIDs(query, own, 5)
+	if len(exact) != 5 {
+		t.Fatalf("精确计算应返回 5 个结果，实际 %d 个", len(exact))
+	}
+	best, bestScore := uint(0), float32(-2)
+	for _, id := range own {
+		if s := Dot(query, vecs[id-1]); s > bestScore {
+			best, bestScore = id, s
+		}
+	}
+	if exact[0].ID != best || exact[0].Score < exact[4].Score {
+		t.Errorf("精确计算结果错误: %+v，期望最相似的是 %d", exact, best)
+	}
+	if len(filtered) == 0 || filtered[0].ID != best {
+		t.Errorf("过滤检索应找到最相似的允许向量 %d，实际: %+v", best, filtered)
+	}
+
+	// 相同向量重复写入不产生新节点；替换向量留下的删除标记在 Compact 后清除
+	idx.Add(2, vecs[1])
+	if idx.Deleted() != 1 {
+		t.Errorf("相同向量不应产生删除标记，实际 %d 个", idx.Deleted())
+	}
+	vecs[2] = randomUnit(rng, dim)
+	idx.Add(3, vecs[2])
+	compacted := idx.Compact()
+	if compacted.Deleted() != 0 || compacted.Len() != n-1 {
+		t.Errorf("Compact 后应只保留 %d 个未删除的向量，实际 %d 个，%d 个删除标记", n-1, compacted.Len(), compacted.Deleted())
+	}
+	if res := compacted.Search(vecs[2], 1, 50); len(res) != 1 || res[0].ID != 3 {
+		t.Errorf("Compact 后应检索到替换后的向量，实际: %+v", res)
+	}
+
+	if err := NewHNSW("test", dim, 1, 64).Add(1, vecs[0]); err != ErrHNSWInvalidM {
+		t.Errorf("M 为 1 时应拒绝写入，实际: %v", err)
+	}
+
+	mark := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	idx.Advance(mark)
+	idx.Advance(mark.Add(-time.Hour))
+	if !idx.Watermark.Equal(mark) {
+		t.Errorf("Watermark 不应后退: %v", idx.Watermark)
+	}
+
+	var buf bytes.Buffer
+	if err := idx.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadHNSW(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Len() != n-1 || loaded.Model != "test" || !loaded.Watermark.Equal(mark) {
+		t.Fatalf("加载后的索引不一致: %d %s", loaded.Len(), loaded.Model)
+	}
+	if res := loaded.Search(vecs[10], 1, 50); len(res) != 1 || res[0].ID != 11 {
+		t.Errorf("加载后的检索结果错误: %+v", res)
+	}
+}
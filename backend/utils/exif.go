@@ -2,16 +2,21 @@ package utils
 
 import (
 	"bytes"
+	"encoding/binary"
 	"fmt"
 	"image"
 	_ "image/jpeg"
 	_ "image/png"
+	"io"
 	"log"
+	"math"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/dsoprea/go-exif/v3"
 	exifcommon "github.com/dsoprea/go-exif/v3/common"
+	_ "golang.org/x/image/webp"
 )
 
 // ExifData 定义我们需要提取的信息结构
@@ -21,6 +26,22 @@ type ExifData struct {
 	Resolution   string
 	Aperture     string
 	ISO          string
+
+	Make            string
+	LensModel       string
+	Software        string
+	FocalLength     float64 // 毫米，0 表示未知
+	FocalLength35mm int     // 等效 35mm 焦距，0 表示未知
+	ExposureTime    float64 // 秒，0 表示未知
+	ExposureBias    float64 // EV
+	Flash           *bool   // 是否闪光，nil 表示未知
+	WhiteBalance    string  // 自动 / 手动
+	Orientation     int     // EXIF 方向 1-8，0 表示未知
+
+	// GPS 坐标，nil 表示没有定位信息
+	Latitude  *float64
+	Longitude *float64
+	Altitude  *float64
 }
 
 // ExtractExif 从图片二进制数据中提取EXIF信息
@@ -64,6 +85,20 @@ func ExtractExif(fileData []byte) ExifData {
 			data.CameraModel = strings.Trim(fmt.Sprintf("%v", val), "\x00")
 		}
 	}
+	data.Make = exifString(rootIfd, "Make")
+	data.Software = exifString(rootIfd, "Software")
+	if v, ok := exifUint(rootIfd, "Orientation"); ok && v >= 1 && v <= 8 {
+		data.Orientation = v
+		// 5-8 需要旋转 90°，显示尺寸与传感器尺寸宽高互换
+		if w, h := data.Dimensions(); v >= 5 && w > 0 {
+			data.Resolution = displayResolution(w, h, v)
+		}
+	}
+
+	// GPS
+	if gpsIfd, err := rootIfd.ChildWithIfdPath(exifcommon.IfdGpsInfoStandardIfdIdentity); err == nil {
+		readGps(gpsIfd, &data)
+	}
 
 	// 获取Exif子IFD
 	exifIfd, err := rootIfd.ChildWithIfdPath(exifcommon.IfdExifStandardIfdIdentity)
@@ -107,7 +142,202 @@ func ExtractExif(fileData []byte) ExifData {
 				data.ISO = fmt.Sprintf("%v", val)
 			}
 		}
+
+		data.LensModel = exifString(exifIfd, "LensModel")
+		if f, ok := exifRational(exifIfd, "FocalLength"); ok {
+			data.FocalLength = math.Round(f*10) / 10
+		}
+		if v, ok := exifUint(exifIfd, "FocalLengthIn35mmFilm"); ok {
+			data.FocalLength35mm = v
+		}
+		if t, ok := exifRational(exifIfd, "ExposureTime"); ok {
+			data.ExposureTime = t
+		}
+		if b, ok := exifRational(exifIfd, "ExposureBiasValue"); ok {
+			data.ExposureBias = math.Round(b*100) / 100
+		}
+		// Flash 的最低位表示是否闪光
+		if v, ok := exifUint(exifIfd, "Flash"); ok {
+			fired := v&1 == 1
+			data.Flash = &fired
+		}
+		if v, ok := exifUint(exifIfd, "WhiteBalance"); ok {
+			switch v {
+			case 0:
+				data.WhiteBalance = "自动"
+			case 1:
+				data.WhiteBalance = "手动"
+			}
+		}
 	}
 
 	return data
 }
+
+// ExtractExifFromReader 从完整文件中提取 EXIF。JPEG/PNG 只需要文件头 head；
+// HEIF 和 WebP 的 EXIF 可能位于文件末尾，需要按容器结构从 r 中读取。
+func ExtractExifFromReader(r io.ReaderAt, size int64, head []byte) ExifData {
+	switch {
+	case IsHEIF(head):
+		info, err := ParseHEIF(r, size)
+		if err != nil {
+			log.Println("HEIF 解析警告:", err)
+			return ExtractExif(nil)
+		}
+		data := ExtractExif(info.Exif)
+		if w, h := info.DisplaySize(); w > 0 && h > 0 {
+			data.Resolution = fmt.Sprintf("%dx%d", w, h)
+		}
+		// HEIF 的方向由容器的 irot 描述，解码时已经摆正，不再按 EXIF 方向旋转
+		if data.Orientation != 0 {
+			data.Orientation = 1
+		}
+		return data
+	case isWebP(head):
+		chunk := webpExifChunk(r, size)
+		if chunk == nil {
+			return ExtractExif(head)
+		}
+		data := ExtractExif(chunk)
+		if cfg, _, err := image.DecodeConfig(bytes.NewReader(head)); err == nil {
+			data.Resolution = displayResolution(cfg.Width, cfg.Height, data.Orientation)
+		}
+		return data
+	default:
+		return ExtractExif(head)
+	}
+}
+
+// displayResolution 按 EXIF 方向返回显示尺寸，5-8 需要交换宽高
+func displayResolution(w, h, orientation int) string {
+	if orientation >= 5 {
+		w, h = h, w
+	}
+	return fmt.Sprintf("%dx%d", w, h)
+}
+
+func isWebP(head []byte) bool {
+	return len(head) >= 12 && string(head[0:4]) == "RIFF" && string(head[8:12]) == "WEBP"
+}
+
+// webpExifChunk 遍历 RIFF 块，返回 EXIF 块的内容
+func webpExifChunk(r io.ReaderAt, size int64) []byte {
+	hdr := make([]byte, 8)
+	for off := int64(12); off+8 <= size; {
+		if _, err := r.ReadAt(hdr, off); err != nil {
+			return nil
+		}
+		n := int64(binary.LittleEndian.Uint32(hdr[4:]))
+		if string(hdr[:4]) == "EXIF" {
+			if n > 4<<20 || off+8+n > size {
+				return nil
+			}
+			chunk := make([]byte, n)
+			if _, err := r.ReadAt(chunk, off+8); err != nil {
+				return nil
+			}
+			return chunk
+		}
+		// 块长度为奇数时有一个填充字节
+		off += 8 + n + n&1
+	}
+	return nil
+}
+
+// ExposureString 快门速度的常见写法，例如 1/250 或 2s
+func (d ExifData) ExposureString() string {
+	switch {
+	case d.ExposureTime <= 0:
+		return ""
+	case d.ExposureTime < 1:
+		return fmt.Sprintf("1/%d", int(math.Round(1/d.ExposureTime)))
+	default:
+		return strconv.FormatFloat(d.ExposureTime, 'f', -1, 64) + "s"
+	}
+}
+
+func readGps(gpsIfd *exif.Ifd, data *ExifData) {
+	gi, err := gpsIfd.GpsInfo()
+	if err != nil {
+		return
+	}
+	lat, lon := gi.Latitude.Decimal(), gi.Longitude.Decimal()
+	// 0,0 通常是未定位时写入的占位值
+	if math.IsNaN(lat) || math.IsNaN(lon) || lat < -90 || lat > 90 || lon < -180 || lon > 180 || (lat == 0 && lon == 0) {
+		return
+	}
+	data.Latitude, data.Longitude = &lat, &lon
+
+	if alt, ok := exifRational(gpsIfd, "GPSAltitude"); ok {
+		// GPSAltitudeRef 为 1 表示海平面以下
+		if results, err := gpsIfd.FindTagWithName("GPSAltitudeRef"); err == nil && len(results) > 0 {
+			if val, err := results[0].Value(); err == nil {
+				if b, ok := val.([]byte); ok && len(b) > 0 && b[0] == 1 {
+					alt = -alt
+				}
+			}
+		}
+		alt = math.Round(alt*10) / 10
+		data.Altitude = &alt
+	}
+}
+
+// exifString 读取 ASCII 类型的标签
+func exifString(ifd *exif.Ifd, name string) string {
+	results, err := ifd.FindTagWithName(name)
+	if err != nil || len(results) == 0 {
+		return ""
+	}
+	val, err := results[0].Value()
+	if err != nil {
+		return ""
+	}
+	s, _ := val.(string)
+	return strings.TrimSpace(strings.Trim(s, "\x00"))
+}
+
+// exifUint 读取 SHORT / LONG 类型标签的第一个值
+func exifUint(ifd *exif.Ifd, name string) (int, bool) {
+	results, err := ifd.FindTagWithName(name)
+	if err != nil || len(results) == 0 {
+		return 0, false
+	}
+	val, err := results[0].Value()
+	if err != nil {
+		return 0, false
+	}
+	switch v := val.(type) {
+	case []uint16:
+		if len(v) > 0 {
+			return int(v[0]), true
+		}
+	case []uint32:
+		if len(v) > 0 {
+			return int(v[0]), true
+		}
+	}
+	return 0, false
+}
+
+// exifRational 读取 RATIONAL / SRATIONAL 类型标签的第一个值
+func exifRational(ifd *exif.Ifd, name string) (float64, bool) {
+	results, err := ifd.FindTagWithName(name)
+	if err != nil || len(results) == 0 {
+		return 0, false
+	}
+	val, err := results[0].Value()
+	if err != nil {
+		return 0, false
+	}
+	switch v := val.(type) {
+	case []exifcommon.Rational:
+		if len(v) > 0 && v[0].Denominator != 0 {
+			return float64(v[0].Numerator) / float64(v[0].Denominator), true
+		}
+	case []exifcommon.SignedRational:
+		if len(v) > 0 && v[0].Denominator != 0 {
+			return float64(v[0].Numerator) / float64(v[0].Denominator), true
+		}
+	}
+	return 0, false
+}
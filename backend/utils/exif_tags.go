@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"math"
 	"strconv"
 	"strings"
 	"time"
@@ -45,9 +46,35 @@ func ExifTagsFromData(exif ExifData) []string {
 		}
 	}
 
+	if lens := strings.TrimSpace(exif.LensModel); lens != "" {
+		tags = append(tags, "镜头:"+lens)
+	}
+	if focal := exif.EquivalentFocalLength(); focal > 0 {
+		tags = append(tags, "焦段:"+focalBucket(focal))
+	}
+	if shutter := shutterBucket(exif.ExposureTime); shutter != "" {
+		tags = append(tags, "快门:"+shutter)
+	}
+	if exif.Flash != nil && *exif.Flash {
+		tags = append(tags, "闪光灯:开启")
+	}
+
 	return uniqueNonEmpty(tags)
 }
 
+// exifTagPrefixes ExifTagsFromData 生成的标签分类前缀
+var exifTagPrefixes = []string{"相机:", "时间:", "月份:", "季节:", "方向:", "分辨率:", "镜头:", "焦段:", "快门:", "闪光灯:", "国家:", "城市:", "地点:"}
+
+// IsExifTag 判断标签是否由 EXIF 信息推导而来
+func IsExifTag(tag string) bool {
+	for _, p := range exifTagPrefixes {
+		if strings.HasPrefix(tag, p) {
+			return true
+		}
+	}
+	return false
+}
+
 func timeBucket(hour int) string {
 	switch {
 	case hour >= 5 && hour < 8:
@@ -78,6 +105,46 @@ func seasonBucket(month int) string {
 	}
 }
 
+// EquivalentFocalLength 等效 35mm 焦距，缺少等效值时退回实际焦距
+func (d ExifData) EquivalentFocalLength() int {
+	if d.FocalLength35mm > 0 {
+		return d.FocalLength35mm
+	}
+	return int(math.Round(d.FocalLength))
+}
+
+func focalBucket(mm int) string {
+	switch {
+	case mm < 24:
+		return "超广角"
+	case mm < 35:
+		return "广角"
+	case mm <= 70:
+		return "标准"
+	case mm < 200:
+		return "长焦"
+	default:
+		return "超长焦"
+	}
+}
+
+// shutterBucket 只标记特殊的快门速度，常规速度不生成标签
+func shutterBucket(seconds float64) string {
+	switch {
+	case seconds >= 1:
+		return "长曝光"
+	case seconds > 0 && seconds <= 1.0/1000:
+		return "高速"
+	default:
+		return ""
+	}
+}
+
+// Dimensions 解析 Resolution 字段，未知时返回 0, 0
+func (d ExifData) Dimensions() (int, int) {
+	return parseResolution(d.Resolution)
+}
+
 func parseResolution(res string) (int, int) {
 	r := strings.TrimSpace(res)
 	if r == "" || r == "未知" {
@@ -113,6 +113,38 @@ func TestExifTagsFromData_NightTime(t *testing.T) {
 	}
 }
 
+func TestExifTagsFromData_LensAndExposure(t *testing.T) {
+	flash := true
+	exif := ExifData{
+		Resolution:   "未知",
+		LensModel:    "RF 100-500mm F4.5-7.1 L IS USM",
+		FocalLength:  400,
+		ExposureTime: 2,
+		Flash:        &flash,
+	}
+	tags := ExifTagsFromData(exif)
+
+	for _, e := range []string{"镜头:RF 100-500mm F4.5-7.1 L IS USM", "焦段:超长焦", "快门:长曝光", "闪光灯:开启"} {
+		found := false
+		for _, tag := range tags {
+			if tag == e {
+				found = true
+				break
+			}
+		}
+		if !found {
+			t.Errorf("期望标签 %q 未找到，实际标签: %v", e, tags)
+		}
+	}
+
+	// 手机的实际焦距很短，应优先使用等效焦距
+	phone := ExifData{FocalLength: 6.9, FocalLength35mm: 24, ExposureTime: 1.0 / 120}
+	tags = ExifTagsFromData(phone)
+	if len(tags) != 1 || tags[0] != "焦段:广角" {
+		t.Errorf("期望只有 焦段:广角，实际: %v", tags)
+	}
+}
+
 func TestMergeTags(t *testing.T) {
 	existing := "风景,人物"
 	extra := []string{"相机:iPhone", "风景", "方向:横图"}
@@ -0,0 +1,427 @@
+package utils
+
+import (
+	"bufio"
+	"embed"
+	"io"
+	"log"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// geoData 内置的离线地名数据，格式与 GeoNames 的 cities15000.txt 相同（制表符分隔的 19 列）。
+// 城市数据以 GAZETTEER_FILE 指定的 GeoNames 文件为准（Docker 镜像构建时自动下载）；
+// 内置的城市行是手工整理的近似数据，只在没有该文件时使用，景点行始终加载。
+//
+//go:generate go run geodata/gen.go -out geodata/cities.txt
+//go:embed geodata/cities.txt geodata/countries.txt
+var geoData embed.FS
+
+// Place 地名库中的一个地点
+type Place struct {
+	ID         int64 // GeoNames geonameid，手工整理的行为 0
+	Name       string
+	Country    string // ISO 3166 国家代码
+	Lat, Lon   float64
+	Population int64
+	Landmark   bool // 景点、湖泊、山峰等非居民点
+}
+
+// Location 反查得到的地名，未找到的部分为空
+type Location struct {
+	Country string
+	City    string
+	Place   string
+}
+
+// Gazetteer 离线地名库，城市和景点分别建立网格索引
+type Gazetteer struct {
+	cities    placeIndex
+	landmarks placeIndex
+	countries map[string]string // 国家代码 -> 中文名
+	ids       map[int64]bool    // 已加载的 geonameid，多个来源重复的地点只保留先加载的
+	zhNames   map[int64]string  // geonameid -> 中文名，来自 alternateNamesV2
+
+	CityRadius    float64 // 距最近城市不超过该距离（公里）时生成城市标签
+	PlaceRadius   float64 // 距最近景点不超过该距离时生成地点标签
+	CountryRadius float64 // 判定国家时优先在该距离内查找城市
+	// CountryFallbackRadius 该距离内没有城市时，国家取此范围内最近的城市或景点所属国家
+	CountryFallbackRadius float64
+	// CityTieKm 与最近城市的距离差不超过该值的候选城市中，取人口最多的一个
+	CityTieKm float64
+}
+
+// NewGazetteer 创建空的地名库
+func NewGazetteer() *Gazetteer {
+	return &Gazetteer{
+		cities:                newPlaceIndex(),
+		landmarks:             newPlaceIndex(),
+		countries:             map[string]string{},
+		ids:                   map[int64]bool{},
+		zhNames:               map[int64]string{},
+		CityRadius:            50,
+		PlaceRadius:           5,
+		CountryRadius:         300,
+		CountryFallbackRadius: 1000,
+		CityTieKm:             10,
+	}
+}
+
+// LoadGeoNames 读取 GeoNames 格式的地名数据，忽略空行和 # 开头的注释。
+// 地点使用 LoadAlternateNames 加载的中文名，没有时使用原名
+func (g *Gazetteer) LoadGeoNames(r io.Reader) error {
+	return g.load(r, false, false)
+}
+
+// loadBuiltin 读取内置数据，其别名列只有一个已选定的中文名，直接使用；landmarksOnly 时跳过城市
+func (g *Gazetteer) loadBuiltin(r io.Reader, landmarksOnly bool) error {
+	return g.load(r, true, landmarksOnly)
+}
+
+func (g *Gazetteer) load(r io.Reader, builtin, landmarksOnly bool) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64<<10), 1<<20)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		cols := strings.Split(line, "\t")
+		if len(cols) < 15 {
+			continue
+		}
+		lat, err1 := strconv.ParseFloat(cols[4], 64)
+		lon, err2 := strconv.ParseFloat(cols[5], 64)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		// 跳过城区、废弃和历史地名
+		class, code := cols[6], cols[7]
+		if class == "P" && (landmarksOnly || code == "PPLX" || code == "PPLQ" || code == "PPLW" || code == "PPLH") {
+			continue
+		}
+		id, _ := strconv.ParseInt(cols[0], 10, 64)
+		if id != 0 {
+			if g.ids[id] {
+				continue
+			}
+			g.ids[id] = true
+		}
+		pop, _ := strconv.ParseInt(cols[14], 10, 64)
+		name := cols[1]
+		if zh, ok := g.zhNames[id]; ok {
+			name = zh
+		} else if builtin && cols[3] != "" {
+			name = cols[3]
+		}
+		p := Place{
+			ID:         id,
+			Name:       name,
+			Country:    cols[8],
+			Lat:        lat,
+			Lon:        lon,
+			Population: pop,
+			Landmark:   class != "P",
+		}
+		if p.Landmark {
+			g.landmarks.add(p)
+		} else {
+			g.cities.add(p)
+		}
+	}
+	return scanner.Err()
+}
+
+// LoadAlternateNames 读取 GeoNames alternateNamesV2 格式的别名数据，之后加载的地点按 geonameid 使用其中的中文名
+func (g *Gazetteer) LoadAlternateNames(r io.Reader) error {
+	names, err := ParseChineseNames(r)
+	for id, name := range names {
+		g.zhNames[id] = name
+	}
+	return err
+}
+
+// zhLanguageRank 中文别名的语言优先级，简体优先；不在表中的语言不使用
+var zhLanguageRank = map[string]int{"zh-Hans": 0, "zh-CN": 1, "zh": 2}
+
+// ParseChineseNames 从 GeoNames alternateNamesV2 数据中为每个 geonameid 选出一个中文名，跳过俗称和历史名称。
+// 依次比较：语言（zh-Hans、zh-CN、zh）、isPreferredName、isShortName，都相同时取先出现的
+func ParseChineseNames(r io.Reader) (map[int64]string, error) {
+	type choice struct {
+		name string
+		rank [3]int
+	}
+	best := map[int64]choice{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64<<10), 1<<20)
+	for scanner.Scan() {
+		// alternateNameId, geonameid, isolanguage, 名称, isPreferredName, isShortName, isColloquial, isHistoric, from, to
+		cols := strings.Split(scanner.Text(), "\t")
+		if len(cols) < 8 || cols[6] == "1" || cols[7] == "1" {
+			continue
+		}
+		lang, ok := zhLanguageRank[cols[2]]
+		name := strings.TrimSpace(cols[3])
+		id, err := strconv.ParseInt(cols[1], 10, 64)
+		if !ok || name == "" || err != nil {
+			continue
+		}
+		c := choice{name, [3]int{lang, flagRank(cols[4]), flagRank(cols[5])}}
+		if old, ok := best[id]; !ok || lessRank(c.rank, old.rank) {
+			best[id] = c
+		}
+	}
+	names := make(map[int64]string, len(best))
+	for id, c := range best {
+		names[id] = c.name
+	}
+	return names, scanner.Err()
+}
+
+// flagRank 标记为 1 的排在前面
+func flagRank(flag string) int {
+	if flag == "1" {
+		return 0
+	}
+	return 1
+}
+
+func lessRank(a, b [3]int) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return a[i] < b[i]
+		}
+	}
+	return false
+}
+
+// LoadCountries 读取“国家代码<TAB>中文名”格式的国家名称表
+func (g *Gazetteer) LoadCountries(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		code, name, ok := strings.Cut(scanner.Text(), "\t")
+		if ok && code != "" {
+			g.countries[code] = strings.TrimSpace(name)
+		}
+	}
+	return scanner.Err()
+}
+
+// Lookup 根据经纬度反查国家、城市和地点
+func (g *Gazetteer) Lookup(lat, lon float64) Location {
+	var loc Location
+
+	city, dist := g.cities.largest(lat, lon, g.CountryRadius, g.CityTieKm)
+	if city != nil && dist <= g.CityRadius {
+		loc.City = city.Name
+	}
+	place, _ := g.landmarks.nearest(lat, lon, g.PlaceRadius)
+	if place != nil {
+		loc.Place = place.Name
+	}
+
+	// 国家优先取附近的城市，没有时退回更大范围内最近的城市或景点
+	code := ""
+	if city != nil {
+		code = city.Country
+	} else if place != nil {
+		code = place.Country
+	} else {
+		fallback, d := g.cities.nearest(lat, lon, g.CountryFallbackRadius)
+		if p, pd := g.landmarks.nearest(lat, lon, g.CountryFallbackRadius); p != nil && pd < d {
+			fallback = p
+		}
+		if fallback != nil {
+			code = fallback.Country
+		}
+	}
+	if code != "" {
+		loc.Country = code
+		if name, ok := g.countries[code]; ok {
+			loc.Country = name
+		}
+	}
+	return loc
+}
+
+var (
+	gazetteerOnce sync.Once
+	gazetteer     *Gazetteer
+)
+
+// DefaultGazetteer 默认地名库，首次使用时加载。城市以 GAZETTEER_FILE 为准，内置数据只补充景点；
+// 未设置或无法读取该文件时退回内置的手工整理城市，大部分坐标只能得到国家标签
+func DefaultGazetteer() *Gazetteer {
+	gazetteerOnce.Do(func() {
+		g := NewGazetteer()
+		g.CityRadius = float64(GetEnvInt("GEOCODE_CITY_RADIUS_KM", 50))
+		g.PlaceRadius = float64(GetEnvInt("GEOCODE_PLACE_RADIUS_KM", 5))
+		g.CountryRadius = float64(GetEnvInt("GEOCODE_COUNTRY_RADIUS_KM", 300))
+		g.CountryFallbackRadius = float64(GetEnvInt("GEOCODE_COUNTRY_FALLBACK_KM", 1000))
+		g.CityTieKm = float64(GetEnvInt("GEOCODE_CITY_TIE_KM", 10))
+
+		// 中文名需在地名库文件之前加载
+		if path := GetEnv("GAZETTEER_ALTNAMES_FILE", ""); path != "" {
+			if err := loadGazetteerFile(path, g.LoadAlternateNames); err != nil {
+				log.Printf("中文别名文件加载失败，城市使用 GeoNames 原名 (%s): %v", path, err)
+			}
+		}
+
+		fileLoaded := false
+		if path := GetEnv("GAZETTEER_FILE", ""); path == "" {
+			log.Println("警告: 未设置 GAZETTEER_FILE，城市仅使用内置的手工整理数据")
+		} else if err := loadGazetteerFile(path, g.LoadGeoNames); err != nil {
+			log.Printf("警告: 地名库文件加载失败，城市仅使用内置的手工整理数据 (%s): %v", path, err)
+		} else {
+			fileLoaded = true
+		}
+
+		for name, load := range map[string]func(io.Reader) error{
+			"geodata/cities.txt":    func(r io.Reader) error { return g.loadBuiltin(r, fileLoaded) },
+			"geodata/countries.txt": g.LoadCountries,
+		} {
+			f, err := geoData.Open(name)
+			if err != nil {
+				log.Printf("内置地名库读取失败 (%s): %v", name, err)
+				continue
+			}
+			if err := load(f); err != nil {
+				log.Printf("内置地名库解析失败 (%s): %v", name, err)
+			}
+			f.Close()
+		}
+		log.Printf("地名库已加载: %d 个城市, %d 个地点", len(g.cities.places), len(g.landmarks.places))
+		gazetteer = g
+	})
+	return gazetteer
+}
+
+func loadGazetteerFile(path string, load func(io.Reader) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return load(f)
+}
+
+// PlaceTagsFromExif 根据 GPS 坐标离线生成 国家/城市/地点 标签，没有定位信息时返回空
+func PlaceTagsFromExif(exif ExifData) []string {
+	if exif.Latitude == nil || exif.Longitude == nil {
+		return nil
+	}
+	loc := DefaultGazetteer().Lookup(*exif.Latitude, *exif.Longitude)
+	var tags []string
+	if loc.Country != "" {
+		tags = append(tags, "国家:"+loc.Country)
+	}
+	if loc.City != "" {
+		tags = append(tags, "城市:"+loc.City)
+	}
+	if loc.Place != "" {
+		tags = append(tags, "地点:"+loc.Place)
+	}
+	return tags
+}
+
+// ---------- 网格空间索引 ----------
+
+// placeIndex 按 1° × 1° 网格划分地点，查询时只检查半径覆盖的网格
+type placeIndex struct {
+	places []Place
+	cells  map[[2]int][]int
+}
+
+func newPlaceIndex() placeIndex {
+	return placeIndex{cells: map[[2]int][]int{}}
+}
+
+func (ix *placeIndex) add(p Place) {
+	ix.places = append(ix.places, p)
+	key := [2]int{int(math.Floor(p.Lat)), wrapLonCell(int(math.Floor(p.Lon)))}
+	ix.cells[key] = append(ix.cells[key], len(ix.places)-1)
+}
+
+// nearest 返回 radiusKm 范围内距离最近的地点及其距离
+func (ix *placeIndex) nearest(lat, lon, radiusKm float64) (*Place, float64) {
+	var best *Place
+	bestDist := math.Inf(1)
+	ix.within(lat, lon, radiusKm, func(p *Place, d float64) {
+		if d < bestDist {
+			best, bestDist = p, d
+		}
+	})
+	return best, bestDist
+}
+
+// largest 在距离不超过“最近地点距离 + tieKm”的候选中返回人口最多的地点，
+// 避免近郊小城镇抢走所属大城市；人口相同时取更近的
+func (ix *placeIndex) largest(lat, lon, radiusKm, tieKm float64) (*Place, float64) {
+	type candidate struct {
+		p *Place
+		d float64
+	}
+	var candidates []candidate
+	nearestDist := math.Inf(1)
+	ix.within(lat, lon, radiusKm, func(p *Place, d float64) {
+		candidates = append(candidates, candidate{p, d})
+		nearestDist = min(nearestDist, d)
+	})
+
+	var best *Place
+	bestDist := math.Inf(1)
+	for _, c := range candidates {
+		if c.d > nearestDist+tieKm {
+			continue
+		}
+		if best == nil || c.p.Population > best.Population ||
+			(c.p.Population == best.Population && c.d < bestDist) {
+			best, bestDist = c.p, c.d
+		}
+	}
+	return best, bestDist
+}
+
+// within 对 radiusKm 范围内的每个地点调用 fn
+func (ix *placeIndex) within(lat, lon, radiusKm float64, fn func(p *Place, d float64)) {
+	const kmPerDegree = 111.32
+	dLat := radiusKm / kmPerDegree
+	dLon := 360.0
+	if c := math.Cos(lat * math.Pi / 180); c > 0.01 {
+		dLon = min(radiusKm/(kmPerDegree*c), 360)
+	}
+
+	latFrom, latTo := int(math.Floor(lat-dLat)), int(math.Floor(lat+dLat))
+	lonFrom, lonTo := int(math.Floor(lon-dLon)), int(math.Floor(lon+dLon))
+	if lonTo-lonFrom >= 360 {
+		lonFrom, lonTo = -180, 179
+	}
+	for cy := latFrom; cy <= latTo; cy++ {
+		for cx := lonFrom; cx <= lonTo; cx++ {
+			for _, i := range ix.cells[[2]int{cy, wrapLonCell(cx)}] {
+				p := &ix.places[i]
+				if d := haversineKm(lat, lon, p.Lat, p.Lon); d <= radiusKm {
+					fn(p, d)
+				}
+			}
+		}
+	}
+}
+
+// wrapLonCell 将经度网格编号归一化到 [-180, 180)
+func wrapLonCell(cx int) int {
+	return ((cx+180)%360+360)%360 - 180
+}
+
+func haversineKm(lat1, lon1, lat2, lon2 float64) float64 {
+	const earthRadiusKm = 6371.0
+	rad := math.Pi / 180
+	dLat := (lat2 - lat1) * rad
+	dLon := (lon2 - lon1) * rad
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1*rad)*math.Cos(lat2*rad)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusKm * math.Asin(math.Sqrt(min(1, a)))
+}
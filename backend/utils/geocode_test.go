@@ -0,0 +1,153 @@
+package utils
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPlaceTagsFromExif_BundledGazetteer(t *testing.T) {
+	lat, lon := 30.2445, 120.1420 // 西湖湖面
+	tags := PlaceTagsFromExif(ExifData{Latitude: &lat, Longitude: &lon})
+	want := []string{"国家:中国", "城市:杭州", "地点:西湖"}
+	if !reflect.DeepEqual(tags, want) {
+		t.Errorf("期望 %v，实际: %v", want, tags)
+	}
+
+	// 太平洋中部，附近没有任何地点
+	lat, lon = 0, -150
+	if tags := PlaceTagsFromExif(ExifData{Latitude: &lat, Longitude: &lon}); len(tags) != 0 {
+		t.Errorf("远离陆地时不应生成标签，实际: %v", tags)
+	}
+
+	if tags := PlaceTagsFromExif(ExifData{}); tags != nil {
+		t.Errorf("没有 GPS 时不应生成标签，实际: %v", tags)
+	}
+}
+
+func TestGazetteer_LoadGeoNames(t *testing.T) {
+	data := strings.Join([]string{
+		"# 注释行",
+		"1\tSuva\tSuva\tSuva,苏瓦\t-18.14161\t178.44149\tP\tPPLC\tFJ\t\t\t\t\t\t93970\t\t\t\t",
+		"2\tSuva Old Town\tSuva Old Town\t\t-18.14\t178.44\tP\tPPLX\tFJ\t\t\t\t\t\t0\t\t\t\t",
+		"3\tTaveuni\tTaveuni\t\t-16.85\t-179.97\tT\tISL\tFJ\t\t\t\t\t\t0\t\t\t\t",
+	}, "\n")
+	g := NewGazetteer()
+	if err := g.LoadAlternateNames(strings.NewReader("10\t1\tzh\t苏瓦\t\t\t\t\t\t")); err != nil {
+		t.Fatalf("加载失败: %v", err)
+	}
+	if err := g.LoadGeoNames(strings.NewReader(data)); err != nil {
+		t.Fatalf("加载失败: %v", err)
+	}
+	if len(g.cities.places) != 1 || len(g.landmarks.places) != 1 {
+		t.Fatalf("城区应被跳过，实际城市 %d 个、地点 %d 个", len(g.cities.places), len(g.landmarks.places))
+	}
+
+	// 无国家名称表时使用国家代码；有中文别名时使用中文名，没有时使用原名
+	loc := g.Lookup(-18.15, 178.45)
+	if loc != (Location{Country: "FJ", City: "苏瓦"}) {
+		t.Errorf("反查结果不符: %+v", loc)
+	}
+
+	// 跨越 180° 经线查找
+	loc = g.Lookup(-16.85, 179.99)
+	if loc.Place != "Taveuni" {
+		t.Errorf("应找到经线另一侧的地点，实际: %+v", loc)
+	}
+}
+
+func TestGazetteer_PopulationTieBreak(t *testing.T) {
+	data := strings.Join([]string{
+		"1850147\tTokyo\tTokyo\tTokio,東京\t35.6895\t139.69171\tP\tPPLC\tJP\t\t40\t\t\t\t8336599\t\t\t\t",
+		"1\tSuburb\tSuburb\t\t35.70\t139.75\tP\tPPL\tJP\t\t40\t\t\t\t60000\t\t\t\t",
+		"2\tFar Town\tFar Town\t\t35.70\t140.10\tP\tPPL\tJP\t\t12\t\t\t\t900000\t\t\t\t",
+	}, "\n")
+	g := NewGazetteer()
+	if err := g.LoadAlternateNames(strings.NewReader("10\t1850147\tzh\t东京\t1\t\t\t\t\t")); err != nil {
+		t.Fatalf("加载失败: %v", err)
+	}
+	if err := g.LoadGeoNames(strings.NewReader(data)); err != nil {
+		t.Fatalf("加载失败: %v", err)
+	}
+
+	// 近郊小城更近，但与东京的距离差在 CityTieKm 内，取人口更多的东京
+	if loc := g.Lookup(35.705, 139.745); loc.City != "东京" {
+		t.Errorf("应取人口更多的城市，实际: %+v", loc)
+	}
+	// 人口更多但明显更远的城市不参与比较
+	if loc := g.Lookup(35.70, 140.08); loc.City != "Far Town" {
+		t.Errorf("应取最近的城市，实际: %+v", loc)
+	}
+	g.CityTieKm = 0
+	if loc := g.Lookup(35.705, 139.745); loc.City != "Suburb" {
+		t.Errorf("不比较人口时应取最近的城市，实际: %+v", loc)
+	}
+}
+
+func TestParseChineseNames(t *testing.T) {
+	data := strings.Join([]string{
+		// alternateNameId, geonameid, isolanguage, 名称, isPreferredName, isShortName, isColloquial, isHistoric
+		"1\t1816670\tja\t北京\t\t\t\t",
+		"2\t1816670\tzh\t北京市\t\t\t\t",
+		"3\t1816670\tzh\t北京\t1\t\t\t",
+		"4\t1816670\tzh\t燕京\t1\t\t\t1",
+		"5\t1668341\tzh\t臺北\t1\t\t\t",
+		"6\t1668341\tzh-Hans\t台北\t\t\t\t",
+		"7\t1668341\tzh-Hans\t台北市\t\t\t1\t",
+		"8\t1850147\tja\t東京\t1\t\t\t",
+	}, "\n")
+	names, err := ParseChineseNames(strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 日文名不使用；zh 中标记为首选的优先，历史名称跳过；简体优先于 zh 的首选名，俗称跳过
+	want := map[int64]string{1816670: "北京", 1668341: "台北"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("期望 %v，实际: %v", want, names)
+	}
+}
+
+func TestGazetteer_CountryFallback(t *testing.T) {
+	data := "1\tNouméa\tNoumea\t努美阿\t-22.27631\t166.4572\tP\tPPLC\tNC\t\t\t\t\t\t93060\t\t\t\t"
+	g := NewGazetteer()
+	if err := g.LoadGeoNames(strings.NewReader(data)); err != nil {
+		t.Fatalf("加载失败: %v", err)
+	}
+	if err := g.LoadCountries(strings.NewReader("NC\t新喀里多尼亚")); err != nil {
+		t.Fatalf("加载失败: %v", err)
+	}
+
+	// 约 500 公里外，超出 CountryRadius 但在 CountryFallbackRadius 内，只生成国家
+	if loc := g.Lookup(-20.5, 170.5); loc != (Location{Country: "新喀里多尼亚"}) {
+		t.Errorf("应退回最近城市所属国家，实际: %+v", loc)
+	}
+	// 超出兜底范围
+	if loc := g.Lookup(-22, 180); loc != (Location{}) {
+		t.Errorf("远离所有地点时不应生成标签，实际: %+v", loc)
+	}
+}
+
+func TestGazetteer_Dedup(t *testing.T) {
+	file := strings.Join([]string{
+		"1850147\tTokyo\tTokyo\t\t35.6895\t139.69171\tP\tPPLC\tJP\t\t40\t\t\t\t8336599\t\t\t\t",
+		"1850147\tTokyo\tTokyo\t\t35.6895\t139.69171\tP\tPPLC\tJP\t\t40\t\t\t\t8336599\t\t\t\t",
+	}, "\n")
+	builtin := strings.Join([]string{
+		"\tTokyo\tTokyo\t东京\t35.69\t139.69\tP\tPPLC\tJP\t\t\t\t\t\t8000000\t\t\t\t",
+		"\tTokyo Tower\tTokyo Tower\t东京塔\t35.65858\t139.74543\tS\tTOWR\tJP\t\t\t\t\t\t0\t\t\t\t",
+	}, "\n")
+	g := NewGazetteer()
+	if err := g.LoadGeoNames(strings.NewReader(file)); err != nil {
+		t.Fatal(err)
+	}
+	// 已有地名库文件时内置数据只补充景点，不会出现重复的城市
+	if err := g.loadBuiltin(strings.NewReader(builtin), true); err != nil {
+		t.Fatal(err)
+	}
+	if len(g.cities.places) != 1 || len(g.landmarks.places) != 1 {
+		t.Fatalf("应只有 1 个城市和 1 个地点，实际城市 %d 个、地点 %d 个", len(g.cities.places), len(g.landmarks.places))
+	}
+	if loc := g.Lookup(35.6586, 139.7454); loc.City != "Tokyo" || loc.Place != "东京塔" {
+		t.Errorf("反查结果不符: %+v", loc)
+	}
+}
@@ -0,0 +1,153 @@
+//go:build ignore
+
+// gen 从 GeoNames 的 cities15000 数据生成内置地名库 cities.txt：
+// 保留首都、一级行政中心和人口不少于 -min-pop 的城市（带真实 geonameid），
+// 别名列只写入按 alternateNamesV2 选出的一个中文名（与运行时 GAZETTEER_ALTNAMES_FILE 的选择规则相同）；
+// 原文件中的景点行原样保留。
+//
+//	go generate ./utils
+//	go run geodata/gen.go -src /path/to/cities15000.txt -alt /path/to/alternateNamesV2.txt
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"smart-gallery-backend/utils"
+)
+
+const (
+	sourceURL    = "https://download.geonames.org/export/dump/cities15000.zip"
+	alternateURL = "https://download.geonames.org/export/dump/alternateNamesV2.zip"
+)
+
+func main() {
+	src := flag.String("src", "", "cities15000.txt 路径，留空时从 GeoNames 下载")
+	alt := flag.String("alt", "", "alternateNamesV2.txt 路径，留空时从 GeoNames 下载")
+	out := flag.String("out", "geodata/cities.txt", "输出文件")
+	minPop := flag.Int64("min-pop", 1000000, "非首都、非一级行政中心城市的最低人口")
+	flag.Parse()
+
+	data, err := readSource(*src, sourceURL, "cities15000.txt")
+	if err != nil {
+		log.Fatalf("读取 cities15000 失败: %v", err)
+	}
+	altData, err := readSource(*alt, alternateURL, "alternateNamesV2.txt")
+	if err != nil {
+		log.Fatalf("读取 alternateNamesV2 失败: %v", err)
+	}
+	zhNames, err := utils.ParseChineseNames(bytes.NewReader(altData))
+	if err != nil {
+		log.Fatalf("解析 alternateNamesV2 失败: %v", err)
+	}
+
+	type row struct {
+		cols []string
+		pop  int64
+	}
+	var cities []row
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64<<10), 1<<20)
+	for scanner.Scan() {
+		cols := strings.Split(scanner.Text(), "\t")
+		if len(cols) < 19 || cols[6] != "P" {
+			continue
+		}
+		pop, _ := strconv.ParseInt(cols[14], 10, 64)
+		if cols[7] != "PPLC" && cols[7] != "PPLA" && pop < *minPop {
+			continue
+		}
+		id, _ := strconv.ParseInt(cols[0], 10, 64)
+		cols[3] = zhNames[id]
+		cities = append(cities, row{cols, pop})
+	}
+	if err := scanner.Err(); err != nil {
+		log.Fatal(err)
+	}
+	sort.SliceStable(cities, func(i, j int) bool { return cities[i].pop > cities[j].pop })
+
+	landmarks, err := existingLandmarks(*out)
+	if err != nil {
+		log.Fatalf("读取原有景点失败: %v", err)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("# 内置的精简地名库，由 geodata/gen.go 从 GeoNames cities15000 生成（CC BY 4.0，https://www.geonames.org/）。\n")
+	buf.WriteString("# 城市行保留 GeoNames 原始 geonameid，别名列为按 alternateNamesV2 选出的中文名；geonameid 留空的景点行为手工整理，坐标取近似值。\n")
+	for _, c := range cities {
+		buf.WriteString(strings.Join(c.cols, "\t"))
+		buf.WriteByte('\n')
+	}
+	for _, l := range landmarks {
+		buf.WriteString(l)
+		buf.WriteByte('\n')
+	}
+	if err := os.WriteFile(*out, buf.Bytes(), 0o644); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("已生成 %s: %d 个城市, %d 个景点\n", *out, len(cities), len(landmarks))
+}
+
+// readSource 读取本地文件，未指定时下载官方压缩包并解出其中的 name
+func readSource(path, url, name string) ([]byte, error) {
+	if path != "" {
+		return os.ReadFile(path)
+	}
+	resp, err := http.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("下载失败: %s", resp.Status)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	zr, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range zr.File {
+		if f.Name == name {
+			rc, err := f.Open()
+			if err != nil {
+				return nil, err
+			}
+			defer rc.Close()
+			return io.ReadAll(rc)
+		}
+	}
+	return nil, fmt.Errorf("压缩包中没有 %s", name)
+}
+
+// existingLandmarks 返回原文件中的非居民点行
+func existingLandmarks(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var rows []string
+	for _, line := range strings.Split(string(data), "\n") {
+		cols := strings.Split(line, "\t")
+		if strings.HasPrefix(line, "#") || len(cols) < 15 || cols[6] == "P" {
+			continue
+		}
+		rows = append(rows, line)
+	}
+	return rows, nil
+}
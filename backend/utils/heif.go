@@ -0,0 +1,475 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNoHEIFDecoder 没有可用的 HEIF 解码命令
+var ErrNoHEIFDecoder = errors.New("no HEIF decoder available")
+
+// heifBrands 常见的 HEIF/HEIC 主品牌
+var heifBrands = []string{"heic", "heix", "heim", "heis", "hevc", "hevx", "mif1", "msf1"}
+
+func init() {
+	for _, brand := range heifBrands {
+		image.RegisterFormat("heif", "????ftyp"+brand, decodeHEIF, decodeHEIFConfig)
+	}
+}
+
+// IsHEIF 根据文件头判断是否为 HEIF/HEIC
+func IsHEIF(head []byte) bool {
+	if len(head) < 12 || string(head[4:8]) != "ftyp" {
+		return false
+	}
+	brand := string(head[8:12])
+	for _, b := range heifBrands {
+		if brand == b {
+			return true
+		}
+	}
+	return false
+}
+
+// HEIFInfo HEIF 容器中主图的尺寸、旋转信息以及 Exif 数据项
+type HEIFInfo struct {
+	Width    int // ispe 中的编码尺寸，未旋转
+	Height   int
+	Rotation int // irot，逆时针旋转的角度：0/90/180/270
+	Exif     []byte
+}
+
+// DisplaySize 应用旋转后的显示尺寸
+func (h *HEIFInfo) DisplaySize() (int, int) {
+	if h.Rotation == 90 || h.Rotation == 270 {
+		return h.Height, h.Width
+	}
+	return h.Width, h.Height
+}
+
+// ParseHEIF 解析 HEIF 文件的 meta 盒，读取主图尺寸、旋转和 Exif 数据
+func ParseHEIF(r io.ReaderAt, size int64) (*HEIFInfo, error) {
+	var meta []byte
+	for off := int64(0); off+8 <= size; {
+		hdr := make([]byte, 16)
+		n, _ := r.ReadAt(hdr, off)
+		if n < 8 {
+			break
+		}
+		boxSize, hdrLen := int64(binary.BigEndian.Uint32(hdr)), int64(8)
+		switch {
+		case boxSize == 1 && n >= 16:
+			boxSize, hdrLen = int64(binary.BigEndian.Uint64(hdr[8:])), 16
+		case boxSize == 0:
+			boxSize = size - off
+		}
+		if boxSize < hdrLen {
+			return nil, errors.New("heif: 盒大小无效")
+		}
+		if string(hdr[4:8]) == "meta" {
+			if boxSize > 16<<20 {
+				return nil, errors.New("heif: meta 盒过大")
+			}
+			meta = make([]byte, boxSize-hdrLen)
+			if _, err := r.ReadAt(meta, off+hdrLen); err != nil {
+				return nil, err
+			}
+			break
+		}
+		off += boxSize
+	}
+	if meta == nil {
+		return nil, errors.New("heif: 缺少 meta 盒")
+	}
+
+	m, err := parseHEIFMeta(meta)
+	if err != nil {
+		return nil, err
+	}
+	info := m.info()
+	if loc, ok := m.locations[m.exifItem]; ok && m.exifItem != 0 {
+		var buf bytes.Buffer
+		for _, ext := range loc {
+			if ext.length > 4<<20 || ext.offset+ext.length > size {
+				return info, nil
+			}
+			part := make([]byte, ext.length)
+			if _, err := r.ReadAt(part, ext.offset); err != nil {
+				return info, nil
+			}
+			buf.Write(part)
+		}
+		info.Exif = buf.Bytes()
+	}
+	return info, nil
+}
+
+// heifMeta meta 盒中解析出的数据项信息
+type heifMeta struct {
+	primary    uint32
+	exifItem   uint32
+	locations  map[uint32][]heifExtent
+	properties [][]byte            // ipco 中的属性盒（含类型），下标从 0 开始
+	propTypes  []string            // 属性盒类型
+	assoc      map[uint32][]uint16 // 数据项 -> 属性下标（从 1 开始）
+}
+
+type heifExtent struct {
+	offset, length int64
+}
+
+func parseHEIFMeta(meta []byte) (*heifMeta, error) {
+	if len(meta) < 4 {
+		return nil, errors.New("heif: meta 盒过短")
+	}
+	m := &heifMeta{locations: map[uint32][]heifExtent{}, assoc: map[uint32][]uint16{}}
+	// meta 是 FullBox，跳过 version 和 flags
+	err := eachBox(meta[4:], func(typ string, body []byte) error {
+		switch typ {
+		case "pitm":
+			if len(body) < 6 {
+				return errors.New("heif: pitm 无效")
+			}
+			if body[0] == 0 {
+				m.primary = uint32(binary.BigEndian.Uint16(body[4:]))
+			} else if len(body) >= 8 {
+				m.primary = binary.BigEndian.Uint32(body[4:])
+			}
+		case "iinf":
+			return m.parseIinf(body)
+		case "iloc":
+			return m.parseIloc(body)
+		case "iprp":
+			return eachBox(body, func(typ string, body []byte) error {
+				switch typ {
+				case "ipco":
+					return eachBox(body, func(typ string, body []byte) error {
+						m.propTypes = append(m.propTypes, typ)
+						m.properties = append(m.properties, body)
+						return nil
+					})
+				case "ipma":
+					return m.parseIpma(body)
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+	return m, err
+}
+
+func (m *heifMeta) parseIinf(body []byte) error {
+	if len(body) < 6 {
+		return errors.New("heif: iinf 无效")
+	}
+	rest := body[6:]
+	if body[0] != 0 {
+		if len(body) < 8 {
+			return errors.New("heif: iinf 无效")
+		}
+		rest = body[8:]
+	}
+	return eachBox(rest, func(typ string, body []byte) error {
+		// 只处理 version >= 2 的 infe，其中包含 item_type
+		if typ != "infe" || len(body) < 4 || body[0] < 2 {
+			return nil
+		}
+		var id uint32
+		p := body[4:]
+		if body[0] == 2 {
+			if len(p) < 8 {
+				return nil
+			}
+			id, p = uint32(binary.BigEndian.Uint16(p)), p[2:]
+		} else {
+			if len(p) < 10 {
+				return nil
+			}
+			id, p = binary.BigEndian.Uint32(p), p[4:]
+		}
+		// 跳过 item_protection_index
+		if string(p[2:6]) == "Exif" {
+			m.exifItem = id
+		}
+		return nil
+	})
+}
+
+func (m *heifMeta) parseIloc(body []byte) error {
+	br := &byteReader{b: body}
+	version := br.u8()
+	br.skip(3)
+	sizes := br.u16()
+	offsetSize, lengthSize := int(sizes>>12), int(sizes>>8&0xf)
+	baseOffsetSize, indexSize := int(sizes>>4&0xf), 0
+	if version == 1 || version == 2 {
+		indexSize = int(sizes & 0xf)
+	}
+	var count uint32
+	if version < 2 {
+		count = uint32(br.u16())
+	} else {
+		count = br.u32()
+	}
+	for i := uint32(0); i < count && br.err == nil; i++ {
+		var id uint32
+		if version < 2 {
+			id = uint32(br.u16())
+		} else {
+			id = br.u32()
+		}
+		method := 0
+		if version == 1 || version == 2 {
+			method = int(br.u16() & 0xf)
+		}
+		br.skip(2) // data_reference_index
+		base := br.uint(baseOffsetSize)
+		extents := int(br.u16())
+		var list []heifExtent
+		for j := 0; j < extents && br.err == nil; j++ {
+			if indexSize > 0 {
+				br.uint(indexSize)
+			}
+			off := br.uint(offsetSize)
+			length := br.uint(lengthSize)
+			list = append(list, heifExtent{offset: int64(base + off), length: int64(length)})
+		}
+		// 只支持直接引用文件偏移的数据项
+		if method == 0 {
+			m.locations[id] = list
+		}
+	}
+	return br.err
+}
+
+func (m *heifMeta) parseIpma(body []byte) error {
+	br := &byteReader{b: body}
+	version := br.u8()
+	br.skip(2)
+	flags := br.u8()
+	count := br.u32()
+	for i := uint32(0); i < count && br.err == nil; i++ {
+		var id uint32
+		if version < 1 {
+			id = uint32(br.u16())
+		} else {
+			id = br.u32()
+		}
+		n := int(br.u8())
+		for j := 0; j < n && br.err == nil; j++ {
+			var idx uint16
+			if flags&1 == 1 {
+				idx = br.u16() & 0x7fff
+			} else {
+				idx = uint16(br.u8() & 0x7f)
+			}
+			m.assoc[id] = append(m.assoc[id], idx)
+		}
+	}
+	return br.err
+}
+
+// info 汇总主图关联的 ispe 和 irot 属性
+func (m *heifMeta) info() *HEIFInfo {
+	info := &HEIFInfo{}
+	for _, idx := range m.assoc[m.primary] {
+		if idx == 0 || int(idx) > len(m.properties) {
+			continue
+		}
+		body := m.properties[idx-1]
+		switch m.propTypes[idx-1] {
+		case "ispe":
+			if len(body) >= 12 {
+				info.Width = int(binary.BigEndian.Uint32(body[4:]))
+				info.Height = int(binary.BigEndian.Uint32(body[8:]))
+			}
+		case "irot":
+			if len(body) >= 1 {
+				info.Rotation = int(body[0]&3) * 90
+			}
+		}
+	}
+	return info
+}
+
+// eachBox 依次遍历 data 中的 ISOBMFF 盒
+func eachBox(data []byte, fn func(typ string, body []byte) error) error {
+	for len(data) >= 8 {
+		size, hdr := uint64(binary.BigEndian.Uint32(data)), uint64(8)
+		switch size {
+		case 1:
+			if len(data) < 16 {
+				return errors.New("heif: 盒头不完整")
+			}
+			size, hdr = binary.BigEndian.Uint64(data[8:]), 16
+		case 0:
+			size = uint64(len(data))
+		}
+		if size < hdr || size > uint64(len(data)) {
+			return errors.New("heif: 盒大小无效")
+		}
+		if err := fn(string(data[4:8]), data[hdr:size]); err != nil {
+			return err
+		}
+		data = data[size:]
+	}
+	return nil
+}
+
+// byteReader 按大端序读取定长整数，越界时记录错误并返回 0
+type byteReader struct {
+	b   []byte
+	err error
+}
+
+func (r *byteReader) take(n int) []byte {
+	if r.err != nil || len(r.b) < n {
+		r.err = errors.New("heif: 数据不完整")
+		return nil
+	}
+	p := r.b[:n]
+	r.b = r.b[n:]
+	return p
+}
+
+func (r *byteReader) skip(n int) { r.take(n) }
+
+func (r *byteReader) u8() uint8 {
+	if p := r.take(1); p != nil {
+		return p[0]
+	}
+	return 0
+}
+
+func (r *byteReader) u16() uint16 {
+	if p := r.take(2); p != nil {
+		return binary.BigEndian.Uint16(p)
+	}
+	return 0
+}
+
+func (r *byteReader) u32() uint32 {
+	if p := r.take(4); p != nil {
+		return binary.BigEndian.Uint32(p)
+	}
+	return 0
+}
+
+// uint 读取 0/4/8 字节的整数
+func (r *byteReader) uint(size int) uint64 {
+	switch size {
+	case 4:
+		return uint64(r.u32())
+	case 8:
+		if p := r.take(8); p != nil {
+			return binary.BigEndian.Uint64(p)
+		}
+	}
+	return 0
+}
+
+// ---------- 解码 ----------
+
+// decodeHEIFConfig 从文件开头的 meta 盒读取尺寸，供 image.DecodeConfig 使用
+func decodeHEIFConfig(r io.Reader) (image.Config, error) {
+	// meta 盒通常紧跟在 ftyp 之后，最多读取 16MB
+	data, err := io.ReadAll(io.LimitReader(r, 16<<20))
+	if err != nil && len(data) == 0 {
+		return image.Config{}, err
+	}
+	info, err := ParseHEIF(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return image.Config{}, err
+	}
+	w, h := info.DisplaySize()
+	if w == 0 || h == 0 {
+		return image.Config{}, errors.New("heif: 缺少 ispe 尺寸信息")
+	}
+	return image.Config{ColorModel: color.YCbCrModel, Width: w, Height: h}, nil
+}
+
+// decodeHEIF 调用外部命令将 HEIF 转为 JPEG 后解码；外部命令会按 irot/imir 摆正方向
+func decodeHEIF(r io.Reader) (image.Image, error) {
+	args := heifDecoderCommand()
+	if args == nil {
+		return nil, ErrNoHEIFDecoder
+	}
+
+	dir, err := os.MkdirTemp("", "gallery-heif-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	in, out := filepath.Join(dir, "in.heic"), filepath.Join(dir, "out.jpg")
+	f, err := os.Create(in)
+	if err != nil {
+		return nil, err
+	}
+	_, err = io.Copy(f, r)
+	f.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), GetEnvDuration("HEIF_DECODE_TIMEOUT", time.Minute))
+	defer cancel()
+	cmdArgs := make([]string, len(args))
+	for i, a := range args {
+		cmdArgs[i] = strings.NewReplacer("{in}", in, "{out}", out).Replace(a)
+	}
+	if output, err := exec.CommandContext(ctx, cmdArgs[0], cmdArgs[1:]...).CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("heif 解码失败: %v: %s", err, strings.TrimSpace(string(output)))
+	}
+
+	decoded, err := os.Open(out)
+	if err != nil {
+		return nil, err
+	}
+	defer decoded.Close()
+	img, _, err := image.Decode(decoded)
+	return img, err
+}
+
+var (
+	heifDecoderOnce sync.Once
+	heifDecoderArgs []string
+)
+
+// heifDecoderCommand 返回 HEIF 解码命令模板，{in}/{out} 为输入/输出文件。
+// HEIF_DECODER 可指定命令模板或设为 none 禁用；未设置时依次查找 heif-convert 和 magick。
+func heifDecoderCommand() []string {
+	heifDecoderOnce.Do(func() {
+		tmpl := GetEnv("HEIF_DECODER", "")
+		switch {
+		case tmpl == "none":
+			return
+		case tmpl != "":
+			heifDecoderArgs = strings.Fields(tmpl)
+		default:
+			if _, err := exec.LookPath("heif-convert"); err == nil {
+				heifDecoderArgs = []string{"heif-convert", "-q", "92", "{in}", "{out}"}
+			} else if _, err := exec.LookPath("magick"); err == nil {
+				heifDecoderArgs = []string{"magick", "{in}", "{out}"}
+			}
+		}
+		if heifDecoderArgs == nil {
+			log.Println("未找到 HEIF 解码命令，HEIC 图片将无法生成缩略图")
+		}
+	})
+	return heifDecoderArgs
+}
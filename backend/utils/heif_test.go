@@ -0,0 +1,99 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"testing"
+)
+
+func box(typ string, parts ...[]byte) []byte {
+	body := bytes.Join(parts, nil)
+	out := binary.BigEndian.AppendUint32(nil, uint32(8+len(body)))
+	return append(append(out, typ...), body...)
+}
+
+func u16(v uint16) []byte { return binary.BigEndian.AppendUint16(nil, v) }
+func u32(v uint32) []byte { return binary.BigEndian.AppendUint32(nil, v) }
+
+// buildHEIF 构造一个最小的 HEIF：主图 4032x3024、旋转 90°，附带 Exif 数据项
+func buildHEIF(exif []byte) []byte {
+	ftyp := box("ftyp", []byte("heic"), u32(0), []byte("mif1heic"))
+	meta := func(exifOffset uint32) []byte {
+		return box("meta", u32(0),
+			box("hdlr", u32(0), u32(0), []byte("pict"), make([]byte, 13)),
+			box("pitm", u32(0), u16(1)),
+			box("iinf", u32(0), u16(2),
+				box("infe", []byte{2, 0, 0, 0}, u16(1), u16(0), []byte("hvc1\x00")),
+				box("infe", []byte{2, 0, 0, 0}, u16(2), u16(0), []byte("Exif\x00")),
+			),
+			box("iloc", u32(0), []byte{0x44, 0x00}, u16(1),
+				u16(2), u16(0), u16(1), u32(exifOffset), u32(uint32(len(exif))),
+			),
+			box("iprp",
+				box("ipco",
+					box("ispe", u32(0), u32(4032), u32(3024)),
+					box("irot", []byte{1}),
+				),
+				box("ipma", u32(0), u32(1), u16(1), []byte{2, 0x81, 0x02}),
+			),
+		)
+	}
+	// meta 的长度与偏移量取值无关，先算出 mdat 数据的位置
+	offset := uint32(len(ftyp) + len(meta(0)) + 8)
+	return bytes.Join([][]byte{ftyp, meta(offset), box("mdat", exif)}, nil)
+}
+
+func TestParseHEIF(t *testing.T) {
+	exif := []byte("\x00\x00\x00\x06Exif\x00\x00II*\x00")
+	data := buildHEIF(exif)
+	if !IsHEIF(data) {
+		t.Fatalf("应识别为 HEIF")
+	}
+
+	info, err := ParseHEIF(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("解析失败: %v", err)
+	}
+	if info.Width != 4032 || info.Height != 3024 || info.Rotation != 90 {
+		t.Errorf("尺寸或旋转不符: %+v", info)
+	}
+	if !bytes.Equal(info.Exif, exif) {
+		t.Errorf("Exif 数据项不符: %q", info.Exif)
+	}
+
+	// 注册为 image 格式后 DecodeConfig 返回旋转后的显示尺寸
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || format != "heif" || cfg.Width != 3024 || cfg.Height != 4032 {
+		t.Errorf("DecodeConfig 结果不符: %+v %s %v", cfg, format, err)
+	}
+
+	if got := ExtractExifFromReader(bytes.NewReader(data), int64(len(data)), data[:64]); got.Resolution != "3024x4032" {
+		t.Errorf("分辨率应为旋转后的尺寸，实际: %s", got.Resolution)
+	}
+}
+
+func TestWebpExifChunk(t *testing.T) {
+	chunk := func(typ string, body []byte) []byte {
+		out := append([]byte(typ), binary.LittleEndian.AppendUint32(nil, uint32(len(body)))...)
+		out = append(out, body...)
+		if len(body)%2 == 1 {
+			out = append(out, 0)
+		}
+		return out
+	}
+	body := bytes.Join([][]byte{
+		[]byte("WEBP"),
+		chunk("VP8X", make([]byte, 10)),
+		chunk("ICCP", []byte{1, 2, 3}), // 奇数长度，带填充字节
+		chunk("EXIF", []byte("II*\x00exif")),
+	}, nil)
+	data := append(append([]byte("RIFF"), binary.LittleEndian.AppendUint32(nil, uint32(len(body)))...), body...)
+
+	if !isWebP(data) {
+		t.Fatalf("应识别为 WebP")
+	}
+	if got := webpExifChunk(bytes.NewReader(data), int64(len(data))); string(got) != "II*\x00exif" {
+		t.Errorf("EXIF 块不符: %q", got)
+	}
+}
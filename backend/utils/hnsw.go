@@ -0,0 +1,374 @@
+package utils
+
+import (
+	"container/heap"
+	"encoding/gob"
+	"errors"
+	"io"
+	"math"
+	"math/rand"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// HNSW 分层可导航小世界图，用于单位向量的近似最近邻检索（相似度为点积）。
+// 删除只做标记，被删除的节点仍参与路由，Compact 重建索引时才真正移除。
+type HNSW struct {
+	mu sync.RWMutex
+
+	Model          string // 向量所属模型，加载时用于判断索引是否过期
+	Dim            int
+	M              int // 每个节点在上层保留的邻居数，第 0 层为 2M
+	EfConstruction int
+	Nodes          []HNSWNode
+	Entry          int32
+	MaxLevel       int
+	Watermark      time.Time // 已写入的向量记录中最大的更新时间，加载后据此补齐之后的变更
+
+	ids map[uint]int32 // 图片 ID -> 未删除的节点
+	rng *rand.Rand
+}
+
+// HNSWNode 索引中的一个向量
+type HNSWNode struct {
+	ID      uint
+	Vec     []float32
+	Links   [][]int32 // 每层的邻居
+	Deleted bool
+}
+
+// SearchResult 检索结果，Score 为余弦相似度
+type SearchResult struct {
+	ID    uint
+	Score float32
+}
+
+// ErrHNSWInvalidM M 小于 2 时 ln(M) 不大于 0，无法为新节点分配层级
+var ErrHNSWInvalidM = errors.New("HNSW 参数 M 至少为 2")
+
+// NewHNSW 创建空索引，m 至少为 2
+func NewHNSW(model string, dim, m, efConstruction int) *HNSW {
+	h := &HNSW{Model: model, Dim: dim, M: m, EfConstruction: efConstruction, Entry: -1}
+	h.init()
+	return h
+}
+
+func (h *HNSW) init() {
+	h.ids = make(map[uint]int32, len(h.Nodes))
+	for i, n := range h.Nodes {
+		if !n.Deleted {
+			h.ids[n.ID] = int32(i)
+		}
+	}
+	h.rng = rand.New(rand.NewSource(int64(len(h.Nodes)) + 1))
+}
+
+// Len 未删除的向量数
+func (h *HNSW) Len() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.ids)
+}
+
+// Deleted 已标记删除但仍在图中的节点数
+func (h *HNSW) Deleted() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.Nodes) - len(h.ids)
+}
+
+// Add 插入或替换某张图片的向量，向量未变化时不做任何修改
+func (h *HNSW) Add(id uint, vec []float32) error {
+	if len(vec) != h.Dim {
+		return errors.New("向量维度与索引不一致")
+	}
+	if h.M < 2 {
+		return ErrHNSWInvalidM
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if old, ok := h.ids[id]; ok {
+		if slices.Equal(h.Nodes[old].Vec, vec) {
+			return nil
+		}
+		h.Nodes[old].Deleted = true
+	}
+	level := int(math.Floor(-math.Log(1-h.rng.Float64()) / math.Log(float64(h.M))))
+	n := int32(len(h.Nodes))
+	h.Nodes = append(h.Nodes, HNSWNode{ID: id, Vec: vec, Links: make([][]int32, level+1)})
+	h.ids[id] = n
+
+	if h.Entry < 0 {
+		h.Entry, h.MaxLevel = n, level
+		return nil
+	}
+
+	ep := h.Entry
+	for l := h.MaxLevel; l > level; l-- {
+		ep = h.greedy(vec, ep, l)
+	}
+	for l := min(level, h.MaxLevel); l >= 0; l-- {
+		candidates := h.searchLayer(vec, []int32{ep}, h.EfConstruction, l, nil)
+		neighbors := nearest(candidates, h.maxLinks(l))
+		h.Nodes[n].Links[l] = neighbors
+		for _, nb := range neighbors {
+			h.link(nb, n, l)
+		}
+		ep = candidates[0].node
+	}
+	if level > h.MaxLevel {
+		h.Entry, h.MaxLevel = n, level
+	}
+	return nil
+}
+
+// Advance 记录已写入的向量记录的更新时间，Watermark 只增不减
+func (h *HNSW) Advance(updatedAt time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if updatedAt.After(h.Watermark) {
+		h.Watermark = updatedAt
+	}
+}
+
+// Remove 标记删除某张图片的向量
+func (h *HNSW) Remove(id uint) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if n, ok := h.ids[id]; ok {
+		h.Nodes[n].Deleted = true
+		delete(h.ids, id)
+	}
+}
+
+// Compact 只用未删除的向量构建一个新索引并返回，原索引保持不变，构建期间仍可检索
+func (h *HNSW) Compact() *HNSW {
+	h.mu.RLock()
+	fresh := NewHNSW(h.Model, h.Dim, h.M, h.EfConstruction)
+	fresh.Watermark = h.Watermark
+	live := make([]HNSWNode, 0, len(h.ids))
+	for _, n := range h.Nodes {
+		if !n.Deleted {
+			live = append(live, n)
+		}
+	}
+	h.mu.RUnlock()
+	for _, n := range live {
+		fresh.Add(n.ID, n.Vec)
+	}
+	return fresh
+}
+
+// Search 返回与 vec 最相似的至多 k 个向量，ef 越大召回率越高
+func (h *HNSW) Search(vec []float32, k, ef int) []SearchResult {
+	return h.SearchFiltered(vec, k, ef, nil)
+}
+
+// SearchFiltered 与 Search 相同，但遍历时只把 allow 返回 true 的图片放入结果，
+// 其他节点仍用于路由；allow 为 nil 时不过滤
+func (h *HNSW) SearchFiltered(vec []float32, k, ef int, allow func(id uint) bool) []SearchResult {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if h.Entry < 0 || len(vec) != h.Dim {
+		return nil
+	}
+	ep := h.Entry
+	for l := h.MaxLevel; l > 0; l-- {
+		ep = h.greedy(vec, ep, l)
+	}
+	accept := func(n int32) bool {
+		node := &h.Nodes[n]
+		return !node.Deleted && (allow == nil || allow(node.ID))
+	}
+	var out []SearchResult
+	for _, c := range h.searchLayer(vec, []int32{ep}, max(ef, k), 0, accept) {
+		out = append(out, SearchResult{ID: h.Nodes[c.node].ID, Score: c.score})
+		if len(out) == k {
+			break
+		}
+	}
+	return out
+}
+
+// ScoreIDs 对 ids 中已入索引的向量逐一计算相似度，返回最相似的至多 k 个（精确结果）
+func (h *HNSW) ScoreIDs(vec []float32, ids []uint, k int) []SearchResult {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if len(vec) != h.Dim || k <= 0 {
+		return nil
+	}
+	top := &nodeHeap{min: true}
+	for _, id := range ids {
+		n, ok := h.ids[id]
+		if !ok {
+			continue
+		}
+		s := Dot(vec, h.Nodes[n].Vec)
+		if top.Len() < k {
+			heap.Push(top, scoredNode{n, s})
+		} else if s > top.items[0].score {
+			top.items[0] = scoredNode{n, s}
+			heap.Fix(top, 0)
+		}
+	}
+	out := make([]SearchResult, top.Len())
+	for i := len(out) - 1; i >= 0; i-- {
+		c := heap.Pop(top).(scoredNode)
+		out[i] = SearchResult{ID: h.Nodes[c.node].ID, Score: c.score}
+	}
+	return out
+}
+
+// IDs 返回所有未删除向量的图片 ID
+func (h *HNSW) IDs() []uint {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	ids := make([]uint, 0, len(h.ids))
+	for id := range h.ids {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// Save 以 gob 格式写出索引
+func (h *HNSW) Save(w io.Writer) error {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return gob.NewEncoder(w).Encode(h)
+}
+
+// LoadHNSW 读取 Save 写出的索引
+func LoadHNSW(r io.Reader) (*HNSW, error) {
+	h := &HNSW{}
+	if err := gob.NewDecoder(r).Decode(h); err != nil {
+		return nil, err
+	}
+	if h.M < 2 {
+		return nil, ErrHNSWInvalidM
+	}
+	h.init()
+	return h, nil
+}
+
+func (h *HNSW) maxLinks(level int) int {
+	if level == 0 {
+		return 2 * h.M
+	}
+	return h.M
+}
+
+// greedy 在某一层上贪心地移动到更相似的邻居，直到无法改进
+func (h *HNSW) greedy(vec []float32, ep int32, level int) int32 {
+	best := Dot(vec, h.Nodes[ep].Vec)
+	for changed := true; changed; {
+		changed = false
+		for _, nb := range h.linksAt(ep, level) {
+			if s := Dot(vec, h.Nodes[nb].Vec); s > best {
+				ep, best, changed = nb, s, true
+			}
+		}
+	}
+	return ep
+}
+
+func (h *HNSW) linksAt(n int32, level int) []int32 {
+	if level < len(h.Nodes[n].Links) {
+		return h.Nodes[n].Links[level]
+	}
+	return nil
+}
+
+// link 为 from 增加指向 to 的边，超过上限时只保留最相似的邻居
+func (h *HNSW) link(from, to int32, level int) {
+	links := append(h.Nodes[from].Links[level], to)
+	if limit := h.maxLinks(level); len(links) > limit {
+		scored := make([]scoredNode, len(links))
+		for i, nb := range links {
+			scored[i] = scoredNode{nb, Dot(h.Nodes[from].Vec, h.Nodes[nb].Vec)}
+		}
+		sort.Slice(scored, func(i, j int) bool { return scored[i].score > scored[j].score })
+		links = nearest(scored, limit)
+	}
+	h.Nodes[from].Links[level] = links
+}
+
+// searchLayer 在某一层上做束搜索，返回按相似度从高到低排列的至多 ef 个节点。
+// accept 不为 nil 时只有被接受的节点进入结果，其余节点只用于扩展
+func (h *HNSW) searchLayer(vec []float32, entries []int32, ef int, level int, accept func(int32) bool) []scoredNode {
+	visited := map[int32]bool{}
+	candidates := &nodeHeap{}       // 待扩展，相似度高的先出
+	results := &nodeHeap{min: true} // 当前结果，相似度低的先出
+	for _, e := range entries {
+		visited[e] = true
+		sn := scoredNode{e, Dot(vec, h.Nodes[e].Vec)}
+		heap.Push(candidates, sn)
+		if accept == nil || accept(e) {
+			heap.Push(results, sn)
+		}
+	}
+	for candidates.Len() > 0 {
+		c := heap.Pop(candidates).(scoredNode)
+		if results.Len() >= ef && c.score < results.items[0].score {
+			break
+		}
+		for _, nb := range h.linksAt(c.node, level) {
+			if visited[nb] {
+				continue
+			}
+			visited[nb] = true
+			s := Dot(vec, h.Nodes[nb].Vec)
+			if results.Len() < ef || s > results.items[0].score {
+				heap.Push(candidates, scoredNode{nb, s})
+				if accept == nil || accept(nb) {
+					heap.Push(results, scoredNode{nb, s})
+					if results.Len() > ef {
+						heap.Pop(results)
+					}
+				}
+			}
+		}
+	}
+	out := make([]scoredNode, results.Len())
+	for i := len(out) - 1; i >= 0; i-- {
+		out[i] = heap.Pop(results).(scoredNode)
+	}
+	return out
+}
+
+type scoredNode struct {
+	node  int32
+	score float32
+}
+
+// nearest 取已按相似度排序的前 k 个节点
+func nearest(sorted []scoredNode, k int) []int32 {
+	out := make([]int32, 0, min(k, len(sorted)))
+	for _, s := range sorted[:min(k, len(sorted))] {
+		out = append(out, s.node)
+	}
+	return out
+}
+
+// nodeHeap min 为 true 时是最小堆，否则是最大堆
+type nodeHeap struct {
+	items []scoredNode
+	min   bool
+}
+
+func (h *nodeHeap) Len() int { return len(h.items) }
+func (h *nodeHeap) Less(i, j int) bool {
+	if h.min {
+		return h.items[i].score < h.items[j].score
+	}
+	return h.items[i].score > h.items[j].score
+}
+func (h *nodeHeap) Swap(i, j int)      { h.items[i], h.items[j] = h.items[j], h.items[i] }
+func (h *nodeHeap) Push(x interface{}) { h.items = append(h.items, x.(scoredNode)) }
+func (h *nodeHeap) Pop() interface{} {
+	x := h.items[len(h.items)-1]
+	h.items = h.items[:len(h.items)-1]
+	return x
+}
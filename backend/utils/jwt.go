@@ -8,7 +8,10 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 )
 
-var jwtKey = []byte("your_secret_key_here") // 在生产环境中应从环境变量读取
+// defaultJWTKey 代码和 docker-compose 中公开的示例密钥
+const defaultJWTKey = "your_secret_key_here"
+
+var jwtKey = []byte(defaultJWTKey) // 在生产环境中应从环境变量读取
 
 func init() {
 	if k := os.Getenv("JWT_SECRET"); k != "" {
@@ -1,93 +1,129 @@
 package utils
 
 import (
-	"bytes"
 	"context"
-	"log"
-	"mime/multipart"
-	"os"
-	"strconv"
+	"io"
+	"path"
+	"strings"
 
 	"github.com/minio/minio-go/v7"
 	"github.com/minio/minio-go/v7/pkg/credentials"
 )
 
-var MinioClient *minio.Client
-var BucketName = "images" // 默认 Bucket 名称
+// MinioConfig MinIO 连接配置
+type MinioConfig struct {
+	Endpoint  string
+	AccessKey string
+	SecretKey string
+	UseSSL    bool
+	Bucket    string
+}
 
-// InitMinio 从环境变量读取配置并初始化 MinIO 客户端
-func InitMinio() {
-	endpoint := getEnv("MINIO_ENDPOINT", "localhost:9000")
-	accessKeyID := getEnv("MINIO_ACCESS_KEY", "admin")
-	secretAccessKey := getEnv("MINIO_SECRET_KEY", "password123")
-	useSSLStr := getEnv("MINIO_USE_SSL", "false")
-	bucket := getEnv("MINIO_BUCKET", "images")
+// MinioConfigFromEnv 从环境变量读取 MinIO 配置
+func MinioConfigFromEnv() MinioConfig {
+	return MinioConfig{
+		Endpoint:  GetEnv("MINIO_ENDPOINT", "localhost:9000"),
+		AccessKey: GetEnv("MINIO_ACCESS_KEY", "admin"),
+		SecretKey: GetEnv("MINIO_SECRET_KEY", "password123"),
+		UseSSL:    GetEnvBool("MINIO_USE_SSL", false),
+		Bucket:    GetEnv("MINIO_BUCKET", "images"),
+	}
+}
 
-	useSSL, _ := strconv.ParseBool(useSSLStr)
+// MinioStorage 基于 MinIO 的存储后端
+type MinioStorage struct {
+	Client *minio.Client
+	Bucket string
+}
 
-	client, err := minio.New(endpoint, &minio.Options{
-		Creds:  credentials.NewStaticV4(accessKeyID, secretAccessKey, ""),
-		Secure: useSSL,
+// NewMinioStorage 创建 MinIO 客户端
+func NewMinioStorage(cfg MinioConfig) (*MinioStorage, error) {
+	client, err := minio.New(cfg.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(cfg.AccessKey, cfg.SecretKey, ""),
+		Secure: cfg.UseSSL,
 	})
 	if err != nil {
-		log.Fatalln("MinIO 连接失败:", err)
+		return nil, err
 	}
-
-	log.Println("成功连接到 MinIO")
-	MinioClient = client
-	BucketName = bucket
+	return &MinioStorage{Client: client, Bucket: cfg.Bucket}, nil
 }
 
-// UploadFile 上传文件到 MinIO
-// 返回值: (上传后的相对路径, 错误)
-func UploadFile(file *multipart.FileHeader, objectName string) (string, error) {
-	ctx := context.Background()
-	src, err := file.Open()
+func (s *MinioStorage) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) (string, error) {
+	_, err := s.Client.PutObject(ctx, s.Bucket, key, r, size, minio.PutObjectOptions{
+		ContentType: contentType,
+	})
 	if err != nil {
 		return "", err
 	}
-	defer src.Close()
+	return s.URL(key), nil
+}
 
-	// 上传文件
-	_, err = MinioClient.PutObject(ctx, BucketName, objectName, src, file.Size, minio.PutObjectOptions{
-		ContentType: file.Header.Get("Content-Type"),
-	})
+func (s *MinioStorage) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	obj, err := s.Client.GetObject(ctx, s.Bucket, key, minio.GetObjectOptions{})
 	if err != nil {
-		return "", err
+		return nil, convertMinioError(err)
 	}
-
-	// 返回相对路径，前端会根据当前 hostname 动态拼接完整 URL
-	// 格式: /minio/images/xxx.jpg
-	relativePath := "/minio/" + BucketName + "/" + objectName
-	return relativePath, nil
+	// GetObject 是惰性的，先 Stat 一次以便尽早发现对象不存在
+	if _, err := obj.Stat(); err != nil {
+		obj.Close()
+		return nil, convertMinioError(err)
+	}
+	return obj, nil
 }
 
-func RemoveFile(objectName string) error {
-	ctx := context.Background()
-	// 调用 MinIO SDK 删除对象
-	return MinioClient.RemoveObject(ctx, BucketName, objectName, minio.RemoveObjectOptions{})
+func (s *MinioStorage) Stat(ctx context.Context, key string) (ObjectInfo, error) {
+	info, err := s.Client.StatObject(ctx, s.Bucket, key, minio.StatObjectOptions{})
+	if err != nil {
+		return ObjectInfo{}, convertMinioError(err)
+	}
+	return ObjectInfo{
+		Key:          info.Key,
+		Size:         info.Size,
+		ContentType:  info.ContentType,
+		LastModified: info.LastModified,
+	}, nil
 }
 
-func UploadBuffer(data []byte, objectName string, contentType string) (string, error) {
-	ctx := context.Background()
-	reader := bytes.NewReader(data)
+func (s *MinioStorage) Delete(ctx context.Context, key string) error {
+	return s.Client.RemoveObject(ctx, s.Bucket, key, minio.RemoveObjectOptions{})
+}
 
-	_, err := MinioClient.PutObject(ctx, BucketName, objectName, reader, int64(len(data)), minio.PutObjectOptions{
-		ContentType: contentType,
-	})
-	if err != nil {
-		return "", err
+func (s *MinioStorage) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	var out []ObjectInfo
+	for info := range s.Client.ListObjects(ctx, s.Bucket, minio.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+		if info.Err != nil {
+			return nil, info.Err
+		}
+		out = append(out, ObjectInfo{
+			Key:          info.Key,
+			Size:         info.Size,
+			ContentType:  info.ContentType,
+			LastModified: info.LastModified,
+		})
 	}
+	return out, nil
+}
+
+// URL 返回相对路径，前端会根据当前 hostname 动态拼接完整 URL
+// 格式: /minio/images/xxx.jpg
+func (s *MinioStorage) URL(key string) string {
+	return "/minio/" + s.Bucket + "/" + key
+}
 
-	// 返回相对路径
-	relativePath := "/minio/" + BucketName + "/" + objectName
-	return relativePath, nil
+// KeyFromURL 兼容相对路径和旧的完整 URL（http://host:9000/images/xxx.jpg）
+func (s *MinioStorage) KeyFromURL(url string) string {
+	if key, ok := strings.CutPrefix(url, "/minio/"+s.Bucket+"/"); ok {
+		return key
+	}
+	if i := strings.Index(url, "/"+s.Bucket+"/"); i >= 0 {
+		return url[i+len(s.Bucket)+2:]
+	}
+	return path.Base(url)
 }
 
-// getEnv helper
-func getEnv(key, def string) string {
-	if v := os.Getenv(key); v != "" {
-		return v
+func convertMinioError(err error) error {
+	if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+		return ErrObjectNotFound
 	}
-	return def
+	return err
 }
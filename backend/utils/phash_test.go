@@ -0,0 +1,83 @@
+package utils
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/disintegration/imaging"
+)
+
+func gradient(w, h int, reverse bool) image.Image {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			v := uint8((x*255/w + y*64/h) % 256)
+			if reverse {
+				v = 255 - v
+			}
+			img.Set(x, y, color.NRGBA{R: v, G: v, B: v, A: 255})
+		}
+	}
+	return img
+}
+
+func TestDHash(t *testing.T) {
+	src := gradient(640, 480, false)
+	resized := imaging.Resize(src, 200, 0, imaging.Lanczos)
+	if d := HammingDistance(DHash(src), DHash(resized)); d > 4 {
+		t.Errorf("缩放后的图片哈希距离过大: %d", d)
+	}
+	if d := HammingDistance(DHash(src), DHash(gradient(640, 480, true))); d < 32 {
+		t.Errorf("不同图片的哈希距离过小: %d", d)
+	}
+}
+
+func TestBKTree(t *testing.T) {
+	rng := uint64(88172645463325252)
+	next := func() uint64 { // xorshift，结果可复现
+		rng ^= rng << 13
+		rng ^= rng >> 7
+		rng ^= rng << 17
+		return rng
+	}
+	hashes := make([]uint64, 2000)
+	var tree BKTree
+	for i := range hashes {
+		hashes[i] = next()
+		if i%10 == 1 {
+			hashes[i] = hashes[i-1] ^ 0b1011 // 与前一张相差 3 位
+		}
+		tree.Add(uint(i), hashes[i])
+	}
+	tree.Add(9999, hashes[0])
+	tree.Add(10000, hashes[1])
+	tree.Remove(10000)
+	if tree.Len() != len(hashes)+1 {
+		t.Errorf("树中应有 %d 张图片，实际 %d 张", len(hashes)+1, tree.Len())
+	}
+
+	for _, q := range []int{0, 1, 500} {
+		for _, maxDist := range []int{0, 3, 12} {
+			want := map[uint]int{}
+			for i, h := range hashes {
+				if d := HammingDistance(hashes[q], h); d <= maxDist {
+					want[uint(i)] = d
+				}
+			}
+			if d := HammingDistance(hashes[q], hashes[0]); d <= maxDist {
+				want[9999] = d
+			}
+			got := map[uint]int{}
+			tree.Search(hashes[q], maxDist, func(id uint, dist int) { got[id] = dist })
+			if len(got) != len(want) {
+				t.Fatalf("查询 %d 距离 %d: 期望 %d 个结果，实际 %d 个", q, maxDist, len(want), len(got))
+			}
+			for id, d := range want {
+				if got[id] != d {
+					t.Errorf("查询 %d 距离 %d: 图片 %d 期望距离 %d，实际 %d", q, maxDist, id, d, got[id])
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,565 @@
+package utils
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// 检索语法示例：
+//
+//	tag:风景 camera:"iPhone 14 Pro" iso:>800 date:2024-06..2024-08 orientation:横图 -tag:夜晚
+//	(tag:猫 OR tag:狗) NOT name:screenshot
+//
+// 空格分隔的条件之间为 AND，OR 的优先级低于 AND，"-" 或 NOT 表示取反，括号用于分组。
+// 未知的 "分类:值"（例如 季节:夏）按完整标签名精确匹配。
+
+// QueryError 检索语句的语法或取值错误，Pos 为出错位置（按字符计）
+type QueryError struct {
+	Pos     int    `json:"position"`
+	Message string `json:"message"`
+}
+
+func (e *QueryError) Error() string {
+	return fmt.Sprintf("第 %d 个字符处: %s", e.Pos+1, e.Message)
+}
+
+// QueryNode 检索语句的语法树节点
+type QueryNode interface {
+	queryNode()
+}
+
+// AndNode 所有子条件同时成立
+type AndNode struct{ Children []QueryNode }
+
+// OrNode 任一子条件成立
+type OrNode struct{ Children []QueryNode }
+
+// NotNode 子条件不成立
+type NotNode struct{ Child QueryNode }
+
+// TermNode 单个条件；Field 为空表示自由文本
+type TermNode struct {
+	Field string
+	Value string
+	Pos   int
+}
+
+func (AndNode) queryNode()  {}
+func (OrNode) queryNode()   {}
+func (NotNode) queryNode()  {}
+func (TermNode) queryNode() {}
+
+// SearchQuery 解析并编译后的检索语句，SQL 可直接用于 GORM 的 Where
+type SearchQuery struct {
+	Root QueryNode
+	SQL  string
+	Args []interface{}
+}
+
+// ParseQuery 解析检索语句并编译为参数化的 SQL 条件
+func ParseQuery(input string) (*SearchQuery, error) {
+	tokens, err := lexQuery(input)
+	if err != nil {
+		return nil, err
+	}
+	p := &queryParser{tokens: tokens, end: len([]rune(input))}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok != nil {
+		return nil, &QueryError{Pos: tok.pos, Message: fmt.Sprintf("多余的 %q", tok.text)}
+	}
+
+	sql, args, err := compileNode(root)
+	if err != nil {
+		return nil, err
+	}
+	return &SearchQuery{Root: root, SQL: sql, Args: args}, nil
+}
+
+// ---------- 词法分析 ----------
+
+type queryTokenKind int
+
+const (
+	tokTerm queryTokenKind = iota
+	tokLParen
+	tokRParen
+	tokAnd
+	tokOr
+	tokNot
+)
+
+type queryToken struct {
+	kind  queryTokenKind
+	text  string // 原始文本
+	field string // 条件字段（仅 tokTerm）
+	value string // 去掉引号后的取值（仅 tokTerm）
+	pos   int
+}
+
+func lexQuery(input string) ([]queryToken, error) {
+	runes := []rune(input)
+	var tokens []queryToken
+	i := 0
+	for i < len(runes) {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, queryToken{kind: tokLParen, text: "(", pos: i})
+			i++
+		case r == ')':
+			tokens = append(tokens, queryToken{kind: tokRParen, text: ")", pos: i})
+			i++
+		case r == '-':
+			tokens = append(tokens, queryToken{kind: tokNot, text: "-", pos: i})
+			i++
+		default:
+			tok, next, err := lexTerm(runes, i)
+			if err != nil {
+				return nil, err
+			}
+			switch tok.text {
+			case "AND":
+				tok.kind = tokAnd
+			case "OR":
+				tok.kind = tokOr
+			case "NOT":
+				tok.kind = tokNot
+			}
+			tokens = append(tokens, tok)
+			i = next
+		}
+	}
+	return tokens, nil
+}
+
+// lexTerm 读取一个条件，支持 field:value 和带引号的取值
+func lexTerm(runes []rune, start int) (queryToken, int, error) {
+	var raw, value strings.Builder
+	field := ""
+	quoted := false
+	i := start
+	for i < len(runes) {
+		r := runes[i]
+		if unicode.IsSpace(r) || r == '(' || r == ')' {
+			break
+		}
+		if r == '"' {
+			end := i + 1
+			for end < len(runes) && runes[end] != '"' {
+				end++
+			}
+			if end >= len(runes) {
+				return queryToken{}, 0, &QueryError{Pos: i, Message: "引号未闭合"}
+			}
+			raw.WriteString(string(runes[i : end+1]))
+			value.WriteString(string(runes[i+1 : end]))
+			quoted = true
+			i = end + 1
+			continue
+		}
+		if r == ':' && field == "" && !quoted && value.Len() > 0 {
+			field = value.String()
+			value.Reset()
+			raw.WriteRune(r)
+			i++
+			continue
+		}
+		raw.WriteRune(r)
+		value.WriteRune(r)
+		i++
+	}
+
+	tok := queryToken{kind: tokTerm, text: raw.String(), field: strings.ToLower(field), value: value.String(), pos: start}
+	// 未知字段按完整标签名处理，例如 季节:夏
+	if tok.field != "" {
+		if _, ok := queryFields[tok.field]; !ok {
+			tok.value = field + ":" + tok.value
+			tok.field = "tag"
+		}
+	}
+	if tok.value == "" {
+		return queryToken{}, 0, &QueryError{Pos: start, Message: fmt.Sprintf("条件 %q 缺少取值", tok.text)}
+	}
+	return tok, i, nil
+}
+
+// ---------- 语法分析 ----------
+
+type queryParser struct {
+	tokens []queryToken
+	i      int
+	end    int
+}
+
+func (p *queryParser) peek() *queryToken {
+	if p.i < len(p.tokens) {
+		return &p.tokens[p.i]
+	}
+	return nil
+}
+
+func (p *queryParser) parseOr() (QueryNode, error) {
+	first, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	children := []QueryNode{first}
+	for {
+		tok := p.peek()
+		if tok == nil || tok.kind != tokOr {
+			break
+		}
+		p.i++
+		next, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, next)
+	}
+	if len(children) == 1 {
+		return first, nil
+	}
+	return OrNode{Children: children}, nil
+}
+
+func (p *queryParser) parseAnd() (QueryNode, error) {
+	var children []QueryNode
+	for {
+		tok := p.peek()
+		if tok == nil || tok.kind == tokOr || tok.kind == tokRParen {
+			break
+		}
+		if tok.kind == tokAnd {
+			if len(children) == 0 {
+				return nil, &QueryError{Pos: tok.pos, Message: "AND 前缺少条件"}
+			}
+			p.i++
+			continue
+		}
+		node, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, node)
+	}
+	if len(children) == 0 {
+		pos := p.end
+		if tok := p.peek(); tok != nil {
+			pos = tok.pos
+		}
+		return nil, &QueryError{Pos: pos, Message: "缺少检索条件"}
+	}
+	if last := p.tokens[p.i-1]; last.kind == tokAnd {
+		return nil, &QueryError{Pos: last.pos, Message: "AND 后缺少条件"}
+	}
+	if len(children) == 1 {
+		return children[0], nil
+	}
+	return AndNode{Children: children}, nil
+}
+
+func (p *queryParser) parseUnary() (QueryNode, error) {
+	tok := p.peek()
+	switch tok.kind {
+	case tokNot:
+		p.i++
+		next := p.peek()
+		if next == nil || next.kind == tokOr || next.kind == tokAnd || next.kind == tokRParen {
+			return nil, &QueryError{Pos: tok.pos, Message: fmt.Sprintf("%s 后缺少条件", tok.text)}
+		}
+		child, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return NotNode{Child: child}, nil
+	case tokLParen:
+		p.i++
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		closing := p.peek()
+		if closing == nil || closing.kind != tokRParen {
+			return nil, &QueryError{Pos: tok.pos, Message: "括号未闭合"}
+		}
+		p.i++
+		return node, nil
+	case tokTerm:
+		p.i++
+		return TermNode{Field: tok.field, Value: tok.value, Pos: tok.pos}, nil
+	default:
+		return nil, &QueryError{Pos: tok.pos, Message: fmt.Sprintf("意外的 %q", tok.text)}
+	}
+}
+
+// ---------- 编译为 SQL ----------
+
+// fieldCompiler 将单个字段条件编译为 SQL 片段
+type fieldCompiler func(t TermNode) (string, []interface{}, error)
+
+// queryFields 支持的检索字段
+var queryFields = map[string]fieldCompiler{}
+
+func init() {
+	queryFields["id"] = numberField("images.id")
+	queryFields["tag"] = compileTag
+	queryFields["camera"] = likeField("images.camera_model")
+	queryFields["name"] = likeField("images.file_name")
+	queryFields["file"] = likeField("images.file_name")
+	queryFields["caption"] = compileCaption
+	queryFields["desc"] = compileCaption
+	queryFields["iso"] = numberField("CAST(images.iso AS UNSIGNED)")
+	queryFields["aperture"] = numberField("CAST(SUBSTRING(images.aperture, 3) AS DECIMAL(6,2))")
+	queryFields["date"] = dateField("images.shooting_time", true)
+	queryFields["uploaded"] = dateField("images.created_at", false)
+	queryFields["status"] = exactField("images.analysis_status")
+	queryFields["make"] = likeField("images.make")
+	queryFields["lens"] = likeField("images.lens_model")
+	queryFields["focal"] = numberField("(CASE WHEN images.focal_length_35mm > 0 THEN images.focal_length_35mm ELSE images.focal_length END)")
+	queryFields["shutter"] = numberField("images.exposure_time")
+	queryFields["orientation"] = categoryTag("方向", map[string]string{
+		"landscape": "横图", "portrait": "竖图", "square": "方图",
+	})
+	queryFields["season"] = categoryTag("季节", map[string]string{
+		"spring": "春", "summer": "夏", "autumn": "秋", "fall": "秋", "winter": "冬",
+	})
+	queryFields["time"] = categoryTag("时间", nil)
+	queryFields["month"] = categoryTag("月份", nil)
+	queryFields["resolution"] = categoryTag("分辨率", nil)
+}
+
+func compileNode(n QueryNode) (string, []interface{}, error) {
+	switch node := n.(type) {
+	case AndNode:
+		return compileGroup(node.Children, " AND ")
+	case OrNode:
+		return compileGroup(node.Children, " OR ")
+	case NotNode:
+		sql, args, err := compileNode(node.Child)
+		if err != nil {
+			return "", nil, err
+		}
+		return "NOT (" + sql + ")", args, nil
+	case TermNode:
+		if node.Field == "" {
+			return compileText(node)
+		}
+		return queryFields[node.Field](node)
+	}
+	return "", nil, fmt.Errorf("unknown query node %T", n)
+}
+
+func compileGroup(children []QueryNode, sep string) (string, []interface{}, error) {
+	parts := make([]string, 0, len(children))
+	var args []interface{}
+	for _, c := range children {
+		sql, a, err := compileNode(c)
+		if err != nil {
+			return "", nil, err
+		}
+		parts = append(parts, "("+sql+")")
+		args = append(args, a...)
+	}
+	return strings.Join(parts, sep), args, nil
+}
+
+// tagMatchSQL 精确匹配标签名或 "分类:值" 中的值
+const tagMatchSQL = "images.id IN (SELECT image_tags.image_id FROM image_tags JOIN tags ON tags.id = image_tags.tag_id WHERE tags.name = ? OR tags.value = ?)"
+
+// exactTagSQL 只按完整标签名精确匹配
+const exactTagSQL = "images.id IN (SELECT image_tags.image_id FROM image_tags JOIN tags ON tags.id = image_tags.tag_id WHERE tags.name = ?)"
+
+// 后加的列在已有记录上为 NULL，NULL LIKE ? 的结果也是 NULL，取反后仍不成立，
+// 会让 -词 排除掉所有旧图片，因此这些列先用 COALESCE 转成空字符串
+const (
+	descriptionSQL = "COALESCE(images.description, '')"
+	altTextSQL     = "COALESCE(images.alt_text, '')"
+)
+
+// compileText 自由文本：匹配文件名、相机型号、描述、替代文本或标签
+func compileText(t TermNode) (string, []interface{}, error) {
+	like := likePattern(t.Value)
+	return "images.file_name LIKE ? OR images.camera_model LIKE ? OR " + descriptionSQL + " LIKE ? OR " + altTextSQL + " LIKE ? OR " + tagMatchSQL,
+		[]interface{}{like, like, like, like, t.Value, t.Value}, nil
+}
+
+// compileCaption 匹配中文描述或英文替代文本
+func compileCaption(t TermNode) (string, []interface{}, error) {
+	like := likePattern(t.Value)
+	return descriptionSQL + " LIKE ? OR " + altTextSQL + " LIKE ?", []interface{}{like, like}, nil
+}
+
+func compileTag(t TermNode) (string, []interface{}, error) {
+	if strings.Contains(t.Value, ":") {
+		return exactTagSQL, []interface{}{t.Value}, nil
+	}
+	return tagMatchSQL, []interface{}{t.Value, t.Value}, nil
+}
+
+// categoryTag 将 field:值 转换为 "分类:值" 标签的精确匹配，aliases 提供英文别名
+func categoryTag(category string, aliases map[string]string) fieldCompiler {
+	return func(t TermNode) (string, []interface{}, error) {
+		v := t.Value
+		if alias, ok := aliases[strings.ToLower(v)]; ok {
+			v = alias
+		}
+		return exactTagSQL, []interface{}{category + ":" + v}, nil
+	}
+}
+
+// likeField 模糊匹配文本列，列值为 NULL 时按空字符串处理，取反时不会漏掉这些记录
+func likeField(column string) fieldCompiler {
+	return func(t TermNode) (string, []interface{}, error) {
+		return "COALESCE(" + column + ", '') LIKE ?", []interface{}{likePattern(t.Value)}, nil
+	}
+}
+
+func exactField(column string) fieldCompiler {
+	return func(t TermNode) (string, []interface{}, error) {
+		return column + " = ?", []interface{}{t.Value}, nil
+	}
+}
+
+// numberField 支持 800、>800、>=800、<800、<=800、100..400、100..、..400
+func numberField(expr string) fieldCompiler {
+	return func(t TermNode) (string, []interface{}, error) {
+		parse := func(s string) (float64, error) {
+			v, err := strconv.ParseFloat(s, 64)
+			if err != nil {
+				return 0, &QueryError{Pos: t.Pos, Message: fmt.Sprintf("%s 的取值 %q 不是数字", t.Field, s)}
+			}
+			return v, nil
+		}
+
+		if lo, hi, ok := strings.Cut(t.Value, ".."); ok {
+			var conds []string
+			var args []interface{}
+			if lo != "" {
+				v, err := parse(lo)
+				if err != nil {
+					return "", nil, err
+				}
+				conds, args = append(conds, expr+" >= ?"), append(args, v)
+			}
+			if hi != "" {
+				v, err := parse(hi)
+				if err != nil {
+					return "", nil, err
+				}
+				conds, args = append(conds, expr+" <= ?"), append(args, v)
+			}
+			if len(conds) == 0 {
+				return "", nil, &QueryError{Pos: t.Pos, Message: "范围两端不能都为空"}
+			}
+			return strings.Join(conds, " AND "), args, nil
+		}
+
+		op, rest := splitComparison(t.Value)
+		v, err := parse(rest)
+		if err != nil {
+			return "", nil, err
+		}
+		return expr + " " + op + " ?", []interface{}{v}, nil
+	}
+}
+
+// dateField 支持 2024、2024-06、2024-06-15 以及比较和范围，按 [开始, 结束) 区间比较。
+// textColumn 表示列以 "2006-01-02 15:04:05" 文本保存，空串代表没有拍摄时间。
+func dateField(column string, textColumn bool) fieldCompiler {
+	return func(t TermNode) (string, []interface{}, error) {
+		parse := func(s string) (time.Time, time.Time, error) {
+			start, end, ok := parseDateSpan(s)
+			if !ok {
+				return start, end, &QueryError{Pos: t.Pos, Message: fmt.Sprintf("%s 的取值 %q 不是有效日期（支持 2024、2024-06、2024-06-15）", t.Field, s)}
+			}
+			return start, end, nil
+		}
+		notEmpty := column + " IS NOT NULL"
+		if textColumn {
+			notEmpty += " AND " + column + " <> ''"
+		}
+
+		if lo, hi, ok := strings.Cut(t.Value, ".."); ok {
+			conds := []string{notEmpty}
+			var args []interface{}
+			if lo != "" {
+				start, _, err := parse(lo)
+				if err != nil {
+					return "", nil, err
+				}
+				conds, args = append(conds, column+" >= ?"), append(args, formatQueryTime(start))
+			}
+			if hi != "" {
+				_, end, err := parse(hi)
+				if err != nil {
+					return "", nil, err
+				}
+				conds, args = append(conds, column+" < ?"), append(args, formatQueryTime(end))
+			}
+			if len(args) == 0 {
+				return "", nil, &QueryError{Pos: t.Pos, Message: "范围两端不能都为空"}
+			}
+			return strings.Join(conds, " AND "), args, nil
+		}
+
+		op, rest := splitComparison(t.Value)
+		start, end, err := parse(rest)
+		if err != nil {
+			return "", nil, err
+		}
+		switch op {
+		case ">":
+			return notEmpty + " AND " + column + " >= ?", []interface{}{formatQueryTime(end)}, nil
+		case ">=":
+			return notEmpty + " AND " + column + " >= ?", []interface{}{formatQueryTime(start)}, nil
+		case "<":
+			return notEmpty + " AND " + column + " < ?", []interface{}{formatQueryTime(start)}, nil
+		case "<=":
+			return notEmpty + " AND " + column + " < ?", []interface{}{formatQueryTime(end)}, nil
+		default:
+			return notEmpty + " AND " + column + " >= ? AND " + column + " < ?", []interface{}{formatQueryTime(start), formatQueryTime(end)}, nil
+		}
+	}
+}
+
+// parseDateSpan 返回日期值覆盖的区间 [start, end)
+func parseDateSpan(s string) (time.Time, time.Time, bool) {
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		return t, t.AddDate(0, 0, 1), true
+	}
+	if t, err := time.ParseInLocation("2006-01", s, time.Local); err == nil {
+		return t, t.AddDate(0, 1, 0), true
+	}
+	if t, err := time.ParseInLocation("2006", s, time.Local); err == nil {
+		return t, t.AddDate(1, 0, 0), true
+	}
+	return time.Time{}, time.Time{}, false
+}
+
+func formatQueryTime(t time.Time) string {
+	return t.Format("2006-01-02 15:04:05")
+}
+
+// splitComparison 拆出取值前的比较运算符，没有时为 "="
+func splitComparison(v string) (string, string) {
+	for _, op := range []string{">=", "<=", ">", "<", "="} {
+		if rest, ok := strings.CutPrefix(v, op); ok {
+			return op, rest
+		}
+	}
+	return "=", v
+}
+
+// likePattern 转义 LIKE 通配符后包上 %
+func likePattern(v string) string {
+	r := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return "%" + r.Replace(v) + "%"
+}
@@ -0,0 +1,127 @@
+package utils
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseQuery_Structure(t *testing.T) {
+	q, err := ParseQuery(`tag:风景 camera:"iPhone 14 Pro" -tag:夜晚`)
+	if err != nil {
+		t.Fatalf("解析失败: %v", err)
+	}
+	and, ok := q.Root.(AndNode)
+	if !ok || len(and.Children) != 3 {
+		t.Fatalf("期望 3 个 AND 子条件，实际: %#v", q.Root)
+	}
+	if term := and.Children[1].(TermNode); term.Field != "camera" || term.Value != "iPhone 14 Pro" {
+		t.Errorf("引号取值解析错误: %#v", term)
+	}
+	if _, ok := and.Children[2].(NotNode); !ok {
+		t.Errorf("-tag 应解析为 NOT: %#v", and.Children[2])
+	}
+}
+
+func TestParseQuery_OrPrecedence(t *testing.T) {
+	q, err := ParseQuery(`tag:猫 OR tag:狗 iso:>800`)
+	if err != nil {
+		t.Fatalf("解析失败: %v", err)
+	}
+	or, ok := q.Root.(OrNode)
+	if !ok || len(or.Children) != 2 {
+		t.Fatalf("OR 优先级应低于 AND: %#v", q.Root)
+	}
+	if _, ok := or.Children[1].(AndNode); !ok {
+		t.Errorf("OR 右侧应为 AND 组合: %#v", or.Children[1])
+	}
+}
+
+func TestParseQuery_SQL(t *testing.T) {
+	q, err := ParseQuery(`iso:>800 date:2024-06..2024-08`)
+	if err != nil {
+		t.Fatalf("解析失败: %v", err)
+	}
+	if !strings.Contains(q.SQL, "CAST(images.iso AS UNSIGNED) > ?") {
+		t.Errorf("ISO 条件错误: %s", q.SQL)
+	}
+	want := []interface{}{800.0, "2024-06-01 00:00:00", "2024-09-01 00:00:00"}
+	if !reflect.DeepEqual(q.Args, want) {
+		t.Errorf("参数不符: %#v", q.Args)
+	}
+}
+
+func TestParseQuery_CategoryAndUnknownField(t *testing.T) {
+	q, err := ParseQuery(`orientation:landscape 季节:夏`)
+	if err != nil {
+		t.Fatalf("解析失败: %v", err)
+	}
+	want := []interface{}{"方向:横图", "季节:夏"}
+	if !reflect.DeepEqual(q.Args, want) {
+		t.Errorf("参数不符: %#v", q.Args)
+	}
+}
+
+func TestParseQuery_LikeEscaping(t *testing.T) {
+	q, err := ParseQuery(`name:100%_done`)
+	if err != nil {
+		t.Fatalf("解析失败: %v", err)
+	}
+	if q.Args[0] != `%100\%\_done%` {
+		t.Errorf("LIKE 通配符未转义: %v", q.Args[0])
+	}
+}
+
+func TestParseQuery_Errors(t *testing.T) {
+	cases := map[string]int{
+		`tag:风景 (iso:100`: 7,
+		`camera:"iPhone`:  7,
+		`iso:>abc`:        0,
+		`date:2024-13`:    0,
+		`tag:猫 OR`:        8,
+		`tag:猫 )`:         6,
+		`tag:`:            0,
+		`-`:               0,
+	}
+	for input, pos := range cases {
+		_, err := ParseQuery(input)
+		var qe *QueryError
+		if !errors.As(err, &qe) {
+			t.Errorf("%q 应返回 QueryError，实际: %v", input, err)
+			continue
+		}
+		if qe.Pos != pos {
+			t.Errorf("%q 错误位置应为 %d，实际 %d (%s)", input, pos, qe.Pos, qe.Message)
+		}
+	}
+}
+
+func TestParseQuery_Caption(t *testing.T) {
+	q, err := ParseQuery(`caption:日落 海边`)
+	if err != nil {
+		t.Fatalf("解析失败: %v", err)
+	}
+	if strings.Count(q.SQL, "COALESCE(images.description, '') LIKE ?") != 2 || !strings.Contains(q.SQL, "COALESCE(images.alt_text, '') LIKE ?") {
+		t.Errorf("描述条件错误: %s", q.SQL)
+	}
+}
+
+func TestParseQuery_NegationNullable(t *testing.T) {
+	// 旧记录的描述、替代文本和镜头为 NULL，取反时需先转成空字符串，否则整条条件为 NULL
+	q, err := ParseQuery(`-日落 -caption:海边 -lens:50mm`)
+	if err != nil {
+		t.Fatalf("解析失败: %v", err)
+	}
+	if strings.Count(q.SQL, "NOT (") != 3 {
+		t.Errorf("应有 3 个取反条件: %s", q.SQL)
+	}
+	for _, col := range []string{"images.description", "images.alt_text", "images.lens_model"} {
+		if strings.Contains(q.SQL, col+" LIKE") {
+			t.Errorf("%s 应包在 COALESCE 中: %s", col, q.SQL)
+		}
+	}
+	if len(q.Args) != 9 {
+		t.Errorf("参数数量错误: %v", q.Args)
+	}
+}
@@ -0,0 +1,174 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"log"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/disintegration/imaging"
+)
+
+// renderMaxSize 宽高上限；renderMaxQuality 质量上限；renderURLTTL 签发地址的有效期；
+// renderSecret 签名密钥，取 RENDER_SECRET，未设置时取 JWT_SECRET，都未设置或为公开的示例密钥时为空并停用签名
+var (
+	renderMaxSize    = GetEnvInt("RENDER_MAX_SIZE", 4096)
+	renderMaxQuality = GetEnvInt("RENDER_MAX_QUALITY", 90)
+	renderURLTTL     = GetEnvDuration("RENDER_URL_TTL", 24*time.Hour)
+	renderSecret     = renderSecretFromEnv()
+)
+
+// ErrRenderDisabled 没有配置签名密钥时拒绝签发和校验，避免使用代码中公开的默认 JWT 密钥
+var ErrRenderDisabled = errors.New("未配置 RENDER_SECRET 或 JWT_SECRET（不能是示例密钥），按需缩放不可用")
+
+func renderSecretFromEnv() []byte {
+	key := GetEnv("RENDER_SECRET", os.Getenv("JWT_SECRET"))
+	if key == "" || key == defaultJWTKey {
+		log.Println(ErrRenderDisabled)
+		return nil
+	}
+	return []byte(key)
+}
+
+// RenderParams 按需缩放接口的参数
+type RenderParams struct {
+	Width   int    // 目标宽度，0 表示按高度等比缩放
+	Height  int    // 目标高度，0 表示按宽度等比缩放
+	Fit     string // contain（默认，完整放入）/ cover（裁切填满）/ fill（拉伸）
+	Format  string // jpeg / webp / avif
+	Quality int
+}
+
+// ParseRenderParams 解析 w / h / fit / fmt / q 参数，宽高和质量超出配置范围时收紧到边界
+func ParseRenderParams(v url.Values) (RenderParams, error) {
+	p := RenderParams{Fit: "contain", Format: "jpeg", Quality: min(80, renderMaxQuality)}
+	var err error
+	if p.Width, err = renderInt(v, "w", 0, renderMaxSize); err != nil {
+		return p, err
+	}
+	if p.Height, err = renderInt(v, "h", 0, renderMaxSize); err != nil {
+		return p, err
+	}
+	if p.Width == 0 && p.Height == 0 {
+		return p, errors.New("w 和 h 至少需要提供一个")
+	}
+	if v.Get("q") != "" {
+		if p.Quality, err = renderInt(v, "q", 1, renderMaxQuality); err != nil {
+			return p, err
+		}
+	}
+	if fit := v.Get("fit"); fit != "" {
+		if fit != "contain" && fit != "cover" && fit != "fill" {
+			return p, errors.New("fit 只能是 contain、cover 或 fill")
+		}
+		p.Fit = fit
+	}
+	if f := v.Get("fmt"); f != "" {
+		if f == "jpg" {
+			f = "jpeg"
+		}
+		if f != "jpeg" && f != "webp" && f != "avif" {
+			return p, errors.New("fmt 只能是 jpeg、webp 或 avif")
+		}
+		p.Format = f
+	}
+	return p, nil
+}
+
+// renderInt 读取整数参数并收紧到 [lo, hi]，缺省时为 0
+func renderInt(v url.Values, name string, lo, hi int) (int, error) {
+	raw := v.Get(name)
+	if raw == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil {
+		return 0, fmt.Errorf("%s 必须是整数", name)
+	}
+	return min(max(n, lo), hi), nil
+}
+
+// Query 返回规范化后的查询字符串，签名基于它
+func (p RenderParams) Query() url.Values {
+	return url.Values{
+		"w":   {strconv.Itoa(p.Width)},
+		"h":   {strconv.Itoa(p.Height)},
+		"fit": {p.Fit},
+		"fmt": {p.Format},
+		"q":   {strconv.Itoa(p.Quality)},
+	}
+}
+
+// CacheName 返回缓存对象的文件名，同一组参数总是得到同一个名字
+func (p RenderParams) CacheName() string {
+	ext := p.Format
+	if ext == "jpeg" {
+		ext = "jpg"
+	}
+	return fmt.Sprintf("%dx%d-%s-q%d.%s", p.Width, p.Height, p.Fit, p.Quality, ext)
+}
+
+// SignRender 为某张图片的一组渲染参数签发带过期时间的查询参数，防止请求任意尺寸消耗服务器资源。
+// 过期时间向上取整到整点，同一小时内签发的地址相同，便于浏览器缓存
+func SignRender(imageID uint, p RenderParams, now time.Time) (url.Values, error) {
+	if len(renderSecret) == 0 {
+		return nil, ErrRenderDisabled
+	}
+	exp := now.Add(renderURLTTL).Truncate(time.Hour).Add(time.Hour).Unix()
+	query := p.Query()
+	query.Set("exp", strconv.FormatInt(exp, 10))
+	query.Set("sig", renderSignature(imageID, p, exp))
+	return query, nil
+}
+
+// VerifyRender 校验 query 中的签名和过期时间，返回过期时间；未配置密钥时一律不通过
+func VerifyRender(imageID uint, p RenderParams, query url.Values, now time.Time) (time.Time, bool) {
+	if len(renderSecret) == 0 {
+		return time.Time{}, false
+	}
+	exp, err := strconv.ParseInt(query.Get("exp"), 10, 64)
+	if err != nil || now.Unix() >= exp {
+		return time.Time{}, false
+	}
+	ok := hmac.Equal([]byte(renderSignature(imageID, p, exp)), []byte(query.Get("sig")))
+	return time.Unix(exp, 0), ok
+}
+
+func renderSignature(imageID uint, p RenderParams, exp int64) string {
+	mac := hmac.New(sha256.New, renderSecret)
+	fmt.Fprintf(mac, "%d?%s&exp=%d", imageID, p.Query().Encode(), exp)
+	return hex.EncodeToString(mac.Sum(nil)[:16])
+}
+
+// RenderImage 按参数缩放或裁切已摆正方向的图片，不会放大原图
+func RenderImage(img image.Image, p RenderParams) image.Image {
+	b := img.Bounds()
+	w, h := p.Width, p.Height
+	if w == 0 || h == 0 {
+		// 只给一边时等比缩放，fit 不再起作用
+		if (w == 0 || w >= b.Dx()) && (h == 0 || h >= b.Dy()) {
+			return img
+		}
+		return imaging.Resize(img, w, h, imaging.Lanczos)
+	}
+	// 目标尺寸超过原图时按比例缩小到原图范围内
+	if w > b.Dx() || h > b.Dy() {
+		scale := min(float64(b.Dx())/float64(w), float64(b.Dy())/float64(h))
+		w, h = max(1, int(float64(w)*scale)), max(1, int(float64(h)*scale))
+	}
+	switch p.Fit {
+	case "cover":
+		return imaging.Fill(img, w, h, imaging.Center, imaging.Lanczos)
+	case "fill":
+		return imaging.Resize(img, w, h, imaging.Lanczos)
+	default:
+		return imaging.Fit(img, w, h, imaging.Lanczos)
+	}
+}
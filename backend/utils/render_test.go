@@ -0,0 +1,103 @@
+package utils
+
+import (
+	"image"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestParseRenderParams(t *testing.T) {
+	p, err := ParseRenderParams(url.Values{"w": {"800"}, "h": {"600"}, "fit": {"cover"}, "fmt": {"webp"}, "q": {"75"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p != (RenderParams{Width: 800, Height: 600, Fit: "cover", Format: "webp", Quality: 75}) {
+		t.Fatalf("解析结果错误: %+v", p)
+	}
+	if p.CacheName() != "800x600-cover-q75.webp" {
+		t.Errorf("缓存文件名错误: %s", p.CacheName())
+	}
+
+	// 超出配置范围的宽高和质量收紧到边界
+	p, err = ParseRenderParams(url.Values{"w": {"99999"}, "h": {"-5"}, "q": {"100"}})
+	if err != nil || p.Width != renderMaxSize || p.Height != 0 || p.Quality != renderMaxQuality || p.Format != "jpeg" {
+		t.Errorf("应收紧到配置范围，实际: %+v, %v", p, err)
+	}
+
+	for _, v := range []url.Values{
+		{},
+		{"w": {"0"}, "h": {"0"}},
+		{"w": {"abc"}},
+		{"w": {"800"}, "q": {"high"}},
+		{"w": {"800"}, "fit": {"stretch"}},
+		{"w": {"800"}, "fmt": {"gif"}},
+	} {
+		if _, err := ParseRenderParams(v); err == nil {
+			t.Errorf("参数 %v 应当被拒绝", v)
+		}
+	}
+}
+
+func TestSignRender(t *testing.T) {
+	defer func(old []byte) { renderSecret = old }(renderSecret)
+	renderSecret = nil
+	p0, _ := ParseRenderParams(url.Values{"w": {"800"}})
+	if _, err := SignRender(1, p0, time.Now()); err != ErrRenderDisabled {
+		t.Errorf("未配置密钥时应拒绝签发，实际: %v", err)
+	}
+	if _, ok := VerifyRender(1, p0, url.Values{"exp": {"99999999999"}, "sig": {""}}, time.Now()); ok {
+		t.Error("未配置密钥时校验不应通过")
+	}
+	renderSecret = []byte("test-secret")
+
+	p, _ := ParseRenderParams(url.Values{"w": {"800"}, "h": {"600"}, "fit": {"cover"}})
+	now := time.Date(2024, 6, 1, 10, 20, 0, 0, time.UTC)
+	query, err := SignRender(1, p, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := VerifyRender(1, p, query, now); !ok {
+		t.Fatal("签名校验失败")
+	}
+	// 同一小时内签发的地址相同
+	if again, _ := SignRender(1, p, now.Add(30*time.Minute)); again.Encode() != query.Encode() {
+		t.Errorf("同一小时内签发的地址应相同: %s / %s", query.Encode(), again.Encode())
+	}
+	if _, ok := VerifyRender(2, p, query, now); ok {
+		t.Error("签名不应适用于其他图片")
+	}
+	other := p
+	other.Width = 4000
+	if _, ok := VerifyRender(1, other, query, now); ok {
+		t.Error("签名不应适用于其他尺寸")
+	}
+	if _, ok := VerifyRender(1, p, query, now.Add(renderURLTTL+2*time.Hour)); ok {
+		t.Error("过期的签名不应通过")
+	}
+	tampered := url.Values{"exp": {"99999999999"}, "sig": {query.Get("sig")}}
+	if _, ok := VerifyRender(1, p, tampered, now); ok {
+		t.Error("修改过期时间后签名不应通过")
+	}
+}
+
+func TestRenderImage(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 800, 600))
+	cases := []struct {
+		p    RenderParams
+		w, h int
+	}{
+		{RenderParams{Width: 400, Fit: "contain"}, 400, 300},
+		{RenderParams{Width: 2000, Fit: "contain"}, 800, 600},
+		{RenderParams{Width: 400, Height: 400, Fit: "contain"}, 400, 300},
+		{RenderParams{Width: 400, Height: 400, Fit: "cover"}, 400, 400},
+		{RenderParams{Width: 400, Height: 100, Fit: "fill"}, 400, 100},
+		{RenderParams{Width: 1600, Height: 1600, Fit: "cover"}, 600, 600},
+	}
+	for _, tc := range cases {
+		b := RenderImage(src, tc.p).Bounds()
+		if b.Dx() != tc.w || b.Dy() != tc.h {
+			t.Errorf("%+v: 期望 %dx%d，实际 %dx%d", tc.p, tc.w, tc.h, b.Dx(), b.Dy())
+		}
+	}
+}
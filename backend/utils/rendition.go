@@ -0,0 +1,216 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/disintegration/imaging"
+)
+
+// RenditionSpec 一种派生尺寸：名称和最大宽度
+type RenditionSpec struct {
+	Name  string
+	Width int
+}
+
+// RenditionConfig 派生图配置
+type RenditionConfig struct {
+	Specs   []RenditionSpec
+	Formats []string // jpeg / webp / avif，按顺序生成
+	Quality int
+	// RequireEncoders 为 true 时配置的格式缺少编码命令视为启动错误，否则只记录警告并跳过该格式
+	RequireEncoders bool
+}
+
+// RenditionConfigFromEnv 从环境变量读取派生图配置。
+// RENDITIONS 形如 "grid:200,preview:1200,full:2560"，RENDITION_FORMATS 形如 "jpeg,webp,avif"。
+func RenditionConfigFromEnv() RenditionConfig {
+	cfg := RenditionConfig{
+		Quality:         GetEnvInt("RENDITION_QUALITY", 80),
+		RequireEncoders: GetEnvBool("RENDITION_REQUIRE_ENCODERS", false),
+	}
+	for _, item := range strings.Split(GetEnv("RENDITIONS", "grid:200,preview:1200,full:2560"), ",") {
+		name, width, ok := strings.Cut(strings.TrimSpace(item), ":")
+		w, err := strconv.Atoi(width)
+		if !ok || name == "" || err != nil || w <= 0 {
+			log.Printf("忽略无效的派生图配置: %q", item)
+			continue
+		}
+		cfg.Specs = append(cfg.Specs, RenditionSpec{Name: name, Width: w})
+	}
+	for _, f := range strings.Split(GetEnv("RENDITION_FORMATS", "jpeg,webp,avif"), ",") {
+		if f = strings.ToLower(strings.TrimSpace(f)); f != "" {
+			cfg.Formats = append(cfg.Formats, f)
+		}
+	}
+	return cfg
+}
+
+// ImageEncoder 将图片编码为某种格式
+type ImageEncoder interface {
+	Format() string
+	Ext() string
+	ContentType() string
+	Encode(img image.Image, quality int) ([]byte, error)
+}
+
+// ErrEncoderDisabled 编码命令模板设为 none，格式被有意禁用
+var ErrEncoderDisabled = errors.New("编码已禁用")
+
+// NewImageEncoder 返回指定格式的编码器；依赖的外部命令不存在时返回错误。
+// WebP 和 AVIF 通过 cwebp / avifenc 编码，可用 WEBP_ENCODER / AVIF_ENCODER 指定命令模板。
+func NewImageEncoder(format string) (ImageEncoder, error) {
+	switch format {
+	case "jpeg", "jpg":
+		return jpegEncoder{}, nil
+	case "webp":
+		return newCommandEncoder("webp", "image/webp", GetEnv("WEBP_ENCODER", "cwebp -quiet -q {q} {in} -o {out}"))
+	case "avif":
+		return newCommandEncoder("avif", "image/avif", GetEnv("AVIF_ENCODER", "avifenc -s 8 -q {q} {in} {out}"))
+	default:
+		return nil, fmt.Errorf("不支持的派生图格式: %s", format)
+	}
+}
+
+// Encoders 返回配置中可用的编码器。有意禁用的格式直接跳过；
+// 缺少编码命令等原因不可用的格式也会跳过，汇总后作为错误返回，由调用方决定警告还是拒绝启动
+func (c RenditionConfig) Encoders() ([]ImageEncoder, error) {
+	var out []ImageEncoder
+	var errs []error
+	for _, f := range c.Formats {
+		enc, err := NewImageEncoder(f)
+		if errors.Is(err, ErrEncoderDisabled) {
+			log.Printf("派生图格式 %s 已禁用", f)
+			continue
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("派生图格式 %s 不可用: %w", f, err))
+			continue
+		}
+		out = append(out, enc)
+	}
+	return out, errors.Join(errs...)
+}
+
+type jpegEncoder struct{}
+
+func (jpegEncoder) Format() string      { return "jpeg" }
+func (jpegEncoder) Ext() string         { return "jpg" }
+func (jpegEncoder) ContentType() string { return "image/jpeg" }
+
+func (jpegEncoder) Encode(img image.Image, quality int) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	err := jpeg.Encode(buf, img, &jpeg.Options{Quality: quality})
+	return buf.Bytes(), err
+}
+
+// commandEncoder 调用外部命令编码，{in}/{out}/{q} 为输入 PNG、输出文件和质量
+type commandEncoder struct {
+	format      string
+	contentType string
+	args        []string
+}
+
+func newCommandEncoder(format, contentType, tmpl string) (ImageEncoder, error) {
+	args := strings.Fields(tmpl)
+	if len(args) == 0 || tmpl == "none" {
+		return nil, fmt.Errorf("%s %w", format, ErrEncoderDisabled)
+	}
+	if _, err := exec.LookPath(args[0]); err != nil {
+		return nil, err
+	}
+	return &commandEncoder{format: format, contentType: contentType, args: args}, nil
+}
+
+func (e *commandEncoder) Format() string      { return e.format }
+func (e *commandEncoder) Ext() string         { return e.format }
+func (e *commandEncoder) ContentType() string { return e.contentType }
+
+func (e *commandEncoder) Encode(img image.Image, quality int) ([]byte, error) {
+	dir, err := os.MkdirTemp("", "gallery-encode-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	in, out := filepath.Join(dir, "in.png"), filepath.Join(dir, "out."+e.format)
+	f, err := os.Create(in)
+	if err != nil {
+		return nil, err
+	}
+	err = (&png.Encoder{CompressionLevel: png.BestSpeed}).Encode(f, img)
+	f.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), GetEnvDuration("RENDITION_ENCODE_TIMEOUT", time.Minute))
+	defer cancel()
+	r := strings.NewReplacer("{in}", in, "{out}", out, "{q}", strconv.Itoa(quality))
+	args := make([]string, len(e.args))
+	for i, a := range e.args {
+		args[i] = r.Replace(a)
+	}
+	if output, err := exec.CommandContext(ctx, args[0], args[1:]...).CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("%s 编码失败: %v: %s", e.format, err, strings.TrimSpace(string(output)))
+	}
+	return os.ReadFile(out)
+}
+
+// Rendition 编码后的派生图
+type Rendition struct {
+	Name        string
+	Format      string
+	Ext         string
+	ContentType string
+	Width       int
+	Height      int
+	Data        []byte
+}
+
+// MakeRenditions 按配置生成各尺寸、各格式的派生图。
+// 不放大原图：宽度不小于原图的尺寸只保留第一个，并使用原图尺寸。
+func MakeRenditions(img image.Image, cfg RenditionConfig, encoders []ImageEncoder) []Rendition {
+	var out []Rendition
+	srcWidth := img.Bounds().Dx()
+	coveredSource := false
+	for _, spec := range cfg.Specs {
+		resized := img
+		if spec.Width < srcWidth {
+			resized = imaging.Resize(img, spec.Width, 0, imaging.Lanczos)
+		} else if coveredSource {
+			continue
+		} else {
+			coveredSource = true
+		}
+		for _, enc := range encoders {
+			data, err := enc.Encode(resized, cfg.Quality)
+			if err != nil {
+				log.Printf("派生图 %s.%s 生成失败: %v", spec.Name, enc.Ext(), err)
+				continue
+			}
+			out = append(out, Rendition{
+				Name:        spec.Name,
+				Format:      enc.Format(),
+				Ext:         enc.Ext(),
+				ContentType: enc.ContentType(),
+				Width:       resized.Bounds().Dx(),
+				Height:      resized.Bounds().Dy(),
+				Data:        data,
+			})
+		}
+	}
+	return out
+}
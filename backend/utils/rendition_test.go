@@ -0,0 +1,52 @@
+package utils
+
+import (
+	"image"
+	"strings"
+	"testing"
+)
+
+func TestRenditionConfigFromEnv(t *testing.T) {
+	t.Setenv("RENDITIONS", "grid:200, bad, preview:1200,zero:0")
+	t.Setenv("RENDITION_FORMATS", "JPEG, webp")
+	cfg := RenditionConfigFromEnv()
+	if len(cfg.Specs) != 2 || cfg.Specs[0] != (RenditionSpec{"grid", 200}) || cfg.Specs[1] != (RenditionSpec{"preview", 1200}) {
+		t.Fatalf("尺寸配置解析错误: %+v", cfg.Specs)
+	}
+	if len(cfg.Formats) != 2 || cfg.Formats[0] != "jpeg" || cfg.Formats[1] != "webp" {
+		t.Fatalf("格式配置解析错误: %+v", cfg.Formats)
+	}
+}
+
+func TestMakeRenditions_NoUpscale(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 800, 600))
+	cfg := RenditionConfig{
+		Specs:   []RenditionSpec{{"grid", 200}, {"preview", 1200}, {"full", 2560}},
+		Quality: 80,
+	}
+	out := MakeRenditions(src, cfg, []ImageEncoder{jpegEncoder{}})
+	if len(out) != 2 {
+		t.Fatalf("应生成 2 个派生图，实际 %d 个", len(out))
+	}
+	if out[0].Name != "grid" || out[0].Width != 200 || out[0].Height != 150 {
+		t.Errorf("grid 尺寸错误: %+v", out[0])
+	}
+	if out[1].Name != "preview" || out[1].Width != 800 || out[1].Height != 600 {
+		t.Errorf("超过原图宽度时应使用原图尺寸: %+v", out[1])
+	}
+	if out[0].Ext != "jpg" || len(out[0].Data) == 0 {
+		t.Errorf("JPEG 编码结果错误: %+v", out[0].Ext)
+	}
+}
+
+func TestRenditionConfig_Encoders(t *testing.T) {
+	t.Setenv("WEBP_ENCODER", "none")
+	t.Setenv("AVIF_ENCODER", "smart-gallery-missing-avifenc {in} {out}")
+	encs, err := RenditionConfig{Formats: []string{"jpeg", "webp", "avif"}}.Encoders()
+	if len(encs) != 1 || encs[0].Format() != "jpeg" {
+		t.Fatalf("只应保留 jpeg 编码器: %v", encs)
+	}
+	if err == nil || !strings.Contains(err.Error(), "avif") || strings.Contains(err.Error(), "webp") {
+		t.Errorf("缺少编码命令的格式应报错，有意禁用的格式不报错: %v", err)
+	}
+}
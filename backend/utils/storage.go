@@ -0,0 +1,75 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"strings"
+	"time"
+)
+
+// ErrObjectNotFound 对象不存在时由各存储后端返回
+var ErrObjectNotFound = errors.New("object not found")
+
+// ObjectInfo 描述存储中的一个对象
+type ObjectInfo struct {
+	Key          string
+	Size         int64
+	ContentType  string
+	LastModified time.Time
+}
+
+// Storage 对象存储抽象，MinIO 与本地目录都实现该接口
+type Storage interface {
+	// Put 写入对象，返回前端可访问的相对 URL
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) (string, error)
+	// Get 读取对象内容，调用方负责关闭
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Stat 获取对象元信息
+	Stat(ctx context.Context, key string) (ObjectInfo, error)
+	// Delete 删除对象，对象不存在时不报错
+	Delete(ctx context.Context, key string) error
+	// List 按前缀列出对象
+	List(ctx context.Context, prefix string) ([]ObjectInfo, error)
+	// URL 返回对象的相对访问路径
+	URL(key string) string
+	// KeyFromURL 从数据库中保存的 URL 还原对象名
+	KeyFromURL(url string) string
+}
+
+// Store 当前使用的存储后端，由 InitStorage 根据配置初始化
+var Store Storage
+
+// InitStorage 根据 STORAGE_BACKEND 选择存储后端（minio 或 local）
+func InitStorage() {
+	backend := strings.ToLower(GetEnv("STORAGE_BACKEND", "minio"))
+	switch backend {
+	case "minio":
+		s, err := NewMinioStorage(MinioConfigFromEnv())
+		if err != nil {
+			log.Fatalln("MinIO 连接失败:", err)
+		}
+		log.Println("成功连接到 MinIO")
+		Store = s
+	case "local":
+		s, err := NewLocalStorage(GetEnv("LOCAL_STORAGE_DIR", "./data/objects"), GetEnv("LOCAL_STORAGE_URL_PREFIX", "/files"))
+		if err != nil {
+			log.Fatalln("本地存储初始化失败:", err)
+		}
+		log.Println("使用本地存储目录:", s.Root)
+		Store = s
+	default:
+		log.Fatalf("未知的存储后端: %s", backend)
+	}
+}
+
+// BlobPrefix 返回按内容哈希组织的对象目录，原图及其派生文件都放在该目录下
+func BlobPrefix(hash string) string {
+	return "blobs/" + hash + "/"
+}
+
+// BlobKey 返回内容哈希目录下指定文件的对象名
+func BlobKey(hash, name string) string {
+	return BlobPrefix(hash) + name
+}
@@ -0,0 +1,112 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestLocalStorage_PutGetStatDelete(t *testing.T) {
+	s, err := NewLocalStorage(t.TempDir(), "/files")
+	if err != nil {
+		t.Fatalf("创建本地存储失败: %v", err)
+	}
+	ctx := context.Background()
+
+	url, err := s.Put(ctx, "a/b.jpg", strings.NewReader("hello"), 5, "image/jpeg")
+	if err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+	if url != "/files/a/b.jpg" {
+		t.Errorf("URL 不符合预期: %s", url)
+	}
+	if key := s.KeyFromURL(url); key != "a/b.jpg" {
+		t.Errorf("KeyFromURL 不符合预期: %s", key)
+	}
+
+	info, err := s.Stat(ctx, "a/b.jpg")
+	if err != nil || info.Size != 5 {
+		t.Errorf("Stat 结果异常: %+v %v", info, err)
+	}
+
+	rc, err := s.Get(ctx, "a/b.jpg")
+	if err != nil {
+		t.Fatalf("读取失败: %v", err)
+	}
+	data, _ := io.ReadAll(rc)
+	rc.Close()
+	if string(data) != "hello" {
+		t.Errorf("读取内容不符: %q", data)
+	}
+
+	objs, err := s.List(ctx, "a/")
+	if err != nil || len(objs) != 1 || objs[0].Key != "a/b.jpg" {
+		t.Errorf("List 结果异常: %+v %v", objs, err)
+	}
+
+	if err := s.Delete(ctx, "a/b.jpg"); err != nil {
+		t.Fatalf("删除失败: %v", err)
+	}
+	if _, err := s.Stat(ctx, "a/b.jpg"); !errors.Is(err, ErrObjectNotFound) {
+		t.Errorf("删除后应返回 ErrObjectNotFound，实际: %v", err)
+	}
+	// 重复删除不报错
+	if err := s.Delete(ctx, "a/b.jpg"); err != nil {
+		t.Errorf("重复删除不应报错: %v", err)
+	}
+}
+
+func TestLocalStorage_RejectsEscapingKeys(t *testing.T) {
+	root := t.TempDir()
+	s, err := NewLocalStorage(root, "/files")
+	if err != nil {
+		t.Fatalf("创建本地存储失败: %v", err)
+	}
+
+	p, err := s.path("../../etc/passwd")
+	if err != nil {
+		t.Fatalf("path 出错: %v", err)
+	}
+	if !strings.HasPrefix(p, s.Root) {
+		t.Errorf("对象路径逃逸出根目录: %s", p)
+	}
+}
+
+func TestLocalStorage_ListPrefix(t *testing.T) {
+	s, err := NewLocalStorage(t.TempDir(), "/files")
+	if err != nil {
+		t.Fatalf("创建本地存储失败: %v", err)
+	}
+	ctx := context.Background()
+	for _, key := range []string{"blobs/ab12/original", "blobs/ab12/thumb.jpg", "blobs/ab34/original", "blobs/cd56/original", "renders/x.jpg"} {
+		if _, err := s.Put(ctx, key, strings.NewReader("x"), 1, ""); err != nil {
+			t.Fatalf("写入 %s 失败: %v", key, err)
+		}
+	}
+
+	cases := map[string]int{
+		"blobs/ab12/": 2,
+		"blobs/ab":    3,
+		"blobs/":      4,
+		"":            5,
+		"missing/":    0,
+		"blobs/zz/":   0,
+	}
+	for prefix, want := range cases {
+		objs, err := s.List(ctx, prefix)
+		if err != nil || len(objs) != want {
+			t.Errorf("List(%q) = %d 个对象, %v；期望 %d 个", prefix, len(objs), err, want)
+		}
+	}
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := s.Put(canceled, "a.jpg", strings.NewReader("x"), 1, ""); !errors.Is(err, context.Canceled) {
+		t.Errorf("上下文取消后写入应失败，实际: %v", err)
+	}
+	if _, err := s.Get(canceled, "renders/x.jpg"); !errors.Is(err, context.Canceled) {
+		t.Errorf("上下文取消后读取应失败，实际: %v", err)
+	}
+}
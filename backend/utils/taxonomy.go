@@ -0,0 +1,128 @@
+package utils
+
+import (
+	"bufio"
+	_ "embed"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// defaultTaxonomy 内置的受控标签词表
+//
+//go:embed taxonomy.txt
+var defaultTaxonomy string
+
+// Taxonomy 受控标签词表：模型输出的标签及其同义词统一映射为词表中的标签名
+type Taxonomy struct {
+	Labels  []string          // 按文件中的顺序排列的标签名
+	aliases map[string]string // 小写的标签名或同义词 -> 标签名
+}
+
+// ParseTaxonomy 读取词表，每行 "标签: 同义词, 同义词"，# 开头的行为注释
+func ParseTaxonomy(r io.Reader) (*Taxonomy, error) {
+	t := &Taxonomy{aliases: map[string]string{}}
+	sc := bufio.NewScanner(r)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, rest, _ := strings.Cut(strings.ReplaceAll(line, "：", ":"), ":")
+		name = strings.TrimSpace(name)
+		if name == "" || strings.Contains(name, ",") {
+			return nil, fmt.Errorf("词表第 %d 行格式错误", n)
+		}
+		if _, ok := t.aliases[strings.ToLower(name)]; !ok {
+			t.Labels = append(t.Labels, name)
+		}
+		t.aliases[strings.ToLower(name)] = name
+		for _, alias := range strings.FieldsFunc(rest, func(r rune) bool { return r == ',' || r == '，' }) {
+			if alias = strings.ToLower(strings.TrimSpace(alias)); alias != "" {
+				t.aliases[alias] = name
+			}
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if len(t.Labels) == 0 {
+		return nil, fmt.Errorf("词表为空")
+	}
+	return t, nil
+}
+
+// LoadTaxonomy 读取 path 指定的词表，path 为空时使用内置词表
+func LoadTaxonomy(path string) (*Taxonomy, error) {
+	if path == "" {
+		return ParseTaxonomy(strings.NewReader(defaultTaxonomy))
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseTaxonomy(f)
+}
+
+// Canonical 返回标签在词表中的标准名称；“风景照”“建筑图片”这类带后缀的写法也能识别
+func (t *Taxonomy) Canonical(label string) (string, bool) {
+	s := strings.ToLower(strings.TrimSpace(label))
+	if name, ok := t.aliases[s]; ok {
+		return name, true
+	}
+	for _, suffix := range []string{"照片", "图片", "照", "图"} {
+		if trimmed := strings.TrimSuffix(s, suffix); trimmed != s && trimmed != "" {
+			if name, ok := t.aliases[trimmed]; ok {
+				return name, true
+			}
+		}
+	}
+	return "", false
+}
+
+// LabelResult 模型给出的一个标签及其置信度（0-1）
+type LabelResult struct {
+	Label      string  `json:"label"`
+	Confidence float64 `json:"confidence"`
+}
+
+// MapLabels 将模型给出的标签映射到词表后去重（保留最高置信度），按置信度从高到低排列；
+// 不在词表中的标签被丢弃，置信度限制在 0-1。
+func (t *Taxonomy) MapLabels(labels []LabelResult) []LabelResult {
+	best := map[string]float64{}
+	var order []string
+	for _, l := range labels {
+		name, ok := t.Canonical(l.Label)
+		if !ok {
+			continue
+		}
+		conf := min(max(l.Confidence, 0), 1)
+		if prev, seen := best[name]; !seen {
+			order = append(order, name)
+			best[name] = conf
+		} else if conf > prev {
+			best[name] = conf
+		}
+	}
+	out := make([]LabelResult, len(order))
+	for i, name := range order {
+		out[i] = LabelResult{Label: name, Confidence: best[name]}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Confidence > out[j].Confidence })
+	return out
+}
+
+// SplitLabels 按阈值拆分标签：达到阈值的直接作为图片标签，其余作为待确认的建议
+func SplitLabels(labels []LabelResult, threshold float64) (applied, suggested []LabelResult) {
+	for _, l := range labels {
+		if l.Confidence >= threshold {
+			applied = append(applied, l)
+		} else {
+			suggested = append(suggested, l)
+		}
+	}
+	return applied, suggested
+}
@@ -0,0 +1,84 @@
+package utils
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestTaxonomyCanonical(t *testing.T) {
+	tax, err := LoadTaxonomy("")
+	if err != nil {
+		t.Fatalf("加载内置词表失败: %v", err)
+	}
+	for _, in := range []string{"风景", "风景照", "自然风景", "Landscape", "风景图片"} {
+		if got, ok := tax.Canonical(in); !ok || got != "风景" {
+			t.Errorf("%q 应映射为 风景，实际 %q (%v)", in, got, ok)
+		}
+	}
+	if _, ok := tax.Canonical("量子计算机"); ok {
+		t.Errorf("词表外的标签不应被识别")
+	}
+	for _, label := range stubLabels {
+		if _, ok := tax.Canonical(label); !ok {
+			t.Errorf("stub 标签 %q 不在内置词表中", label)
+		}
+	}
+}
+
+func TestParseTaxonomy_Invalid(t *testing.T) {
+	if _, err := ParseTaxonomy(strings.NewReader("# 只有注释\n")); err == nil {
+		t.Errorf("空词表应报错")
+	}
+	if _, err := ParseTaxonomy(strings.NewReader(": 别名\n")); err == nil {
+		t.Errorf("缺少标签名应报错")
+	}
+}
+
+func TestParseAnalysis(t *testing.T) {
+	tax, _ := ParseTaxonomy(strings.NewReader("风景: 风景照, 自然风景\n人像: 人物\n"))
+
+	raw := "<|begin_of_box|>```json\n[{\"label\":\"风景照\",\"confidence\":0.7},{\"label\":\"人物\",\"confidence\":0.95}," +
+		"{\"label\":\"自然风景\",\"confidence\":0.8},{\"label\":\"外星人\",\"confidence\":0.99},{\"name\":\"人像\",\"score\":1.5}]\n```<|end_of_box|>"
+	got := ParseAnalysis(raw, tax).Labels
+	want := []LabelResult{{"人像", 1}, {"风景", 0.8}}
+	if len(got) != len(want) {
+		t.Fatalf("解析结果数量不符: %v", got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("第 %d 个标签: got %v want %v", i, got[i], want[i])
+		}
+	}
+
+	// 非 JSON 输出按逗号分隔的标签处理
+	got = ParseAnalysis("风景，人物。", tax).Labels
+	if len(got) != 2 || got[0].Label != "风景" || got[0].Confidence != 1 {
+		t.Errorf("纯文本输出解析结果不符: %v", got)
+	}
+
+	// 完整的 JSON 对象保留描述中的中文标点
+	res := ParseAnalysis(`{"labels":[{"label":"风景","confidence":0.9}],"description":"海边，日落。","alt_text":"A beach at sunset"}`, tax)
+	if len(res.Labels) != 1 || res.Description != "海边，日落。" || res.AltText != "A beach at sunset" {
+		t.Errorf("JSON 对象解析结果不符: %+v", res)
+	}
+}
+
+func TestSplitLabels(t *testing.T) {
+	applied, suggested := SplitLabels([]LabelResult{{"风景", 0.9}, {"人像", 0.6}, {"美食", 0.3}}, 0.6)
+	if len(applied) != 2 || len(suggested) != 1 || suggested[0].Label != "美食" {
+		t.Errorf("按阈值拆分结果不符: %v / %v", applied, suggested)
+	}
+}
+
+func TestStubProvider_MultiLabel(t *testing.T) {
+	tax, _ := LoadTaxonomy("")
+	raw, _ := NewStubProvider().Analyze(context.Background(), []byte("some image"), AnalysisPrompt(tax))
+	res := ParseAnalysis(raw, tax)
+	if len(res.Labels) == 0 || res.Labels[0].Label != stubLabel([]byte("some image")) || res.Labels[0].Confidence < 0.6 {
+		t.Errorf("stub 输出应以高置信度的主标签开头: %q -> %v", raw, res.Labels)
+	}
+	if res.Description == "" || res.AltText == "" {
+		t.Errorf("stub 输出应包含描述和替代文本: %q", raw)
+	}
+}
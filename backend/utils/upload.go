@@ -0,0 +1,202 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"image"
+	"image/jpeg"
+	"io"
+	"os"
+
+	"github.com/disintegration/imaging"
+)
+
+// ErrUploadTooLarge 上传文件超过 UPLOAD_MAX_SIZE
+var ErrUploadTooLarge = errors.New("upload too large")
+
+// ErrImageTooLarge 图片像素数超过 UPLOAD_MAX_PIXELS，拒绝整图解码
+var ErrImageTooLarge = errors.New("image has too many pixels to decode")
+
+// UploadLimits 控制单个上传请求的资源占用
+type UploadLimits struct {
+	MaxMemory int64 // 每个请求最多缓存在内存中的字节数，超出部分写入临时文件
+	MaxSize   int64 // 单个文件的最大字节数
+	SniffSize int   // 用于 EXIF 嗅探的文件头字节数
+	MaxPixels int64 // 允许整图解码（生成缩略图）的最大像素数
+}
+
+// UploadLimitsFromEnv 从环境变量读取上传限制
+func UploadLimitsFromEnv() UploadLimits {
+	return UploadLimits{
+		MaxMemory: GetEnvInt64("UPLOAD_MAX_MEMORY", 8<<20),
+		MaxSize:   GetEnvInt64("UPLOAD_MAX_SIZE", 200<<20),
+		SniffSize: GetEnvInt("UPLOAD_SNIFF_SIZE", 256<<10),
+		MaxPixels: GetEnvInt64("UPLOAD_MAX_PIXELS", 120_000_000),
+	}
+}
+
+// decodeSlots 限制同时进行整图解码的数量，解码是上传过程中最耗内存的一步
+var decodeSlots = make(chan struct{}, max(1, GetEnvInt("UPLOAD_DECODE_CONCURRENCY", 2)))
+
+// SpooledFile 上传内容的暂存区：小文件留在内存，超过 MaxMemory 后落盘。
+// 写入过程中同时计算 SHA-256 并保留文件头用于 EXIF 嗅探。
+type SpooledFile struct {
+	limits UploadLimits
+	buf    []byte
+	file   *os.File
+	size   int64
+	hasher hash.Hash
+	head   []byte
+	sum    string
+}
+
+// SpoolUpload 将 r 的内容写入暂存区，调用方负责 Close
+func SpoolUpload(r io.Reader, limits UploadLimits) (*SpooledFile, error) {
+	s := &SpooledFile{limits: limits, hasher: sha256.New()}
+	// 多读一个字节用于判断是否超限
+	n, err := io.Copy(s, io.LimitReader(r, limits.MaxSize+1))
+	if err != nil {
+		s.Close()
+		return nil, err
+	}
+	if n > limits.MaxSize {
+		s.Close()
+		return nil, ErrUploadTooLarge
+	}
+	s.sum = hex.EncodeToString(s.hasher.Sum(nil))
+	return s, nil
+}
+
+// Write 实现 io.Writer
+func (s *SpooledFile) Write(p []byte) (int, error) {
+	s.hasher.Write(p)
+	if need := s.limits.SniffSize - len(s.head); need > 0 {
+		s.head = append(s.head, p[:min(need, len(p))]...)
+	}
+
+	if s.file == nil && s.size+int64(len(p)) > s.limits.MaxMemory {
+		f, err := os.CreateTemp("", "gallery-upload-*")
+		if err != nil {
+			return 0, err
+		}
+		if _, err := f.Write(s.buf); err != nil {
+			f.Close()
+			os.Remove(f.Name())
+			return 0, err
+		}
+		s.file = f
+		s.buf = nil
+	}
+
+	if s.file != nil {
+		n, err := s.file.Write(p)
+		s.size += int64(n)
+		return n, err
+	}
+	s.buf = append(s.buf, p...)
+	s.size += int64(len(p))
+	return len(p), nil
+}
+
+// Size 文件总字节数
+func (s *SpooledFile) Size() int64 { return s.size }
+
+// SHA256 文件内容的十六进制 SHA-256
+func (s *SpooledFile) SHA256() string { return s.sum }
+
+// Head 文件开头的若干字节，用于 EXIF 和格式嗅探
+func (s *SpooledFile) Head() []byte { return s.head }
+
+// NewReader 返回一个从头开始读取的独立 reader，可多次调用
+func (s *SpooledFile) NewReader() *io.SectionReader {
+	if s.file != nil {
+		return io.NewSectionReader(s.file, 0, s.size)
+	}
+	return io.NewSectionReader(bytes.NewReader(s.buf), 0, s.size)
+}
+
+// Close 释放内存并删除临时文件
+func (s *SpooledFile) Close() error {
+	s.buf = nil
+	if s.file == nil {
+		return nil
+	}
+	name := s.file.Name()
+	s.file.Close()
+	s.file = nil
+	return os.Remove(name)
+}
+
+// DecodeImage 在像素数和并发数受限的前提下解码整张图片
+func DecodeImage(r io.ReadSeeker, maxPixels int64) (image.Image, error) {
+	cfg, _, err := image.DecodeConfig(r)
+	if err != nil {
+		return nil, err
+	}
+	if maxPixels > 0 && int64(cfg.Width)*int64(cfg.Height) > maxPixels {
+		return nil, fmt.Errorf("%w: %dx%d", ErrImageTooLarge, cfg.Width, cfg.Height)
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	decodeSlots <- struct{}{}
+	defer func() { <-decodeSlots }()
+
+	img, _, err := image.Decode(r)
+	return img, err
+}
+
+// ApplyOrientation 按 EXIF 方向旋转/翻转图片，使其以正确朝向显示
+func ApplyOrientation(img image.Image, orientation int) image.Image {
+	switch orientation {
+	case 2:
+		return imaging.FlipH(img)
+	case 3:
+		return imaging.Rotate180(img)
+	case 4:
+		return imaging.FlipV(img)
+	case 5:
+		return imaging.Transpose(img)
+	case 6:
+		return imaging.Rotate270(img)
+	case 7:
+		return imaging.Transverse(img)
+	case 8:
+		return imaging.Rotate90(img)
+	default:
+		return img
+	}
+}
+
+// EncodeJPEG 将图片缩放到不超过 maxWidth 宽后编码为 JPEG
+func EncodeJPEG(img image.Image, maxWidth int, quality int) ([]byte, error) {
+	if img.Bounds().Dx() > maxWidth {
+		img = imaging.Resize(img, maxWidth, 0, imaging.Lanczos)
+	}
+	buf := new(bytes.Buffer)
+	if err := jpeg.Encode(buf, img, &jpeg.Options{Quality: quality}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// MakePreview 从原图生成送给视觉模型的缩小预览图，按 orientation 摆正方向。
+// 无法解码的格式在不超过 limits.MaxMemory 字节时直接返回原始内容。
+func MakePreview(r io.ReadSeeker, size int64, maxWidth int, orientation int, limits UploadLimits) ([]byte, error) {
+	img, err := DecodeImage(r, limits.MaxPixels)
+	if err == nil {
+		return EncodeJPEG(ApplyOrientation(img, orientation), maxWidth, 85)
+	}
+	if size > limits.MaxMemory {
+		return nil, err
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
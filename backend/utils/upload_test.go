@@ -0,0 +1,97 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"image"
+	"image/color"
+	"io"
+	"testing"
+)
+
+func TestSpoolUpload_SpillsToDisk(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), 1000)
+	limits := UploadLimits{MaxMemory: 1024, MaxSize: 1 << 20, SniffSize: 16}
+
+	s, err := SpoolUpload(bytes.NewReader(data), limits)
+	if err != nil {
+		t.Fatalf("暂存失败: %v", err)
+	}
+	defer s.Close()
+
+	if s.file == nil {
+		t.Errorf("超过 MaxMemory 时应写入临时文件")
+	}
+	if s.Size() != int64(len(data)) {
+		t.Errorf("大小不符: %d", s.Size())
+	}
+	sum := sha256.Sum256(data)
+	if s.SHA256() != hex.EncodeToString(sum[:]) {
+		t.Errorf("SHA-256 不符: %s", s.SHA256())
+	}
+	if !bytes.Equal(s.Head(), data[:16]) {
+		t.Errorf("文件头不符: %q", s.Head())
+	}
+
+	// 可以多次从头读取
+	for i := 0; i < 2; i++ {
+		got, _ := io.ReadAll(s.NewReader())
+		if !bytes.Equal(got, data) {
+			t.Fatalf("第 %d 次读取内容不符", i+1)
+		}
+	}
+}
+
+func TestSpoolUpload_SmallFileStaysInMemory(t *testing.T) {
+	limits := UploadLimits{MaxMemory: 1024, MaxSize: 1 << 20, SniffSize: 16}
+	s, err := SpoolUpload(bytes.NewReader([]byte("tiny")), limits)
+	if err != nil {
+		t.Fatalf("暂存失败: %v", err)
+	}
+	defer s.Close()
+
+	if s.file != nil {
+		t.Errorf("小文件不应落盘")
+	}
+	if string(s.Head()) != "tiny" {
+		t.Errorf("文件头不符: %q", s.Head())
+	}
+}
+
+func TestSpoolUpload_TooLarge(t *testing.T) {
+	limits := UploadLimits{MaxMemory: 8, MaxSize: 32, SniffSize: 8}
+	_, err := SpoolUpload(bytes.NewReader(make([]byte, 33)), limits)
+	if !errors.Is(err, ErrUploadTooLarge) {
+		t.Errorf("期望 ErrUploadTooLarge，实际: %v", err)
+	}
+}
+
+func TestApplyOrientation(t *testing.T) {
+	// 2x1 的图片：左红右蓝
+	src := image.NewNRGBA(image.Rect(0, 0, 2, 1))
+	red := color.NRGBA{R: 255, A: 255}
+	blue := color.NRGBA{B: 255, A: 255}
+	src.Set(0, 0, red)
+	src.Set(1, 0, blue)
+
+	// 6：顺时针旋转 90° 后左侧像素在上方
+	got := ApplyOrientation(src, 6)
+	if b := got.Bounds(); b.Dx() != 1 || b.Dy() != 2 {
+		t.Fatalf("方向 6 应交换宽高，实际: %v", b)
+	}
+	if got.At(0, 0) != red || got.At(0, 1) != blue {
+		t.Errorf("方向 6 旋转结果不符")
+	}
+
+	// 8：逆时针旋转 90°
+	got = ApplyOrientation(src, 8)
+	if got.At(0, 0) != blue || got.At(0, 1) != red {
+		t.Errorf("方向 8 旋转结果不符")
+	}
+
+	if ApplyOrientation(src, 1) != image.Image(src) {
+		t.Errorf("方向 1 不应修改图片")
+	}
+}
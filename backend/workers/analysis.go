@@ -0,0 +1,329 @@
+package workers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"smart-gallery-backend/database"
+	"smart-gallery-backend/models"
+	"smart-gallery-backend/utils"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// AnalysisConfig AI 分析 worker 池配置
+type AnalysisConfig struct {
+	Workers      int           // 并发 worker 数
+	MaxAttempts  int           // 最大尝试次数，超过后进入死信状态
+	RetryBase    time.Duration // 第一次重试的等待时间，之后指数增长
+	RetryMax     time.Duration // 单次重试等待时间上限
+	PollInterval time.Duration // 队列为空时的轮询间隔
+	LockTimeout  time.Duration // 领取后超过该时间未完成视为 worker 崩溃，任务可被重新领取
+	PreviewWidth int           // 发送给视觉模型的预览图宽度
+}
+
+// AnalysisConfigFromEnv 从环境变量读取 worker 配置
+func AnalysisConfigFromEnv() AnalysisConfig {
+	return AnalysisConfig{
+		Workers:      utils.GetEnvInt("AI_WORKERS", 2),
+		MaxAttempts:  utils.GetEnvInt("AI_MAX_ATTEMPTS", 5),
+		RetryBase:    utils.GetEnvDuration("AI_RETRY_BASE", 10*time.Second),
+		RetryMax:     utils.GetEnvDuration("AI_RETRY_MAX", 10*time.Minute),
+		PollInterval: utils.GetEnvDuration("AI_POLL_INTERVAL", 2*time.Second),
+		LockTimeout:  utils.GetEnvDuration("AI_LOCK_TIMEOUT", 5*time.Minute),
+		PreviewWidth: utils.GetEnvInt("AI_PREVIEW_WIDTH", 1024),
+	}
+}
+
+var analysisConfig = AnalysisConfigFromEnv()
+
+// EnqueueAnalysis 在给定事务中为图片创建分析任务；未启用 AI 分析时不排队，图片标记为已跳过
+func EnqueueAnalysis(tx *gorm.DB, imageID uint) error {
+	if utils.Vision == nil {
+		return tx.Model(&models.Image{}).Where("id = ?", imageID).Update("analysis_status", models.AnalysisSkipped).Error
+	}
+	job := models.AnalysisJob{
+		ImageID:   imageID,
+		Status:    models.JobPending,
+		NextRunAt: time.Now(),
+	}
+	return tx.Create(&job).Error
+}
+
+// EnqueueReanalysis 为已有图片重新排队分析。已有未完成任务的图片不重复排队，只归入该批次；
+// 返回新建的任务数。
+func EnqueueReanalysis(tx *gorm.DB, imageIDs []uint, batchID *uint) (int, error) {
+	queued := 0
+	for start := 0; start < len(imageIDs); start += 1000 {
+		chunk := imageIDs[start:min(start+1000, len(imageIDs))]
+		var active []uint
+		err := tx.Model(&models.AnalysisJob{}).
+			Where("image_id IN ? AND status IN ?", chunk, []string{models.JobPending, models.JobRunning}).
+			Pluck("image_id", &active).Error
+		if err != nil {
+			return queued, err
+		}
+		if batchID != nil && len(active) > 0 {
+			err := tx.Model(&models.AnalysisJob{}).
+				Where("image_id IN ? AND status IN ?", active, []string{models.JobPending, models.JobRunning}).
+				Update("batch_id", *batchID).Error
+			if err != nil {
+				return queued, err
+			}
+		}
+
+		skip := make(map[uint]bool, len(active))
+		for _, id := range active {
+			skip[id] = true
+		}
+		now := time.Now()
+		var jobs []models.AnalysisJob
+		var ids []uint
+		for _, id := range chunk {
+			if !skip[id] {
+				skip[id] = true
+				jobs = append(jobs, models.AnalysisJob{ImageID: id, Status: models.JobPending, NextRunAt: now, BatchID: batchID})
+				ids = append(ids, id)
+			}
+		}
+		if len(jobs) == 0 {
+			continue
+		}
+		if err := tx.Create(&jobs).Error; err != nil {
+			return queued, err
+		}
+		if err := tx.Model(&models.Image{}).Where("id IN ?", ids).Update("analysis_status", models.AnalysisPending).Error; err != nil {
+			return queued, err
+		}
+		queued += len(jobs)
+	}
+	return queued, nil
+}
+
+// StartAnalysisWorkers 启动后台 worker 池
+func StartAnalysisWorkers() {
+	if utils.Vision == nil {
+		skipQueuedAnalysis()
+		return
+	}
+	for i := 0; i < analysisConfig.Workers; i++ {
+		go runWorker(i)
+	}
+	log.Printf("已启动 %d 个 AI 分析 worker", analysisConfig.Workers)
+}
+
+// skipQueuedAnalysis 未启用 AI 分析时结束队列中的任务并把图片标记为已跳过，
+// 避免它们一直停留在待分析状态；配置提供方后可通过重新分析接口补做
+func skipQueuedAnalysis() {
+	var skipped int64
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&models.AnalysisJob{}).
+			Where("status IN ?", []string{models.JobPending, models.JobRunning}).
+			Updates(map[string]interface{}{
+				"status":     models.JobDead,
+				"last_error": utils.ErrVisionDisabled.Error(),
+				"locked_at":  nil,
+			})
+		if res.Error != nil {
+			return res.Error
+		}
+		skipped = res.RowsAffected
+		return tx.Model(&models.Image{}).
+			Where("analysis_status IN ?", []string{models.AnalysisPending, models.AnalysisProcessing}).
+			Update("analysis_status", models.AnalysisSkipped).Error
+	})
+	if err != nil {
+		log.Println("警告: AI 分析未启用，结束队列中的任务失败:", err)
+		return
+	}
+	log.Printf("警告: AI 分析未启用，不启动分析 worker，已跳过队列中的 %d 个任务", skipped)
+}
+
+func runWorker(id int) {
+	for {
+		job, err := claimJob()
+		if err != nil {
+			log.Printf("worker %d 领取任务失败: %v", id, err)
+			time.Sleep(analysisConfig.PollInterval)
+			continue
+		}
+		if job == nil {
+			time.Sleep(analysisConfig.PollInterval)
+			continue
+		}
+		finishJob(job, processJob(job))
+	}
+}
+
+// claimJob 领取一个到期任务；使用 SKIP LOCKED 避免多个 worker 抢同一行
+func claimJob() (*models.AnalysisJob, error) {
+	var job models.AnalysisJob
+	now := time.Now()
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("(status = ? AND next_run_at <= ?) OR (status = ? AND locked_at < ?)",
+				models.JobPending, now, models.JobRunning, now.Add(-analysisConfig.LockTimeout)).
+			Order("next_run_at").
+			First(&job).Error
+		if err != nil {
+			return err
+		}
+		job.Status = models.JobRunning
+		job.LockedAt = &now
+		job.Attempts++
+		if err := tx.Save(&job).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.Image{}).Where("id = ?", job.ImageID).
+			Update("analysis_status", models.AnalysisProcessing).Error
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// processJob 读取原图生成预览并调用视觉模型，成功后替换图片上机器生成的标签、保存标签建议和描述并生成语义向量。
+// 上传后的首次分析和重新分析走同一流程。
+func processJob(job *models.AnalysisJob) error {
+	var img models.Image
+	if err := database.DB.First(&img, job.ImageID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			// 图片已被删除，任务无需继续
+			return nil
+		}
+		return err
+	}
+
+	ctx := context.Background()
+	rc, err := utils.Store.Get(ctx, utils.Store.KeyFromURL(img.Url))
+	if err != nil {
+		return fmt.Errorf("读取原图失败: %w", err)
+	}
+	limits := utils.UploadLimitsFromEnv()
+	spool, err := utils.SpoolUpload(rc, limits)
+	rc.Close()
+	if err != nil {
+		return fmt.Errorf("读取原图失败: %w", err)
+	}
+	defer spool.Close()
+
+	preview, err := utils.MakePreview(spool.NewReader(), spool.Size(), analysisConfig.PreviewWidth, img.Orientation, limits)
+	if err != nil {
+		return fmt.Errorf("生成预览图失败: %w", err)
+	}
+
+	result, err := utils.AnalyzeImage(ctx, img.ContentHash, preview)
+	if err != nil {
+		return err
+	}
+	applied, suggested := utils.SplitLabels(result.Labels, utils.TagThreshold)
+
+	// 机器生成的标签整体替换：新的 AI 标签在前，EXIF 标签按已保存的 EXIF 信息重新生成，用户标签保留；
+	// 置信度不足的标签作为建议等待确认
+	exif := database.ExifFromImage(&img)
+	exifTags := append(utils.ExifTagsFromData(exif), utils.PlaceTagsFromExif(exif)...)
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		current, err := database.ImageTagEntries(tx, img.ID)
+		if err != nil {
+			return err
+		}
+		// 与用户标签重名时保留用户来源，避免把用户标签降级为 AI 标签
+		userTags := make(map[string]models.TagEntry, len(current))
+		for _, e := range current {
+			if e.Source == models.TagSourceUser {
+				userTags[e.Name] = e
+			}
+		}
+		entries := database.TagEntriesFromLabels(applied)
+		for i, e := range entries {
+			if prev, ok := userTags[e.Name]; ok {
+				entries[i] = prev
+			}
+		}
+		for _, tag := range exifTags {
+			entries = append(entries, models.TagEntry{Name: tag, Source: models.TagSourceExif})
+		}
+		for _, e := range current {
+			if e.Source == models.TagSourceUser {
+				entries = append(entries, e)
+			}
+		}
+		if err := database.ReplaceImageTags(tx, img.ID, entries); err != nil {
+			return err
+		}
+		if err := database.ReplaceTagSuggestions(tx, img.ID, suggested); err != nil {
+			return err
+		}
+		// 用户修改过的描述不被覆盖
+		if result.Description != "" || result.AltText != "" {
+			err := tx.Model(&models.Image{}).Where("id = ? AND caption_edited = ?", img.ID, false).
+				Updates(map[string]interface{}{
+					"description": utils.TruncateRunes(result.Description, utils.MaxDescriptionLength),
+					"alt_text":    utils.TruncateRunes(result.AltText, utils.MaxAltTextLength),
+				}).Error
+			if err != nil {
+				return err
+			}
+		}
+		return tx.Model(&models.Image{}).Where("id = ?", img.ID).Update("analysis_status", models.AnalysisDone).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	// 向量生成失败不影响标签结果，可稍后用 reindex-embeddings 补齐
+	if err := EmbedImage(ctx, img.ID, preview); err != nil {
+		log.Printf("图片 %d 生成向量失败: %v", img.ID, err)
+	}
+	return nil
+}
+
+// finishJob 根据执行结果更新任务：成功完成、指数退避重试或进入死信状态
+func finishJob(job *models.AnalysisJob, jobErr error) {
+	if jobErr == nil {
+		database.DB.Model(job).Updates(map[string]interface{}{
+			"status":     models.JobDone,
+			"last_error": "",
+			"locked_at":  nil,
+		})
+		return
+	}
+
+	log.Printf("AI 分析任务 %d（图片 %d）第 %d 次失败: %v", job.ID, job.ImageID, job.Attempts, jobErr)
+
+	if job.Attempts >= analysisConfig.MaxAttempts {
+		database.DB.Model(job).Updates(map[string]interface{}{
+			"status":     models.JobDead,
+			"last_error": jobErr.Error(),
+			"locked_at":  nil,
+		})
+		database.DB.Model(&models.Image{}).Where("id = ?", job.ImageID).
+			Update("analysis_status", models.AnalysisFailed)
+		return
+	}
+
+	database.DB.Model(job).Updates(map[string]interface{}{
+		"status":      models.JobPending,
+		"last_error":  jobErr.Error(),
+		"locked_at":   nil,
+		"next_run_at": time.Now().Add(retryDelay(job.Attempts)),
+	})
+	database.DB.Model(&models.Image{}).Where("id = ?", job.ImageID).
+		Update("analysis_status", models.AnalysisPending)
+}
+
+// retryDelay 第 attempts 次失败后的等待时间：RetryBase * 2^(attempts-1)，不超过 RetryMax
+func retryDelay(attempts int) time.Duration {
+	d := analysisConfig.RetryBase
+	for i := 1; i < attempts && d < analysisConfig.RetryMax; i++ {
+		d *= 2
+	}
+	return min(d, analysisConfig.RetryMax)
+}
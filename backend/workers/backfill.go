@@ -0,0 +1,101 @@
+package workers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"smart-gallery-backend/database"
+	"smart-gallery-backend/models"
+	"smart-gallery-backend/utils"
+
+	"gorm.io/gorm"
+)
+
+// BackfillExif 重新读取所有图片原图的 EXIF，修正尺寸、方向和 EXIF 标签，
+// 并为需要旋转的图片重新生成缩略图。AI 标签和用户标签保持不变。
+func BackfillExif(ctx context.Context) error {
+	limits := utils.UploadLimitsFromEnv()
+	// 同一内容的缩略图只需重新生成一次
+	thumbs := map[string]bool{}
+	var updated, failed int
+
+	var batch []models.Image
+	err := database.DB.Order("id").FindInBatches(&batch, 100, func(_ *gorm.DB, _ int) error {
+		for i := range batch {
+			if err := backfillImageExif(ctx, &batch[i], limits, thumbs); err != nil {
+				log.Printf("图片 %d EXIF 回填失败: %v", batch[i].ID, err)
+				failed++
+				continue
+			}
+			updated++
+		}
+		return nil
+	}).Error
+
+	log.Printf("EXIF 回填完成：成功 %d 张，失败 %d 张", updated, failed)
+	return err
+}
+
+func backfillImageExif(ctx context.Context, img *models.Image, limits utils.UploadLimits, thumbs map[string]bool) error {
+	rc, err := utils.Store.Get(ctx, utils.Store.KeyFromURL(img.Url))
+	if err != nil {
+		return fmt.Errorf("读取原图失败: %w", err)
+	}
+	spool, err := utils.SpoolUpload(rc, limits)
+	rc.Close()
+	if err != nil {
+		return fmt.Errorf("读取原图失败: %w", err)
+	}
+	defer spool.Close()
+
+	exifData := utils.ExtractExifFromReader(spool.NewReader(), spool.Size(), spool.Head())
+
+	// 缩略图与原图相同时（无法解码的格式）无需处理
+	thumbKey := ""
+	if img.ThumbnailUrl != "" && img.ThumbnailUrl != img.Url {
+		thumbKey = utils.Store.KeyFromURL(img.ThumbnailUrl)
+	}
+	rotate := exifData.Orientation > 1 && thumbKey != "" && !thumbs[thumbKey]
+	if rotate || exifData.Resolution == "未知" {
+		decoded, err := utils.DecodeImage(spool.NewReader(), limits.MaxPixels)
+		if err == nil {
+			decoded = utils.ApplyOrientation(decoded, exifData.Orientation)
+			if exifData.Resolution == "未知" {
+				exifData.Resolution = fmt.Sprintf("%dx%d", decoded.Bounds().Dx(), decoded.Bounds().Dy())
+			}
+			if rotate {
+				thumb, err := utils.EncodeJPEG(decoded, 400, 80)
+				if err != nil {
+					return err
+				}
+				if _, err := utils.Store.Put(ctx, thumbKey, bytes.NewReader(thumb), int64(len(thumb)), "image/jpeg"); err != nil {
+					return fmt.Errorf("写入缩略图失败: %w", err)
+				}
+				thumbs[thumbKey] = true
+			}
+		}
+	}
+
+	database.ApplyExif(img, exifData)
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		current, err := database.ImageTagEntries(tx, img.ID)
+		if err != nil {
+			return err
+		}
+		// 保留 AI 和用户标签，EXIF 标签按新数据重新生成
+		var entries []models.TagEntry
+		for _, e := range current {
+			if e.Source != models.TagSourceExif {
+				entries = append(entries, e)
+			}
+		}
+		for _, tag := range append(utils.ExifTagsFromData(exifData), utils.PlaceTagsFromExif(exifData)...) {
+			entries = append(entries, models.TagEntry{Name: tag, Source: models.TagSourceExif})
+		}
+		if err := tx.Omit("Tags", "AnalysisStatus").Save(img).Error; err != nil {
+			return err
+		}
+		return database.ReplaceImageTags(tx, img.ID, entries)
+	})
+}
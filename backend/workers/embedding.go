@@ -0,0 +1,460 @@
+package workers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"path"
+	"smart-gallery-backend/database"
+	"smart-gallery-backend/models"
+	"smart-gallery-backend/utils"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// VectorIndexConfig 向量索引配置
+type VectorIndexConfig struct {
+	Key            string        // 索引文件在对象存储中的键
+	M              int           // HNSW 每层邻居数
+	EfConstruction int           // 建图时的候选集大小
+	EfSearch       int           // 检索时的候选集大小
+	Candidates     int           // 按用户过滤遍历索引时的最小候选集大小
+	ExactScanMax   int           // 可检索的图片不超过该数量时直接逐一计算相似度，不遍历索引
+	SaveInterval   time.Duration // 索引有变更时写回对象存储的间隔
+	CompactPercent int           // 删除标记超过未删除向量数的该百分比时，保存前重建索引
+	SyncMargin     time.Duration // 启动补齐时从 Watermark 往前多取的时长，覆盖更新时间较早但提交较晚的记录
+}
+
+// VectorIndexConfigFromEnv 从环境变量读取向量索引配置，M 小于 2 时层级无法计算，改用默认值
+func VectorIndexConfigFromEnv() VectorIndexConfig {
+	cfg := VectorIndexConfig{
+		Key:            utils.GetEnv("EMBEDDING_INDEX_KEY", "index/vectors.hnsw"),
+		M:              utils.GetEnvInt("EMBEDDING_HNSW_M", 16),
+		EfConstruction: utils.GetEnvInt("EMBEDDING_HNSW_EF_CONSTRUCTION", 200),
+		EfSearch:       utils.GetEnvInt("EMBEDDING_HNSW_EF_SEARCH", 100),
+		Candidates:     utils.GetEnvInt("SEMANTIC_CANDIDATES", 500),
+		ExactScanMax:   utils.GetEnvInt("SEMANTIC_EXACT_SCAN_MAX", 5000),
+		SaveInterval:   utils.GetEnvDuration("EMBEDDING_INDEX_SAVE_INTERVAL", time.Minute),
+		CompactPercent: utils.GetEnvInt("EMBEDDING_INDEX_COMPACT_PERCENT", 20),
+		SyncMargin:     utils.GetEnvDuration("EMBEDDING_INDEX_SYNC_MARGIN", 10*time.Minute),
+	}
+	if cfg.M < 2 {
+		log.Printf("EMBEDDING_HNSW_M 至少为 2，当前为 %d，使用默认值 16", cfg.M)
+		cfg.M = 16
+	}
+	return cfg
+}
+
+// vectorIndex 当前索引，检索直接读取；写入和替换索引都要持有 indexMu，
+// 避免写入已被替换掉的旧索引而丢失向量
+var (
+	indexConfig = VectorIndexConfigFromEnv()
+	vectorIndex atomic.Pointer[utils.HNSW]
+	indexMu     sync.Mutex
+	indexDirty  atomic.Bool
+)
+
+// ErrSemanticUnavailable 向量模型或索引未初始化
+var ErrSemanticUnavailable = errors.New("语义检索未启用")
+
+// InitVectorIndex 从对象存储加载向量索引并补齐上次保存后的变更；索引缺失或模型已变化时从数据库重建。
+// 之后在后台定期把变更写回对象存储，删除标记过多时先重建索引。
+func InitVectorIndex(ctx context.Context) {
+	model := utils.EmbeddingModelID(utils.Embedder)
+	idx, err := loadVectorIndex(ctx)
+	switch {
+	case errors.Is(err, utils.ErrObjectNotFound):
+	case err != nil:
+		log.Printf("读取向量索引失败，将重建: %v", err)
+	case idx.Model != model:
+		log.Printf("向量索引模型已变化（%s -> %s），将重建", idx.Model, model)
+		idx = nil
+	default:
+		if err := syncVectorIndex(idx); err != nil {
+			log.Printf("向量索引同步失败，将重建: %v", err)
+			idx = nil
+		}
+	}
+	if idx == nil {
+		if idx, err = buildVectorIndex(); err != nil {
+			log.Println("构建向量索引失败，语义检索不可用:", err)
+			return
+		}
+		indexDirty.Store(true)
+	}
+	vectorIndex.Store(idx)
+	log.Printf("向量索引已就绪：%d 个向量", idx.Len())
+
+	go func() {
+		for range time.Tick(indexConfig.SaveInterval) {
+			compactVectorIndex()
+			if indexDirty.Swap(false) {
+				if err := SaveVectorIndex(context.Background()); err != nil {
+					indexDirty.Store(true)
+					log.Println("保存向量索引失败:", err)
+				}
+			}
+		}
+	}()
+}
+
+func loadVectorIndex(ctx context.Context) (*utils.HNSW, error) {
+	rc, err := utils.Store.Get(ctx, indexConfig.Key)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return utils.LoadHNSW(rc)
+}
+
+// compactVectorIndex 删除标记超过阈值时用未删除的向量重建索引。
+// 重建期间持有 indexMu，写入等待重建完成后写入新索引，检索继续使用旧索引
+func compactVectorIndex() {
+	indexMu.Lock()
+	defer indexMu.Unlock()
+	idx := vectorIndex.Load()
+	if idx == nil {
+		return
+	}
+	deleted, live := idx.Deleted(), idx.Len()
+	if deleted == 0 || deleted*100 <= live*indexConfig.CompactPercent {
+		return
+	}
+	vectorIndex.Store(idx.Compact())
+	indexDirty.Store(true)
+	log.Printf("向量索引已重建：移除 %d 个删除标记，保留 %d 个向量", deleted, live)
+}
+
+// SaveVectorIndex 把当前索引写入对象存储
+func SaveVectorIndex(ctx context.Context) error {
+	idx := vectorIndex.Load()
+	if idx == nil {
+		return nil
+	}
+	var buf bytes.Buffer
+	if err := idx.Save(&buf); err != nil {
+		return err
+	}
+	_, err := utils.Store.Put(ctx, indexConfig.Key, &buf, int64(buf.Len()), "application/octet-stream")
+	return err
+}
+
+// syncVectorIndex 补入索引保存之后更新的向量，并移除已不存在的图片。
+// 更新时间在语句执行时确定、提交可能更晚，因此从 Watermark 往前多取 SyncMargin，
+// 重复写入的相同向量不会改动索引
+func syncVectorIndex(idx *utils.HNSW) error {
+	var rows []models.ImageEmbedding
+	since := idx.Watermark.Add(-indexConfig.SyncMargin)
+	err := database.DB.Where("model = ? AND updated_at >= ?", idx.Model, since).Find(&rows).Error
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		if vec := combinedVector(&row); vec != nil {
+			idx.Add(row.ImageID, vec)
+		}
+		idx.Advance(row.UpdatedAt)
+	}
+
+	var ids []uint
+	if err := database.DB.Model(&models.ImageEmbedding{}).Where("model = ?", idx.Model).Pluck("image_id", &ids).Error; err != nil {
+		return err
+	}
+	live := make(map[uint]bool, len(ids))
+	for _, id := range ids {
+		live[id] = true
+	}
+	for _, id := range idx.IDs() {
+		if !live[id] {
+			idx.Remove(id)
+		}
+	}
+	return nil
+}
+
+// buildVectorIndex 用数据库中当前模型的向量构建新索引
+func buildVectorIndex() (*utils.HNSW, error) {
+	var idx *utils.HNSW
+	model := utils.EmbeddingModelID(utils.Embedder)
+	var batch []models.ImageEmbedding
+	err := database.DB.Where("model = ?", model).Order("image_id").FindInBatches(&batch, 500, func(_ *gorm.DB, _ int) error {
+		for i := range batch {
+			vec := combinedVector(&batch[i])
+			if vec == nil {
+				continue
+			}
+			if idx == nil {
+				idx = utils.NewHNSW(model, len(vec), indexConfig.M, indexConfig.EfConstruction)
+			}
+			if err := idx.Add(batch[i].ImageID, vec); err != nil {
+				return err
+			}
+			idx.Advance(batch[i].UpdatedAt)
+		}
+		return nil
+	}).Error
+	if err != nil {
+		return nil, err
+	}
+	if idx == nil {
+		// 还没有任何向量，维度在第一次写入时确定
+		idx = utils.NewHNSW(model, 0, indexConfig.M, indexConfig.EfConstruction)
+	}
+	return idx, nil
+}
+
+// combinedVector 文本向量与图片向量之和归一化后作为检索向量
+func combinedVector(row *models.ImageEmbedding) []float32 {
+	text, img := utils.DecodeVector(row.TextVector), utils.DecodeVector(row.ImageVector)
+	switch {
+	case len(text) == 0 && len(img) == 0:
+		return nil
+	case len(img) == 0:
+		return utils.Normalize(text)
+	case len(text) == 0:
+		return utils.Normalize(img)
+	case len(text) != len(img):
+		return utils.Normalize(text)
+	}
+	sum := make([]float32, len(text))
+	for i := range sum {
+		sum[i] = text[i] + img[i]
+	}
+	return utils.Normalize(sum)
+}
+
+// imageDocument 生成用于文本向量的描述：图片描述、替代文本、标签值（去掉分类前缀）和文件名
+func imageDocument(imageID uint) (string, error) {
+	var img models.Image
+	if err := database.DB.Select("id, file_name, description, alt_text").First(&img, imageID).Error; err != nil {
+		return "", err
+	}
+	entries, err := database.ImageTagEntries(database.DB, imageID)
+	if err != nil {
+		return "", err
+	}
+	parts := make([]string, 0, len(entries)+3)
+	for _, s := range []string{img.Description, img.AltText} {
+		if s != "" {
+			parts = append(parts, s)
+		}
+	}
+	for _, e := range entries {
+		parts = append(parts, database.TagValue(e.Name))
+	}
+	if name := strings.TrimSuffix(img.FileName, path.Ext(img.FileName)); name != "" {
+		parts = append(parts, name)
+	}
+	return strings.Join(parts, " "), nil
+}
+
+// EmbedImage 为图片生成文本向量和图片向量（提供方支持时）并写入数据库和索引。
+// preview 为已摆正方向的预览图，为空时只生成文本向量。
+func EmbedImage(ctx context.Context, imageID uint, preview []byte) error {
+	if utils.Embedder == nil {
+		return nil
+	}
+	var imageVec []float32
+	if len(preview) > 0 {
+		vec, err := utils.Embedder.EmbedImage(ctx, preview)
+		if err != nil && !errors.Is(err, utils.ErrImageEmbeddingUnsupported) {
+			return err
+		}
+		imageVec = vec
+	}
+	return saveEmbedding(ctx, imageID, imageVec)
+}
+
+// RefreshEmbeddingText 标签变化后重新生成文本向量，保留已有的图片向量
+func RefreshEmbeddingText(ctx context.Context, imageID uint) error {
+	if utils.Embedder == nil {
+		return nil
+	}
+	var row models.ImageEmbedding
+	err := database.DB.Where("image_id = ? AND model = ?", imageID, utils.EmbeddingModelID(utils.Embedder)).Limit(1).Find(&row).Error
+	if err != nil {
+		return err
+	}
+	return saveEmbedding(ctx, imageID, utils.DecodeVector(row.ImageVector))
+}
+
+// CopyEmbedding 新图片与已有图片内容相同时复用其图片向量，文本向量按新图片的标签生成
+func CopyEmbedding(ctx context.Context, fromID, toID uint) error {
+	if utils.Embedder == nil {
+		return nil
+	}
+	var row models.ImageEmbedding
+	err := database.DB.Where("image_id = ? AND model = ?", fromID, utils.EmbeddingModelID(utils.Embedder)).Limit(1).Find(&row).Error
+	if err != nil {
+		return err
+	}
+	return saveEmbedding(ctx, toID, utils.DecodeVector(row.ImageVector))
+}
+
+func saveEmbedding(ctx context.Context, imageID uint, imageVec []float32) error {
+	doc, err := imageDocument(imageID)
+	if err != nil {
+		return err
+	}
+	var textVec []float32
+	if doc != "" {
+		if textVec, err = utils.Embedder.EmbedText(ctx, doc); err != nil {
+			return err
+		}
+	}
+	row := models.ImageEmbedding{
+		ImageID:     imageID,
+		Model:       utils.EmbeddingModelID(utils.Embedder),
+		TextVector:  utils.EncodeVector(textVec),
+		ImageVector: utils.EncodeVector(imageVec),
+	}
+	err = database.DB.Clauses(clause.OnConflict{UpdateAll: true}).Create(&row).Error
+	if err != nil {
+		return err
+	}
+	indexVector(imageID, combinedVector(&row), row.UpdatedAt)
+	return nil
+}
+
+// indexVector 把向量写入索引并推进 Watermark；索引为空且维度未定时以第一个向量的维度为准
+func indexVector(imageID uint, vec []float32, updatedAt time.Time) {
+	indexMu.Lock()
+	defer indexMu.Unlock()
+	idx := vectorIndex.Load()
+	if idx == nil {
+		return
+	}
+	if vec == nil {
+		idx.Remove(imageID)
+	} else {
+		if idx.Len() == 0 && idx.Dim != len(vec) {
+			idx = utils.NewHNSW(idx.Model, len(vec), indexConfig.M, indexConfig.EfConstruction)
+			vectorIndex.Store(idx)
+		}
+		if err := idx.Add(imageID, vec); err != nil {
+			log.Printf("图片 %d 写入向量索引失败: %v", imageID, err)
+			return
+		}
+	}
+	idx.Advance(updatedAt)
+	indexDirty.Store(true)
+}
+
+// RemoveEmbedding 删除图片的向量记录并从索引中移除
+func RemoveEmbedding(tx *gorm.DB, imageID uint) error {
+	if err := tx.Where("image_id = ?", imageID).Delete(&models.ImageEmbedding{}).Error; err != nil {
+		return err
+	}
+	indexMu.Lock()
+	defer indexMu.Unlock()
+	if idx := vectorIndex.Load(); idx != nil {
+		idx.Remove(imageID)
+		indexDirty.Store(true)
+	}
+	return nil
+}
+
+// SearchEmbeddings 返回 allowed 中与文本最相似的至多 k 张图片，allowed 为调用方按用户和过滤条件选出的图片。
+// 图片较少时直接逐一计算；否则遍历索引时只收集 allowed 中的图片，结果不足 k 个时再逐一计算，
+// 其他用户的图片不会挤占结果
+func SearchEmbeddings(ctx context.Context, text string, allowed []uint, k int) ([]utils.SearchResult, error) {
+	idx := vectorIndex.Load()
+	if utils.Embedder == nil || idx == nil {
+		return nil, ErrSemanticUnavailable
+	}
+	if len(allowed) == 0 || k <= 0 {
+		return nil, nil
+	}
+	vec, err := utils.Embedder.EmbedText(ctx, text)
+	if err != nil {
+		return nil, err
+	}
+	vec = utils.Normalize(vec)
+	if len(allowed) <= indexConfig.ExactScanMax {
+		return idx.ScoreIDs(vec, allowed, k), nil
+	}
+
+	set := make(map[uint]bool, len(allowed))
+	for _, id := range allowed {
+		set[id] = true
+	}
+	ef := max(indexConfig.EfSearch, indexConfig.Candidates, k)
+	results := idx.SearchFiltered(vec, k, ef, func(id uint) bool { return set[id] })
+	if len(results) < k {
+		results = idx.ScoreIDs(vec, allowed, k)
+	}
+	return results, nil
+}
+
+// ReindexEmbeddings 用当前向量模型为所有图片重新生成向量并重建索引，同一内容的图片向量只计算一次
+func ReindexEmbeddings(ctx context.Context) error {
+	limits := utils.UploadLimitsFromEnv()
+	imageInput := true
+	imageVecs := map[string][]float32{}
+	var updated, failed int
+
+	var batch []models.Image
+	err := database.DB.Order("id").FindInBatches(&batch, 100, func(_ *gorm.DB, _ int) error {
+		for i := range batch {
+			img := &batch[i]
+			imageVec, ok := imageVecs[img.ContentHash]
+			if imageInput && (!ok || img.ContentHash == "") {
+				vec, err := embedImageContent(ctx, img, limits)
+				if errors.Is(err, utils.ErrImageEmbeddingUnsupported) {
+					imageInput = false
+				} else if err != nil {
+					log.Printf("图片 %d 生成图片向量失败: %v", img.ID, err)
+				}
+				imageVec = vec
+				if img.ContentHash != "" && err == nil {
+					imageVecs[img.ContentHash] = vec
+				}
+			}
+			if err := saveEmbedding(ctx, img.ID, imageVec); err != nil {
+				log.Printf("图片 %d 生成向量失败: %v", img.ID, err)
+				failed++
+				continue
+			}
+			updated++
+		}
+		return nil
+	}).Error
+	log.Printf("向量重建完成：成功 %d 张，失败 %d 张", updated, failed)
+	if err != nil {
+		return err
+	}
+
+	idx, err := buildVectorIndex()
+	if err != nil {
+		return err
+	}
+	indexMu.Lock()
+	vectorIndex.Store(idx)
+	indexMu.Unlock()
+	return SaveVectorIndex(ctx)
+}
+
+// embedImageContent 读取原图生成与分析任务相同的预览图，再生成图片向量
+func embedImageContent(ctx context.Context, img *models.Image, limits utils.UploadLimits) ([]float32, error) {
+	rc, err := utils.Store.Get(ctx, utils.Store.KeyFromURL(img.Url))
+	if err != nil {
+		return nil, err
+	}
+	spool, err := utils.SpoolUpload(rc, limits)
+	rc.Close()
+	if err != nil {
+		return nil, err
+	}
+	defer spool.Close()
+	preview, err := utils.MakePreview(spool.NewReader(), spool.Size(), analysisConfig.PreviewWidth, img.Orientation, limits)
+	if err != nil {
+		return nil, err
+	}
+	return utils.Embedder.EmbedImage(ctx, preview)
+}
@@ -0,0 +1,141 @@
+package workers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"smart-gallery-backend/database"
+	"smart-gallery-backend/models"
+	"smart-gallery-backend/utils"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// EmbeddingWorkerConfig 文本向量刷新 worker 池配置
+type EmbeddingWorkerConfig struct {
+	Workers      int           // 并发 worker 数
+	MaxAttempts  int           // 最大尝试次数，超过后进入死信状态
+	RetryDelay   time.Duration // 失败后的等待时间，按尝试次数线性增长
+	PollInterval time.Duration // 队列为空时的轮询间隔
+	LockTimeout  time.Duration // 领取后超过该时间未完成视为 worker 崩溃，任务可被重新领取
+}
+
+// EmbeddingWorkerConfigFromEnv 从环境变量读取文本向量刷新 worker 配置
+func EmbeddingWorkerConfigFromEnv() EmbeddingWorkerConfig {
+	return EmbeddingWorkerConfig{
+		Workers:      utils.GetEnvInt("EMBEDDING_WORKERS", 1),
+		MaxAttempts:  utils.GetEnvInt("EMBEDDING_MAX_ATTEMPTS", 5),
+		RetryDelay:   utils.GetEnvDuration("EMBEDDING_RETRY_DELAY", time.Minute),
+		PollInterval: utils.GetEnvDuration("EMBEDDING_POLL_INTERVAL", 2*time.Second),
+		LockTimeout:  utils.GetEnvDuration("EMBEDDING_LOCK_TIMEOUT", 5*time.Minute),
+	}
+}
+
+var embeddingWorkerConfig = EmbeddingWorkerConfigFromEnv()
+
+// EnqueueEmbeddingRefresh 在给定事务中为图片创建文本向量刷新任务；已有尚未执行的任务时不重复创建，
+// 任务执行时读取最新的标签和描述，连续修改只刷新一次
+func EnqueueEmbeddingRefresh(tx *gorm.DB, imageID uint) error {
+	var pending int64
+	if err := tx.Model(&models.EmbeddingJob{}).
+		Where("image_id = ? AND status = ? AND attempts = 0", imageID, models.JobPending).
+		Count(&pending).Error; err != nil {
+		return err
+	}
+	if pending > 0 {
+		return nil
+	}
+	job := models.EmbeddingJob{
+		ImageID:   imageID,
+		Status:    models.JobPending,
+		NextRunAt: time.Now(),
+	}
+	return tx.Create(&job).Error
+}
+
+// StartEmbeddingWorkers 启动后台文本向量刷新 worker 池
+func StartEmbeddingWorkers() {
+	for i := 0; i < embeddingWorkerConfig.Workers; i++ {
+		go runEmbeddingWorker(i)
+	}
+	log.Printf("已启动 %d 个向量刷新 worker", embeddingWorkerConfig.Workers)
+}
+
+func runEmbeddingWorker(id int) {
+	for {
+		job, err := claimEmbeddingJob()
+		if err != nil {
+			log.Printf("向量刷新 worker %d 领取任务失败: %v", id, err)
+			time.Sleep(embeddingWorkerConfig.PollInterval)
+			continue
+		}
+		if job == nil {
+			time.Sleep(embeddingWorkerConfig.PollInterval)
+			continue
+		}
+		finishEmbeddingJob(job, processEmbeddingJob(context.Background(), job))
+	}
+}
+
+// claimEmbeddingJob 领取一个到期任务；使用 SKIP LOCKED 避免多个 worker 抢同一行
+func claimEmbeddingJob() (*models.EmbeddingJob, error) {
+	var job models.EmbeddingJob
+	now := time.Now()
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("(status = ? AND next_run_at <= ?) OR (status = ? AND locked_at < ?)",
+				models.JobPending, now, models.JobRunning, now.Add(-embeddingWorkerConfig.LockTimeout)).
+			Order("next_run_at").
+			First(&job).Error
+		if err != nil {
+			return err
+		}
+		job.Status = models.JobRunning
+		job.LockedAt = &now
+		job.Attempts++
+		return tx.Save(&job).Error
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// processEmbeddingJob 重新生成文本向量；图片已删除时视为完成
+func processEmbeddingJob(ctx context.Context, job *models.EmbeddingJob) error {
+	err := RefreshEmbeddingText(ctx, job.ImageID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	return err
+}
+
+// finishEmbeddingJob 根据执行结果更新任务：完成、延后重试或进入死信状态
+func finishEmbeddingJob(job *models.EmbeddingJob, jobErr error) {
+	if jobErr == nil {
+		database.DB.Model(job).Updates(map[string]interface{}{
+			"status":     models.JobDone,
+			"last_error": "",
+			"locked_at":  nil,
+		})
+		return
+	}
+
+	log.Printf("向量刷新任务 %d（图片 %d）第 %d 次失败: %v", job.ID, job.ImageID, job.Attempts, jobErr)
+
+	status := models.JobPending
+	if job.Attempts >= embeddingWorkerConfig.MaxAttempts {
+		status = models.JobDead
+	}
+	database.DB.Model(job).Updates(map[string]interface{}{
+		"status":      status,
+		"last_error":  jobErr.Error(),
+		"locked_at":   nil,
+		"next_run_at": time.Now().Add(time.Duration(job.Attempts) * embeddingWorkerConfig.RetryDelay),
+	})
+}
@@ -0,0 +1,56 @@
+package workers
+
+import (
+	"context"
+	"image"
+	"log"
+	"smart-gallery-backend/database"
+	"smart-gallery-backend/models"
+	"smart-gallery-backend/utils"
+
+	"gorm.io/gorm"
+)
+
+// BackfillPalette 为尚未提取主色调的图片从缩略图提取主色调，同一内容只计算一次
+func BackfillPalette(ctx context.Context) error {
+	limits := utils.UploadLimitsFromEnv()
+	palettes := map[string][]models.ImageColor{}
+	var updated, failed int
+
+	var batch []models.Image
+	err := database.DB.Where("palette IS NULL OR palette = ''").Order("id").FindInBatches(&batch, 100, func(_ *gorm.DB, _ int) error {
+		for i := range batch {
+			img := &batch[i]
+			rows, ok := palettes[img.ContentHash]
+			if !ok || img.ContentHash == "" {
+				// 缩略图已摆正方向；没有缩略图时读取原图
+				var decoded image.Image
+				var err error
+				if img.ThumbnailUrl != "" && img.ThumbnailUrl != img.Url {
+					decoded, err = decodeObject(ctx, img.ThumbnailUrl, 1, limits)
+				} else {
+					decoded, err = DecodeOriginal(ctx, img, limits)
+				}
+				if err != nil {
+					log.Printf("图片 %d 主色调提取失败: %v", img.ID, err)
+					failed++
+					continue
+				}
+				rows = database.ImageColorsFromPalette(utils.ExtractPalette(decoded, utils.PaletteSize))
+				if img.ContentHash != "" {
+					palettes[img.ContentHash] = rows
+				}
+			}
+			if err := database.ReplaceImageColors(database.DB, img.ID, rows); err != nil {
+				log.Printf("图片 %d 主色调保存失败: %v", img.ID, err)
+				failed++
+				continue
+			}
+			updated++
+		}
+		return nil
+	}).Error
+
+	log.Printf("主色调回填完成：成功 %d 张，失败 %d 张", updated, failed)
+	return err
+}
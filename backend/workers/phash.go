@@ -0,0 +1,48 @@
+package workers
+
+import (
+	"context"
+	"log"
+	"smart-gallery-backend/database"
+	"smart-gallery-backend/models"
+	"smart-gallery-backend/utils"
+
+	"gorm.io/gorm"
+)
+
+// BackfillPHash 为尚未计算感知哈希的图片补算哈希，同一内容只解码一次
+func BackfillPHash(ctx context.Context) error {
+	limits := utils.UploadLimitsFromEnv()
+	hashes := map[string]uint64{}
+	var updated, failed int
+
+	var batch []models.Image
+	err := database.DB.Where("phash IS NULL").Order("id").FindInBatches(&batch, 100, func(_ *gorm.DB, _ int) error {
+		for i := range batch {
+			img := &batch[i]
+			phash, ok := hashes[img.ContentHash]
+			if !ok || img.ContentHash == "" {
+				decoded, err := DecodeOriginal(ctx, img, limits)
+				if err != nil {
+					log.Printf("图片 %d 感知哈希计算失败: %v", img.ID, err)
+					failed++
+					continue
+				}
+				phash = utils.DHash(decoded)
+				if img.ContentHash != "" {
+					hashes[img.ContentHash] = phash
+				}
+			}
+			if err := database.DB.Model(img).UpdateColumn("phash", phash).Error; err != nil {
+				log.Printf("图片 %d 感知哈希保存失败: %v", img.ID, err)
+				failed++
+				continue
+			}
+			updated++
+		}
+		return nil
+	}).Error
+
+	log.Printf("感知哈希回填完成：成功 %d 张，失败 %d 张", updated, failed)
+	return err
+}
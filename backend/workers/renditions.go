@@ -0,0 +1,373 @@
+package workers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"log"
+	"smart-gallery-backend/database"
+	"smart-gallery-backend/models"
+	"smart-gallery-backend/utils"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// RenditionWorkerConfig 派生图 worker 池配置
+type RenditionWorkerConfig struct {
+	Workers      int           // 并发 worker 数
+	MaxAttempts  int           // 最大尝试次数，超过后进入死信状态
+	RetryDelay   time.Duration // 失败后的等待时间，按尝试次数线性增长
+	PollInterval time.Duration // 队列为空时的轮询间隔
+	LockTimeout  time.Duration // 领取后超过该时间未完成视为 worker 崩溃，任务可被重新领取
+}
+
+// RenditionWorkerConfigFromEnv 从环境变量读取派生图 worker 配置
+func RenditionWorkerConfigFromEnv() RenditionWorkerConfig {
+	return RenditionWorkerConfig{
+		Workers:      utils.GetEnvInt("RENDITION_WORKERS", 1),
+		MaxAttempts:  utils.GetEnvInt("RENDITION_MAX_ATTEMPTS", 3),
+		RetryDelay:   utils.GetEnvDuration("RENDITION_RETRY_DELAY", 30*time.Second),
+		PollInterval: utils.GetEnvDuration("RENDITION_POLL_INTERVAL", 2*time.Second),
+		LockTimeout:  utils.GetEnvDuration("RENDITION_LOCK_TIMEOUT", 5*time.Minute),
+	}
+}
+
+var (
+	renditionConfig       = utils.RenditionConfigFromEnv()
+	renditionWorkerConfig = RenditionWorkerConfigFromEnv()
+	renditionLimits       = utils.UploadLimitsFromEnv()
+
+	renditionEncodersOnce sync.Once
+	renditionEncoders     []utils.ImageEncoder
+	renditionEncodersErr  error
+)
+
+func encoders() []utils.ImageEncoder {
+	renditionEncodersOnce.Do(func() {
+		renditionEncoders, renditionEncodersErr = renditionConfig.Encoders()
+	})
+	return renditionEncoders
+}
+
+// checkEncoders 启动时检查编码命令：缺少 cwebp / avifenc 等命令时该格式不会生成，
+// RENDITION_REQUIRE_ENCODERS=true 时拒绝启动，否则记录警告
+func checkEncoders() {
+	encs := encoders()
+	if renditionEncodersErr != nil {
+		if renditionConfig.RequireEncoders {
+			log.Fatalln("派生图编码器检查失败:", renditionEncodersErr)
+		}
+		log.Printf("警告: %v；这些格式的派生图不会生成，请安装对应命令或从 RENDITION_FORMATS 中移除", renditionEncodersErr)
+	}
+	formats := make([]string, len(encs))
+	for i, e := range encs {
+		formats[i] = e.Format()
+	}
+	log.Printf("派生图格式: %s", strings.Join(formats, ","))
+}
+
+// renditionKeyPrefix 派生图的存放位置：与原图同一内容目录，旧数据按图片 ID 存放；
+// 编辑过的图片放在对应编辑版本的目录下
+func renditionKeyPrefix(img *models.Image) string {
+	if img.EditVersion > 0 {
+		return EditKeyPrefix(img.ID, img.EditVersion) + "r/"
+	}
+	if img.ContentHash != "" {
+		return utils.BlobPrefix(img.ContentHash) + "r/"
+	}
+	return fmt.Sprintf("renditions/%d/", img.ID)
+}
+
+// StoreRenditions 由已摆正方向的图片生成各尺寸派生图并上传，返回尚未保存的记录
+func StoreRenditions(ctx context.Context, decoded image.Image, img *models.Image) ([]models.ImageRendition, error) {
+	prefix := renditionKeyPrefix(img)
+	var out []models.ImageRendition
+	for _, r := range utils.MakeRenditions(decoded, renditionConfig, encoders()) {
+		key := prefix + r.Name + "." + r.Ext
+		url, err := utils.Store.Put(ctx, key, bytes.NewReader(r.Data), int64(len(r.Data)), r.ContentType)
+		if err != nil {
+			return out, err
+		}
+		out = append(out, models.ImageRendition{
+			Name:   r.Name,
+			Format: r.Format,
+			Width:  r.Width,
+			Height: r.Height,
+			Size:   int64(len(r.Data)),
+			Key:    key,
+			Url:    url,
+		})
+	}
+	return out, nil
+}
+
+// EnqueueRenditions 在给定事务中为图片的 editVersion 版本创建派生图任务
+func EnqueueRenditions(tx *gorm.DB, imageID uint, editVersion int) error {
+	job := models.RenditionJob{
+		ImageID:     imageID,
+		EditVersion: editVersion,
+		Status:      models.JobPending,
+		NextRunAt:   time.Now(),
+	}
+	return tx.Create(&job).Error
+}
+
+// StartRenditionWorkers 启动后台派生图 worker 池
+func StartRenditionWorkers() {
+	checkEncoders()
+	for i := 0; i < renditionWorkerConfig.Workers; i++ {
+		go runRenditionWorker(i)
+	}
+	log.Printf("已启动 %d 个派生图 worker", renditionWorkerConfig.Workers)
+}
+
+func runRenditionWorker(id int) {
+	for {
+		job, err := claimRenditionJob()
+		if err != nil {
+			log.Printf("派生图 worker %d 领取任务失败: %v", id, err)
+			time.Sleep(renditionWorkerConfig.PollInterval)
+			continue
+		}
+		if job == nil {
+			time.Sleep(renditionWorkerConfig.PollInterval)
+			continue
+		}
+		finishRenditionJob(job, processRenditionJob(context.Background(), job))
+	}
+}
+
+// claimRenditionJob 领取一个到期任务；使用 SKIP LOCKED 避免多个 worker 抢同一行
+func claimRenditionJob() (*models.RenditionJob, error) {
+	var job models.RenditionJob
+	now := time.Now()
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("(status = ? AND next_run_at <= ?) OR (status = ? AND locked_at < ?)",
+				models.JobPending, now, models.JobRunning, now.Add(-renditionWorkerConfig.LockTimeout)).
+			Order("next_run_at").
+			First(&job).Error
+		if err != nil {
+			return err
+		}
+		job.Status = models.JobRunning
+		job.LockedAt = &now
+		job.Attempts++
+		return tx.Save(&job).Error
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// processRenditionJob 为图片当前版本生成派生图并保存记录。未编辑的图片写入内容目录，
+// 同时更新共享该内容的其他未编辑图片。保存时锁定 Blob 行（编辑版本锁定图片行），
+// 内容已随最后一个引用删除或图片已删除时清理本次上传的对象。
+func processRenditionJob(ctx context.Context, job *models.RenditionJob) error {
+	var img models.Image
+	if err := database.DB.First(&img, job.ImageID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+	if img.EditVersion != job.EditVersion {
+		return nil
+	}
+
+	decoded, err := DecodeCurrent(ctx, &img, renditionLimits)
+	if err != nil {
+		return err
+	}
+	// 上传失败时已写入的对象留在内容或编辑目录中，随最后一个引用或图片一起删除
+	rows, err := StoreRenditions(ctx, decoded, &img)
+	if err != nil {
+		return err
+	}
+
+	var targets []uint
+	orphaned := false
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if img.EditVersion == 0 && img.ContentHash != "" {
+			var blob models.Blob
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("hash = ?", img.ContentHash).Limit(1).Find(&blob).Error; err != nil {
+				return err
+			}
+			if blob.RefCount == 0 {
+				orphaned = true
+				return nil
+			}
+			if err := tx.Model(&models.Image{}).Where("content_hash = ? AND edit_version = 0", img.ContentHash).Pluck("id", &targets).Error; err != nil {
+				return err
+			}
+		} else {
+			// 图片已切换到其他版本时不保存记录，对象保留给之后切回该版本的任务覆盖
+			var current models.Image
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id", "edit_version").
+				Where("id = ?", img.ID).Limit(1).Find(&current).Error; err != nil {
+				return err
+			}
+			if current.ID == 0 {
+				orphaned = true
+			} else if current.EditVersion == job.EditVersion {
+				targets = []uint{current.ID}
+			}
+		}
+		for _, id := range targets {
+			if err := database.ReplaceImageRenditions(tx, id, rows); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if orphaned {
+		for _, r := range rows {
+			utils.Store.Delete(ctx, r.Key)
+		}
+	}
+	return nil
+}
+
+// finishRenditionJob 根据执行结果更新任务：完成、延后重试或进入死信状态
+func finishRenditionJob(job *models.RenditionJob, jobErr error) {
+	if jobErr == nil {
+		database.DB.Model(job).Updates(map[string]interface{}{
+			"status":     models.JobDone,
+			"last_error": "",
+			"locked_at":  nil,
+		})
+		return
+	}
+
+	log.Printf("派生图任务 %d（图片 %d）第 %d 次失败: %v", job.ID, job.ImageID, job.Attempts, jobErr)
+
+	status := models.JobPending
+	if job.Attempts >= renditionWorkerConfig.MaxAttempts {
+		status = models.JobDead
+	}
+	database.DB.Model(job).Updates(map[string]interface{}{
+		"status":      status,
+		"last_error":  jobErr.Error(),
+		"locked_at":   nil,
+		"next_run_at": time.Now().Add(time.Duration(job.Attempts) * renditionWorkerConfig.RetryDelay),
+	})
+}
+
+// RegenerateRenditions 按当前配置为所有图片重新生成派生图，
+// 同一内容只生成一次，不再使用的旧派生图对象会被删除
+func RegenerateRenditions(ctx context.Context) error {
+	limits := utils.UploadLimitsFromEnv()
+	done := map[string][]models.ImageRendition{}
+	var updated, failed int
+
+	var batch []models.Image
+	err := database.DB.Order("id").FindInBatches(&batch, 100, func(_ *gorm.DB, _ int) error {
+		for i := range batch {
+			img := &batch[i]
+			key := img.ContentHash
+			if key == "" || img.EditVersion > 0 {
+				key = fmt.Sprintf("image:%d:%d", img.ID, img.EditVersion)
+			}
+			rows, ok := done[key]
+			if !ok {
+				var err error
+				if rows, err = regenerateImageRenditions(ctx, img, limits); err != nil {
+					log.Printf("图片 %d 派生图生成失败: %v", img.ID, err)
+					failed++
+					continue
+				}
+				done[key] = rows
+			}
+			if err := database.ReplaceImageRenditions(database.DB, img.ID, rows); err != nil {
+				log.Printf("图片 %d 派生图保存失败: %v", img.ID, err)
+				failed++
+				continue
+			}
+			updated++
+		}
+		return nil
+	}).Error
+
+	log.Printf("派生图重新生成完成：成功 %d 张，失败 %d 张", updated, failed)
+	return err
+}
+
+func regenerateImageRenditions(ctx context.Context, img *models.Image, limits utils.UploadLimits) ([]models.ImageRendition, error) {
+	decoded, err := DecodeCurrent(ctx, img, limits)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := StoreRenditions(ctx, decoded, img)
+	if err != nil {
+		return nil, err
+	}
+
+	var old []models.ImageRendition
+	database.DB.Where("image_id = ?", img.ID).Find(&old)
+	keep := make(map[string]bool, len(rows))
+	for _, r := range rows {
+		keep[r.Key] = true
+	}
+	for _, r := range old {
+		if !keep[r.Key] {
+			utils.Store.Delete(ctx, r.Key)
+		}
+	}
+	return rows, nil
+}
+
+// EditsKeyPrefix 图片所有编辑版本所在的对象目录
+func EditsKeyPrefix(imageID uint) string {
+	return fmt.Sprintf("edits/%d/", imageID)
+}
+
+// EditKeyPrefix 编辑版本的对象目录，渲染结果、缩略图和派生图都放在这里
+func EditKeyPrefix(imageID uint, version int) string {
+	return EditsKeyPrefix(imageID) + fmt.Sprintf("v%d/", version)
+}
+
+// DecodeCurrent 解码图片当前显示的版本：编辑过的图片读取编辑结果，否则读取原图
+func DecodeCurrent(ctx context.Context, img *models.Image, limits utils.UploadLimits) (image.Image, error) {
+	if img.EditVersion > 0 && img.EditedUrl != "" {
+		// 编辑结果已经摆正方向
+		return decodeObject(ctx, img.EditedUrl, 1, limits)
+	}
+	return DecodeOriginal(ctx, img, limits)
+}
+
+// DecodeOriginal 从存储读取原图并解码，按 EXIF 方向摆正
+func DecodeOriginal(ctx context.Context, img *models.Image, limits utils.UploadLimits) (image.Image, error) {
+	return decodeObject(ctx, img.Url, img.Orientation, limits)
+}
+
+func decodeObject(ctx context.Context, url string, orientation int, limits utils.UploadLimits) (image.Image, error) {
+	rc, err := utils.Store.Get(ctx, utils.Store.KeyFromURL(url))
+	if err != nil {
+		return nil, fmt.Errorf("读取原图失败: %w", err)
+	}
+	spool, err := utils.SpoolUpload(rc, limits)
+	rc.Close()
+	if err != nil {
+		return nil, fmt.Errorf("读取原图失败: %w", err)
+	}
+	defer spool.Close()
+
+	decoded, err := utils.DecodeImage(spool.NewReader(), limits.MaxPixels)
+	if err != nil {
+		return nil, err
+	}
+	return utils.ApplyOrientation(decoded, orientation), nil
+}
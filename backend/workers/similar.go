@@ -0,0 +1,194 @@
+package workers
+
+import (
+	"log"
+	"smart-gallery-backend/database"
+	"smart-gallery-backend/models"
+	"smart-gallery-backend/utils"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// SimilarMaxDistance 预先计算相似图片对时的最大汉明距离，查询相似图片时的阈值不能超过它
+const SimilarMaxDistance = 16
+
+var (
+	similarPollInterval = utils.GetEnvDuration("SIMILAR_POLL_INTERVAL", 10*time.Second)
+	similarCacheTTL     = utils.GetEnvDuration("SIMILAR_CACHE_TTL", 30*time.Minute)
+)
+
+// similarTree 某个用户已处理图片的 BK 树，分批导入时每批只加入新图片，不必重新读取全部哈希
+type similarTree struct {
+	tree     utils.BKTree
+	lastUsed time.Time
+}
+
+// similarTrees 按用户缓存的 BK 树，只由相似图片 worker 的 goroutine 访问；进程重启后按需重建
+var similarTrees = map[uint]*similarTree{}
+
+// StartSimilarityWorker 启动后台 worker，为新计算出感知哈希的图片查找同一用户的相似图片并保存图片对
+func StartSimilarityWorker() {
+	go func() {
+		for {
+			n, err := indexSimilarImages()
+			if err != nil {
+				log.Println("相似图片计算失败:", err)
+			}
+			if err != nil || n == 0 {
+				evictSimilarTrees()
+				time.Sleep(similarPollInterval)
+			}
+		}
+	}()
+	log.Println("已启动相似图片 worker")
+}
+
+type hashRow struct {
+	ID    uint
+	PHash uint64 `gorm:"column:phash"`
+}
+
+// indexSimilarImages 取一个有未处理图片的用户，把这些图片加入该用户缓存的 BK 树，
+// 查找距离不超过 SimilarMaxDistance 的图片；返回处理的图片数
+func indexSimilarImages() (int, error) {
+	var users []uint
+	err := database.DB.Model(&models.Image{}).
+		Where("phash IS NOT NULL AND similar_indexed = ?", false).
+		Limit(1).Pluck("user_id", &users).Error
+	if err != nil || len(users) == 0 {
+		return 0, err
+	}
+	userID := users[0]
+
+	st, err := userSimilarTree(userID)
+	if err != nil {
+		return 0, err
+	}
+	var pending []hashRow
+	err = database.DB.Model(&models.Image{}).Select("id, phash").
+		Where("user_id = ? AND phash IS NOT NULL AND similar_indexed = ?", userID, false).
+		Order("id").Scan(&pending).Error
+	if err != nil {
+		return 0, err
+	}
+	// 先全部加入，同一批的图片之间也能配对
+	for _, r := range pending {
+		st.tree.Add(r.ID, r.PHash)
+	}
+
+	ids := make([]uint, len(pending))
+	var pairs []models.SimilarPair
+	others := map[uint]bool{}
+	for i, r := range pending {
+		ids[i] = r.ID
+		st.tree.Search(r.PHash, SimilarMaxDistance, func(id uint, dist int) {
+			if id == r.ID {
+				return
+			}
+			others[id] = true
+			pairs = append(pairs, models.SimilarPair{
+				ImageID:  min(id, r.ID),
+				OtherID:  max(id, r.ID),
+				UserID:   userID,
+				Distance: dist,
+			})
+		})
+	}
+
+	// 缓存的树中可能有已删除的图片：从树中移除，并丢弃与它们组成的图片对
+	dead, err := deletedImages(others)
+	if err != nil {
+		return 0, err
+	}
+	for id := range dead {
+		st.tree.Remove(id)
+	}
+	live := pairs[:0]
+	for _, p := range pairs {
+		if !dead[p.ImageID] && !dead[p.OtherID] {
+			live = append(live, p)
+		}
+	}
+	pairs = live
+
+	// 两张都未处理的图片会各生成一次同一对，插入时忽略重复
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if len(pairs) > 0 {
+			if err := tx.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(pairs, 500).Error; err != nil {
+				return err
+			}
+		}
+		for start := 0; start < len(ids); start += 1000 {
+			chunk := ids[start:min(start+1000, len(ids))]
+			if err := tx.Model(&models.Image{}).Where("id IN ?", chunk).UpdateColumn("similar_indexed", true).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		// 树中已加入的图片仍未标记为已处理，丢弃缓存，下次重新读取
+		delete(similarTrees, userID)
+		return 0, err
+	}
+	return len(ids), nil
+}
+
+// userSimilarTree 返回用户缓存的 BK 树，没有时用该用户已处理的全部哈希建立
+func userSimilarTree(userID uint) (*similarTree, error) {
+	if st, ok := similarTrees[userID]; ok {
+		st.lastUsed = time.Now()
+		return st, nil
+	}
+	var rows []hashRow
+	err := database.DB.Model(&models.Image{}).Select("id, phash").
+		Where("user_id = ? AND phash IS NOT NULL AND similar_indexed = ?", userID, true).Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	st := &similarTree{lastUsed: time.Now()}
+	for _, r := range rows {
+		st.tree.Add(r.ID, r.PHash)
+	}
+	similarTrees[userID] = st
+	return st, nil
+}
+
+// deletedImages 返回 ids 中已不存在的图片
+func deletedImages(ids map[uint]bool) (map[uint]bool, error) {
+	list := make([]uint, 0, len(ids))
+	for id := range ids {
+		list = append(list, id)
+	}
+	dead := make(map[uint]bool, len(ids))
+	for id := range ids {
+		dead[id] = true
+	}
+	for start := 0; start < len(list); start += 1000 {
+		var found []uint
+		chunk := list[start:min(start+1000, len(list))]
+		if err := database.DB.Model(&models.Image{}).Where("id IN ?", chunk).Pluck("id", &found).Error; err != nil {
+			return nil, err
+		}
+		for _, id := range found {
+			delete(dead, id)
+		}
+	}
+	return dead, nil
+}
+
+// evictSimilarTrees 丢弃超过 SIMILAR_CACHE_TTL 未使用的 BK 树
+func evictSimilarTrees() {
+	for userID, st := range similarTrees {
+		if time.Since(st.lastUsed) > similarCacheTTL {
+			delete(similarTrees, userID)
+		}
+	}
+}
+
+// RemoveSimilarPairs 删除包含该图片的相似图片对
+func RemoveSimilarPairs(tx *gorm.DB, imageID uint) error {
+	return tx.Where("image_id = ? OR other_id = ?", imageID, imageID).Delete(&models.SimilarPair{}).Error
+}
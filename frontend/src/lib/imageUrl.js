@@ -13,6 +13,7 @@ export const getMinioBaseUrl = () => {
  * 将图片路径转换为完整的可访问 URL
  * 支持以下格式：
  * - 相对路径: /minio/images/xxx.jpg -> http://{hostname}:9000/images/xxx.jpg
+ * - 本地存储: /files/xxx.jpg -> http://{hostname}:8080/files/xxx.jpg
  * - 旧格式 localhost: http://localhost:9000/images/xxx.jpg -> http://{hostname}:9000/images/xxx.jpg
  * - 旧格式 IP: http://10.x.x.x:9000/images/xxx.jpg -> http://{hostname}:9000/images/xxx.jpg
  * - 已是正确格式: 直接返回
@@ -30,7 +31,12 @@ export const getImageUrl = (url) => {
     return minioBase + path;
   }
   
-  // 2. 旧的完整 URL 格式，替换 host 部分
+  // 2. 本地存储后端由后端直接提供: /files/xxx.jpg
+  if (url.startsWith('/files/')) {
+    return `http://${hostname}:8080${url}`;
+  }
+  
+  // 3. 旧的完整 URL 格式，替换 host 部分
   // 匹配 http://xxx:9000/images/... 格式
   const urlPattern = /^https?:\/\/[^\/]+(:9000)?\/images\//;
   if (urlPattern.test(url)) {
@@ -41,7 +47,7 @@ export const getImageUrl = (url) => {
     }
   }
   
-  // 3. 其他格式，直接返回
+  // 4. 其他格式，直接返回
   return url;
 };
 
@@ -10,6 +10,9 @@ import {
   CheckSquare, Square, Play, Pause, Maximize, Grid
 } from 'lucide-react';
 
+// 每次加载的图片数
+const PAGE_SIZE = 50;
+
 export default function HomePage() {
   const navigate = useNavigate();
 
@@ -65,19 +68,71 @@ export default function HomePage() {
   }, []);
 
   // --- API 请求 ---
+  // 按游标分页：首屏只取一页，滚动到底部时再加载下一页
+  const [nextCursor, setNextCursor] = useState('');
+  const [isLoadingMore, setIsLoadingMore] = useState(false);
+  const pageRef = useRef({ query: '', cursor: '', loading: false, seq: 0 });
+  const sentinelRef = useRef(null);
+
   const fetchImages = useCallback(async (query = searchQuery) => {
+    const seq = ++pageRef.current.seq;
+    pageRef.current = { query, cursor: '', loading: true, seq };
     try {
       setIsLoadingImages(true);
-      const res = await api.get('/images', { params: { q: query } });
+      const res = await api.get('/images', { params: { q: query, limit: PAGE_SIZE } });
+      if (seq !== pageRef.current.seq) return;
       setImages(res.data.data || []);
+      pageRef.current.cursor = res.data.next_cursor || '';
+      setNextCursor(pageRef.current.cursor);
+    } catch (err) {
+      console.error(err);
+      if (err.response?.status === 401) handleLogout();
+    } finally {
+      if (seq === pageRef.current.seq) {
+        pageRef.current.loading = false;
+        setIsLoadingImages(false);
+      }
+    }
+  }, []);
+
+  const loadMoreImages = useCallback(async () => {
+    const page = pageRef.current;
+    if (page.loading || !page.cursor) return;
+    const seq = page.seq;
+    page.loading = true;
+    setIsLoadingMore(true);
+    try {
+      const res = await api.get('/images', { params: { q: page.query, limit: PAGE_SIZE, cursor: page.cursor } });
+      if (seq !== pageRef.current.seq) return;
+      // 翻页期间删除或上传可能导致重复，按 ID 去重
+      setImages(prev => {
+        const seen = new Set(prev.map(img => img.ID));
+        return [...prev, ...(res.data.data || []).filter(img => !seen.has(img.ID))];
+      });
+      page.cursor = res.data.next_cursor || '';
+      setNextCursor(page.cursor);
     } catch (err) {
       console.error(err);
       if (err.response?.status === 401) handleLogout();
     } finally {
-      setIsLoadingImages(false);
+      if (seq === pageRef.current.seq) {
+        page.loading = false;
+        setIsLoadingMore(false);
+      }
     }
   }, []);
 
+  // 底部哨兵进入视口时加载下一页
+  useEffect(() => {
+    const el = sentinelRef.current;
+    if (!el || !nextCursor) return;
+    const observer = new IntersectionObserver((entries) => {
+      if (entries[0].isIntersecting) loadMoreImages();
+    }, { rootMargin: '400px' });
+    observer.observe(el);
+    return () => observer.disconnect();
+  }, [nextCursor, isLoadingImages, loadMoreImages]);
+
   useEffect(() => {
     if (!localStorage.getItem('token')) {
       navigate('/login');
@@ -408,7 +463,7 @@ export default function HomePage() {
               <label className="cursor-pointer w-full h-full flex items-center justify-center gap-3">
                 <div className="bg-indigo-100 p-2 rounded-full text-indigo-600"><Upload className="w-5 h-5" /></div>
                 <span className="text-gray-600 font-medium">点击或拖拽上传新图片</span>
-                <input type="file" className="hidden" onChange={handleFileSelect} accept="image/*" />
+                <input type="file" className="hidden" onChange={handleFileSelect} accept="image/*,.heic,.heif" />
               </label>
             </div>
           ) : (
@@ -474,6 +529,7 @@ export default function HomePage() {
               <div 
                 key={img.ID} 
                 onClick={() => isSelectMode ? toggleImageSelect({stopPropagation: ()=>{}}, img.ID) : openModal(index)} 
+                style={img.palette ? { backgroundColor: img.palette.split(',')[0] } : undefined}
                 className={`group relative aspect-square bg-gray-100 rounded-xl overflow-hidden cursor-${isSelectMode ? 'pointer' : 'zoom-in'} border-2 transition-all ${selectedImages.has(img.ID) ? 'border-indigo-500 ring-2 ring-indigo-300' : 'border-gray-200 hover:shadow-lg'}`}
               >
                 {/* 选择框 */}
@@ -486,7 +542,7 @@ export default function HomePage() {
                   </div>
                 )}
                 
-                <img src={getImageUrl(img.thumbnail_url || img.url)} className="w-full h-full object-cover transition-transform duration-500 group-hover:scale-110" loading="lazy" onError={handleImageError} />
+                <img src={getImageUrl(img.edited_thumbnail_url || img.thumbnail_url || img.url)} alt={img.alt_text || img.file_name} className="w-full h-full object-cover transition-transform duration-500 group-hover:scale-110" loading="lazy" onError={handleImageError} />
                 <div className={`absolute inset-0 bg-gradient-to-t from-black/80 via-transparent to-transparent transition-opacity flex flex-col justify-end p-3 ${isSelectMode ? 'opacity-60' : 'opacity-0 group-hover:opacity-100'}`}>
                   {img.tags && <div className="flex flex-wrap gap-1 mb-1.5">{img.tags.split(',').filter(t=>t).slice(0,3).map((tag,i)=><span key={i} className="text-[10px] bg-white/20 text-white/90 px-1.5 py-0.5 rounded backdrop-blur-md">{tag}</span>)}</div>}
                   <p className="text-white text-sm font-medium truncate">{img.file_name}</p>
@@ -501,6 +557,11 @@ export default function HomePage() {
             ))}
           </div>
         ) : (<div className="py-20 text-center text-gray-400 bg-white rounded-xl border border-dashed border-gray-200">暂无图片</div>)}
+        {!isLoadingImages && nextCursor && (
+          <div ref={sentinelRef} className="py-8 text-center">
+            {isLoadingMore && <Loader2 className="w-6 h-6 animate-spin mx-auto text-indigo-200"/>}
+          </div>
+        )}
       </main>
 
       {/* --- 全屏模态框 --- */}
@@ -539,7 +600,7 @@ export default function HomePage() {
                     <img 
                       ref={originalImageRef}
                       src={getImageUrl(activeImage.url)} 
-                      alt={activeImage.file_name} 
+                      alt={activeImage.alt_text || activeImage.file_name} 
                       className="max-w-full max-h-full object-contain shadow-2xl"
                       crossOrigin="anonymous"
                       style={{
@@ -556,7 +617,7 @@ export default function HomePage() {
                   </div>
                 )
               ) : (
-                <img src={getImageUrl(activeImage.url)} alt={activeImage.file_name} className="max-w-full max-h-full object-contain shadow-2xl" onClick={(e) => e.stopPropagation()} />
+                <img src={getImageUrl(activeImage.url)} alt={activeImage.alt_text || activeImage.file_name} className="max-w-full max-h-full object-contain shadow-2xl" onClick={(e) => e.stopPropagation()} />
               )}
             </div>
           </div>
@@ -576,6 +637,9 @@ export default function HomePage() {
                   </button>
                 )}
               </div>
+              {activeImage.description && (
+                <p className="text-sm text-gray-300 mb-4 break-words">{activeImage.description}</p>
+              )}
 
               {isEditing ? (
                 <div className="animate-in fade-in slide-in-from-right-4">
@@ -760,7 +824,7 @@ export default function HomePage() {
               <img 
                 key={getSlideshowImages()[slideshowIndex].ID}
                 src={getImageUrl(getSlideshowImages()[slideshowIndex].url)} 
-                alt={getSlideshowImages()[slideshowIndex].file_name}
+                alt={getSlideshowImages()[slideshowIndex].alt_text || getSlideshowImages()[slideshowIndex].file_name}
                 className="max-w-full max-h-full object-contain animate-in fade-in zoom-in-95 duration-500"
               />
             )}
@@ -831,7 +895,7 @@ export default function HomePage() {
                     onClick={() => setSlideshowIndex(idx)}
                     className={`flex-shrink-0 w-16 h-16 rounded-lg overflow-hidden border-2 transition-all ${idx === slideshowIndex ? 'border-white scale-110' : 'border-transparent opacity-60 hover:opacity-100'}`}
                   >
-                    <img src={getImageUrl(img.thumbnail_url || img.url)} alt="" className="w-full h-full object-cover" />
+                    <img src={getImageUrl(img.edited_thumbnail_url || img.thumbnail_url || img.url)} alt="" className="w-full h-full object-cover" />
                   </button>
                 ))}
               </div>
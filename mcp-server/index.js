@@ -41,13 +41,13 @@ server.setRequestHandler(ListToolsRequestSchema, async () => {
     tools: [
       {
         name: "search_images",
-        description: "搜索图库中的图片。可以按标签、文件名、相机型号等关键词搜索。返回匹配的图片列表。",
+        description: "搜索图库中的图片。可以按标签、文件名、相机型号、图片描述等关键词搜索。返回匹配的图片列表。",
         inputSchema: {
           type: "object",
           properties: {
             query: {
               type: "string",
-              description: "搜索关键词，可以是标签（如：风景、人像、日落）、文件名、相机型号等",
+              description: "搜索关键词，可以是标签（如：风景、人像、日落）、文件名、相机型号、描述中的词语等",
             },
           },
           required: ["query"],
@@ -68,7 +68,7 @@ server.setRequestHandler(ListToolsRequestSchema, async () => {
       },
       {
         name: "get_image_details",
-        description: "获取指定图片的详细信息，包括 EXIF 数据（相机型号、拍摄时间、分辨率、光圈、ISO 等）。",
+        description: "获取指定图片的详细信息，包括描述、替代文本和 EXIF 数据（相机型号、拍摄时间、分辨率、光圈、ISO 等）。",
         inputSchema: {
           type: "object",
           properties: {
@@ -132,6 +132,8 @@ server.setRequestHandler(CallToolRequestSchema, async (request) => {
           id: img.ID,
           file_name: img.file_name,
           tags: img.tags,
+          description: img.description,
+          alt_text: img.alt_text,
           camera: img.camera_model,
           shooting_time: img.shooting_time,
           url: img.url,
@@ -149,8 +151,8 @@ server.setRequestHandler(CallToolRequestSchema, async (request) => {
 
       case "list_all_images": {
         const limit = args?.limit || 20;
-        const response = await api.get("/images", { params: { q: "" } });
-        const images = (response.data.data || []).slice(0, limit);
+        const response = await api.get("/images", { params: { limit } });
+        const images = response.data.data || [];
 
         if (images.length === 0) {
           return {
@@ -167,6 +169,8 @@ server.setRequestHandler(CallToolRequestSchema, async (request) => {
           id: img.ID,
           file_name: img.file_name,
           tags: img.tags,
+          description: img.description,
+          alt_text: img.alt_text,
           upload_time: img.CreatedAt,
         }));
 
@@ -182,7 +186,7 @@ server.setRequestHandler(CallToolRequestSchema, async (request) => {
 
       case "get_image_details": {
         const { image_id } = args;
-        const response = await api.get("/images", { params: { q: "" } });
+        const response = await api.get("/images", { params: { q: `id:${image_id}`, limit: 1 } });
         const images = response.data.data || [];
         const image = images.find((img) => img.ID === image_id);
 
@@ -201,6 +205,8 @@ server.setRequestHandler(CallToolRequestSchema, async (request) => {
           id: image.ID,
           file_name: image.file_name,
           tags: image.tags,
+          description: image.description,
+          alt_text: image.alt_text,
           url: image.url,
           thumbnail_url: image.thumbnail_url,
           exif: {
@@ -225,7 +231,7 @@ server.setRequestHandler(CallToolRequestSchema, async (request) => {
 
       case "get_images_by_tag": {
         const { tag } = args;
-        const response = await api.get("/images", { params: { q: tag } });
+        const response = await api.get("/images", { params: { q: `tag:"${tag}"` } });
         const images = response.data.data || [];
 
         // 进一步过滤，确保标签匹配
@@ -248,6 +254,8 @@ server.setRequestHandler(CallToolRequestSchema, async (request) => {
           id: img.ID,
           file_name: img.file_name,
           tags: img.tags,
+          description: img.description,
+          alt_text: img.alt_text,
           camera: img.camera_model,
         }));
 